@@ -1,5 +1,11 @@
 package model
 
+import (
+	"strings"
+
+	"kubegems.io/modelx/pkg/types"
+)
+
 const (
 	ModelConfigFileName = "modelx.yaml"
 	ReadmeFileName      = "README.md"
@@ -16,3 +22,27 @@ type ModelConfig struct {
 	ModelFiles  []string          `json:"modelFiles"`
 	Config      any               `json:"config"`
 }
+
+// ManifestAnnotations returns the annotations of the config and its metadata to set on the manifest,
+// the registry indexes them for search.
+func (c ModelConfig) ManifestAnnotations() map[string]string {
+	annotations := map[string]string{}
+	for k, v := range c.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range map[string]string{
+		types.AnnotationDescription: c.Description,
+		types.AnnotationFramework:   c.FrameWork,
+		types.AnnotationTask:        c.Task,
+		types.AnnotationTags:        strings.Join(c.Tags, ","),
+		types.AnnotationMaintainers: strings.Join(c.Mantainers, ","),
+	} {
+		if v != "" {
+			annotations[k] = v
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
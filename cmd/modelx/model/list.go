@@ -16,12 +16,15 @@ import (
 	"kubegems.io/modelx/pkg/version"
 )
 
+// DefaultListPageSize is the number of repositories or versions requested in each page by list.
+const DefaultListPageSize = 100
+
 func NewListCmd() *cobra.Command {
-	search := ""
+	options := types.IndexListOptions{Limit: DefaultListPageSize}
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "list manifests",
-		Long:  "list <repo>/[project]/[name]@[version] [--search=<keyword>]",
+		Long:  "list <repo>/[project]/[name]@[version] [--search=<keyword>] [--sort=<name|modified|size|semver>]",
 		Example: `
 	# List all projects of repo
 
@@ -35,6 +38,10 @@ func NewListCmd() *cobra.Command {
 
 		modex list  myrepo/project/demo [--serach=v1.*]
 
+	# List all versions, the latest semantic version first
+
+		modex list  myrepo/project/demo --sort=-semver
+
 	# List all files of cerrtain version
 
   		modex list  myrepo/project/demo@v1.0
@@ -52,21 +59,30 @@ func NewListCmd() *cobra.Command {
 			if len(args) == 0 {
 				return errors.New("at least one argument is required")
 			}
-			items, err := List(ctx, args[0], search)
-			if err != nil {
-				return err
-			}
-			t := table.NewWriter()
-			t.SetOutputMirror(os.Stdout)
-			t.AppendHeader(table.Row(items.Header))
-			for _, item := range items.Items {
-				t.AppendRow(table.Row(item))
-			}
-			t.Render()
-			return nil
+			// render each page once received, only the first page has the header
+			first := true
+			return List(ctx, args[0], options, func(items *ShowList) error {
+				// the last page may be empty if the remaining were removed meanwhile
+				if !first && len(items.Items) == 0 {
+					return nil
+				}
+				t := table.NewWriter()
+				t.SetOutputMirror(os.Stdout)
+				if first {
+					t.AppendHeader(table.Row(items.Header))
+					first = false
+				}
+				for _, item := range items.Items {
+					t.AppendRow(table.Row(item))
+				}
+				t.Render()
+				return nil
+			})
 		},
 	}
-	cmd.Flags().StringVar(&search, "search", search, "search")
+	cmd.Flags().StringVar(&options.Search, "search", options.Search, "search")
+	cmd.Flags().StringVar(&options.Sort, "sort", options.Sort, "sort by name, modified, size or semver, prefix with '-' for descending")
+	cmd.Flags().IntVar(&options.Limit, "page-size", options.Limit, "number of repositories or versions requested at a time, 0 requests all at once")
 	return cmd
 }
 
@@ -75,10 +91,11 @@ type ShowList struct {
 	Items  [][]any
 }
 
-func List(ctx context.Context, ref string, search string) (*ShowList, error) {
+// List calls fn with each page of the repositories or versions, or once with the files of a version.
+func List(ctx context.Context, ref string, options types.IndexListOptions, fn func(items *ShowList) error) error {
 	reference, err := ParseReference(ref)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	cli := reference.Client()
@@ -87,28 +104,26 @@ func List(ctx context.Context, ref string, search string) (*ShowList, error) {
 	switch {
 	case repo == "" && version == "":
 		// list repositories
-		index, err := cli.GetGlobalIndex(ctx, search)
-		if err != nil {
-			return nil, err
-		}
-		show := &ShowList{
-			Header: []any{"Project", "Name", "URL"},
-		}
-		for _, item := range index.Manifests {
-			splits := strings.SplitN(item.Name, "/", 2)
-			if len(splits) == 1 {
-				splits = append(splits, "")
+		return cli.WalkGlobalIndex(ctx, options, func(page []types.Descriptor) error {
+			show := &ShowList{
+				Header: []any{"Project", "Name", "URL"},
 			}
-			show.Items = append(show.Items, []any{
-				splits[0], splits[1], Reference{Registry: reference.Registry, Repository: item.Name}.String(),
-			})
-		}
-		return show, nil
+			for _, item := range page {
+				splits := strings.SplitN(item.Name, "/", 2)
+				if len(splits) == 1 {
+					splits = append(splits, "")
+				}
+				show.Items = append(show.Items, []any{
+					splits[0], splits[1], Reference{Registry: reference.Registry, Repository: item.Name}.String(),
+				})
+			}
+			return fn(show)
+		})
 	case repo != "" && version != "":
 		// list files
 		manifest, err := cli.GetManifest(ctx, repo, version)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		show := &ShowList{
 			Header: []any{"File", "Type", "Size", "Digest", "Modified"},
@@ -138,27 +153,30 @@ func List(ctx context.Context, ref string, search string) (*ShowList, error) {
 				formattime(item.Modified),
 			})
 		}
-		return show, nil
+		return fn(show)
 	case repo != "" && version == "":
 		// list versions
-		index, err := cli.GetIndex(ctx, repo, search)
-		if err != nil {
-			return nil, err
-		}
-		show := &ShowList{
-			Header: []any{"Version", "URL", "Size"},
-		}
-		for _, item := range index.Manifests {
-			ref := Reference{Registry: reference.Registry, Repository: repo, Version: item.Name}
-			show.Items = append(show.Items, []any{
-				item.Name,
-				ref.String(),
-				formatSize(item.Size),
-			})
-		}
-		return show, nil
+		return cli.WalkIndex(ctx, repo, options, func(page []types.Descriptor) error {
+			show := &ShowList{
+				Header: []any{"Version", "URL", "Size", "Digest"},
+			}
+			for _, item := range page {
+				ref := Reference{Registry: reference.Registry, Repository: repo, Version: item.Name}
+				itemDigest := "-"
+				if item.Digest != "" {
+					itemDigest = item.Digest.String()
+				}
+				show.Items = append(show.Items, []any{
+					item.Name,
+					ref.String(),
+					formatSize(item.Size),
+					itemDigest,
+				})
+			}
+			return fn(show)
+		})
 	default:
-		return nil, errors.New("invalid reference")
+		return errors.New("invalid reference")
 	}
 }
 
@@ -4,14 +4,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"kubegems.io/modelx/cmd/modelx/repo"
 	"kubegems.io/modelx/pkg/client"
 )
 
+type LoginOptions struct {
+	Token    string
+	Username string
+	Password string
+}
+
+func (o *LoginOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.Token, "token", "t", o.Token, "token")
+	cmd.Flags().StringVarP(&o.Username, "username", "u", o.Username, "username of basic auth")
+	cmd.Flags().StringVarP(&o.Password, "password", "p", o.Password, "password of basic auth")
+}
+
 func NewLoginCmd() *cobra.Command {
-	token := ""
+	options := LoginOptions{}
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "login to a modelx repository",
@@ -24,6 +38,10 @@ func NewLoginCmd() *cobra.Command {
 
   		modelx login myrepo --token <token>
 
+	3. Login to myrepo with username and password
+
+  		modelx login myrepo --username <username> --password <password>
+
 		`,
 		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			if len(args) == 0 {
@@ -37,23 +55,37 @@ func NewLoginCmd() *cobra.Command {
 			if len(args) == 0 {
 				return errors.New("at least one argument is required")
 			}
-			if token == "" {
+			if options.Username != "" && options.Token != "" {
+				return errors.New("token and username can not be used together")
+			}
+			if options.Username != "" && options.Password == "" {
+				fmt.Print("Password: ")
+				password, err := term.ReadPassword(int(os.Stdin.Fd()))
+				fmt.Println()
+				if err != nil {
+					return err
+				}
+				options.Password = string(password)
+			}
+			if options.Username == "" && options.Token == "" {
 				fmt.Print("Token: ")
-				fmt.Scanln(&token)
+				fmt.Scanln(&options.Token)
 			}
-			return LoginModelx(ctx, args[0], token)
+			return LoginModelx(ctx, args[0], options)
 		},
 	}
-	cmd.Flags().StringVarP(&token, "token", "t", "", "token")
+	options.AddFlags(cmd)
 	return cmd
 }
 
-func LoginModelx(ctx context.Context, reponame string, token string) error {
+func LoginModelx(ctx context.Context, reponame string, options LoginOptions) error {
 	repoDetails, err := repo.DefaultRepoManager.Get(reponame)
 	if err != nil {
 		return err
 	}
-	repoDetails.Token = token
+	repoDetails.Token = options.Token
+	repoDetails.Username = options.Username
+	repoDetails.Password = options.Password
 	if err := repoDetails.Client().Ping(ctx); err != nil {
 		return err
 	}
@@ -21,6 +21,7 @@ func NewModelxCmd() *cobra.Command {
 	cmd.AddCommand(NewInitCmd())
 	cmd.AddCommand(NewLoginCmd())
 	cmd.AddCommand(NewListCmd())
+	cmd.AddCommand(NewSearchCmd())
 	cmd.AddCommand(NewInfoCmd())
 	cmd.AddCommand(NewPushCmd())
 	cmd.AddCommand(NewPullCmd())
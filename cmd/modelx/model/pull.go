@@ -8,9 +8,40 @@ import (
 
 	"github.com/spf13/cobra"
 	"kubegems.io/modelx/cmd/modelx/repo"
+	"kubegems.io/modelx/pkg/client"
+	"kubegems.io/modelx/pkg/client/units"
 )
 
+type PullOptions struct {
+	Concurrency int
+	PartSize    string
+}
+
+func (o *PullOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&o.Concurrency, "download-concurrency", o.Concurrency, "number of parts of a large blob downloaded in parallel, 1 to disable parallel download")
+	cmd.Flags().StringVar(&o.PartSize, "download-part-size", o.PartSize, "part size of parallel download, e.g. 64Mi")
+}
+
+// Apply sets the download options on client.
+func (o PullOptions) Apply(cli *client.Client) error {
+	if o.Concurrency > 0 {
+		cli.DownloadConcurrency = o.Concurrency
+	}
+	if o.PartSize != "" {
+		partsize, err := units.RAMInBytes(o.PartSize)
+		if err != nil {
+			return err
+		}
+		if partsize <= 0 {
+			return fmt.Errorf("invalid download part size %s", o.PartSize)
+		}
+		cli.DownloadPartSize = partsize
+	}
+	return nil
+}
+
 func NewPullCmd() *cobra.Command {
+	options := PullOptions{Concurrency: client.DownloadPartConcurrency}
 	cmd := &cobra.Command{
 		Use:   "pull",
 		Short: "pull a model from a repository",
@@ -47,13 +78,14 @@ func NewPullCmd() *cobra.Command {
 			if len(args) == 1 {
 				args = append(args, "")
 			}
-			return PullModelx(ctx, args[0], args[1])
+			return PullModelx(ctx, args[0], args[1], options)
 		},
 	}
+	options.AddFlags(cmd)
 	return cmd
 }
 
-func PullModelx(ctx context.Context, ref string, into string) error {
+func PullModelx(ctx context.Context, ref string, into string, options PullOptions) error {
 	reference, err := ParseReference(ref)
 	if err != nil {
 		return err
@@ -65,5 +97,9 @@ func PullModelx(ctx context.Context, ref string, into string) error {
 		into = path.Base(reference.Repository)
 	}
 	fmt.Printf("Pulling %s into %s \n", reference.String(), into)
-	return reference.Client().Pull(ctx, reference.Repository, reference.Version, into)
+	cli := reference.Client()
+	if err := options.Apply(cli); err != nil {
+		return err
+	}
+	return cli.Pull(ctx, reference.Repository, reference.Version, into)
 }
@@ -13,6 +13,7 @@ import (
 )
 
 func NewPushCmd() *cobra.Command {
+	mountFrom := []string{}
 	cmd := &cobra.Command{
 		Use:   "push",
 		Short: "push a model to a modelx repository",
@@ -49,16 +50,17 @@ func NewPushCmd() *cobra.Command {
 			if len(args) == 1 {
 				args = append(args, "")
 			}
-			if err := PushModel(ctx, args[0], args[1]); err != nil {
+			if err := PushModel(ctx, args[0], args[1], mountFrom); err != nil {
 				return err
 			}
 			return nil
 		},
 	}
+	cmd.Flags().StringSliceVar(&mountFrom, "mount-from", mountFrom, "repositories in the same registry to mount existing blobs from instead of uploading, e.g. project/base-model")
 	return cmd
 }
 
-func PushModel(ctx context.Context, ref string, dir string) error {
+func PushModel(ctx context.Context, ref string, dir string, mountFrom []string) error {
 	reference, err := ParseReference(ref)
 	if err != nil {
 		return err
@@ -76,5 +78,8 @@ func PushModel(ctx context.Context, ref string, dir string) error {
 		return fmt.Errorf("parse model config:%s %w", ModelConfigFileName, err)
 	}
 	fmt.Printf("Pushing to %s \n", reference.String())
-	return reference.Client().Push(ctx, reference.Repository, reference.Version, ModelConfigFileName, dir)
+	cli := reference.Client()
+	cli.MountFrom = mountFrom
+	cli.Annotations = config.ManifestAnnotations()
+	return cli.Push(ctx, reference.Repository, reference.Version, ModelConfigFileName, dir)
 }
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/opencontainers/go-digest"
 	"kubegems.io/modelx/cmd/modelx/repo"
 	"kubegems.io/modelx/pkg/client"
 )
@@ -39,7 +40,7 @@ func ParseReference(raw string) (Reference, error) {
 			return Reference{}, err
 		}
 		if auth == "" {
-			auth = "Bearer " + details.Token
+			auth = details.Authorization()
 		}
 		if len(splits) == 2 {
 			raw = details.URL + "/" + splits[1]
@@ -68,6 +69,11 @@ func ParseReference(raw string) (Reference, error) {
 	} else {
 		version = splits[1]
 	}
+	if strings.Contains(version, ":") {
+		if _, err := digest.Parse(version); err != nil {
+			return Reference{}, fmt.Errorf("invalid reference: digest %s: %v", version, err)
+		}
+	}
 	if sp0 := splits[0]; sp0 != "" {
 		repository = sp0[1:]
 	}
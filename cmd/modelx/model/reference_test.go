@@ -14,13 +14,18 @@ func TestParseReference(t *testing.T) {
 	}{
 		{
 			name: "valid",
-			raw:  "https://registry.example.com/repository@sha256:abcdef",
+			raw:  "https://registry.example.com/repository@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
 			want: Reference{
 				Registry:   "https://registry.example.com",
-				Repository: "repository",
-				Version:    "sha256:abcdef",
+				Repository: "library/repository",
+				Version:    "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
 			},
 		},
+		{
+			name:    "invalid digest",
+			raw:     "https://registry.example.com/repository@sha256:abcdef",
+			wantErr: true,
+		},
 		{
 			raw: "https://registry.example.com:8443/repository/name@v1",
 			want: Reference{
@@ -33,8 +38,7 @@ func TestParseReference(t *testing.T) {
 			raw: "https://registry.example.com/repo/name",
 			want: Reference{
 				Registry:   "https://registry.example.com",
-				Repository: "repository/name",
-				Version:    "latest",
+				Repository: "repo/name",
 			},
 		},
 	}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"kubegems.io/modelx/cmd/modelx/repo"
+	"kubegems.io/modelx/pkg/types"
+	"kubegems.io/modelx/pkg/version"
+)
+
+func NewSearchCmd() *cobra.Command {
+	options := types.IndexListOptions{Limit: DefaultListPageSize}
+	cmd := &cobra.Command{
+		Use:   "search",
+		Short: "search models by metadata",
+		Long: `search <repo>[/project/name] [<key><op><value>...]
+
+Conditions are the framework, task, tags, maintainers and annotations in modelx.yaml, the size and modified time
+of the latest version. "=" and "!=" test equality, values separated by "|" match any of them,
+">", ">=", "<" and "<=" compare size and modified. All conditions must match.`,
+		Example: `
+	# Search pytorch models for text generation tagged llm
+
+		modelx search myrepo framework=pytorch task=text-generation tag=llm
+
+	# Search models of some frameworks smaller than 10GB, the latest modified first
+
+		modelx search myrepo "framework=pytorch|tensorflow" "size<10GB" --sort=-modified
+
+	# Search versions of a model modified since 2023
+
+		modelx search myrepo/project/demo modified>=2023-01-01
+		`,
+		Version:      version.Get().String(),
+		SilenceUsage: true,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return repo.CompleteRegistryRepositoryVersion(toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := BaseContext()
+			defer cancel()
+			if len(args) == 0 {
+				return errors.New("at least one argument is required")
+			}
+			options.Query = strings.Join(args[1:], ",")
+			first := true
+			return Search(ctx, args[0], options, func(items *ShowList) error {
+				if !first && len(items.Items) == 0 {
+					return nil
+				}
+				t := table.NewWriter()
+				t.SetOutputMirror(os.Stdout)
+				if first {
+					t.AppendHeader(table.Row(items.Header))
+					first = false
+				}
+				for _, item := range items.Items {
+					t.AppendRow(table.Row(item))
+				}
+				t.Render()
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&options.Sort, "sort", options.Sort, "sort by name, modified, size or semver, prefix with '-' for descending")
+	cmd.Flags().IntVar(&options.Limit, "page-size", options.Limit, "number of results requested at a time, 0 requests all at once")
+	return cmd
+}
+
+// Search calls fn with each page of the repositories, or the versions if ref is a repository, match options.Query.
+func Search(ctx context.Context, ref string, options types.IndexListOptions, fn func(items *ShowList) error) error {
+	reference, err := ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	if reference.Version != "" {
+		return errors.New("version can not be specified to search")
+	}
+	cli := reference.Client()
+	header := []any{"Repository", "Framework", "Task", "Tags", "Size", "Modified"}
+	if reference.Repository != "" {
+		header[0] = "Version"
+	}
+	page := func(page []types.Descriptor) error {
+		show := &ShowList{Header: header}
+		for _, item := range page {
+			name := Reference{Registry: reference.Registry, Repository: item.Name}.String()
+			if reference.Repository != "" {
+				name = Reference{Registry: reference.Registry, Repository: reference.Repository, Version: item.Name}.String()
+			}
+			show.Items = append(show.Items, []any{
+				name,
+				item.Annotations[types.AnnotationFramework],
+				item.Annotations[types.AnnotationTask],
+				item.Annotations[types.AnnotationTags],
+				formatSize(item.Size),
+				formatModified(item.Modified),
+			})
+		}
+		return fn(show)
+	}
+	if reference.Repository == "" {
+		return cli.WalkGlobalIndex(ctx, options, page)
+	}
+	return cli.WalkIndex(ctx, reference.Repository, options, page)
+}
+
+func formatModified(tm time.Time) string {
+	if tm.IsZero() {
+		return "-"
+	}
+	return tm.Local().Format(time.DateTime)
+}
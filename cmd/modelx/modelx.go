@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
 	"net/http"
 	"os"
 
@@ -9,12 +11,21 @@ import (
 	"kubegems.io/modelx/cmd/modelx/completion"
 	"kubegems.io/modelx/cmd/modelx/model"
 	"kubegems.io/modelx/cmd/modelx/repo"
+	"kubegems.io/modelx/cmd/modelx/token"
+	"kubegems.io/modelx/pkg/tracing"
 )
 
 const ErrExitCode = 1
 
 func main() {
-	if err := NewModelxCmd().Execute(); err != nil {
+	shutdown, err := tracing.Init(context.Background(), "modelx")
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(ErrExitCode)
+	}
+	err = NewModelxCmd().Execute()
+	shutdown(context.Background())
+	if err != nil {
 		os.Exit(ErrExitCode)
 	}
 }
@@ -24,6 +35,7 @@ func NewModelxCmd() *cobra.Command {
 	cmd := model.NewModelxCmd()
 	cmd.AddCommand(
 		repo.NewRepoCmd(),
+		token.NewTokenCmd(),
 		completion.CompletionCmd,
 	)
 	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
+	"kubegems.io/modelx/pkg/types"
 )
 
 const (
@@ -13,6 +14,9 @@ const (
 	SplitorVersion = "@"
 )
 
+// CompletionLimit is the max number of candidates requested for shell completion.
+const CompletionLimit = 100
+
 func NewRepoListCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "list",
@@ -78,7 +82,7 @@ func CompleteRepositories(registry string, repositoryToComplete string) ([]strin
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveError
 	}
-	index, err := details.Client().GetGlobalIndex(context.Background(), repositoryToComplete)
+	index, err := details.Client().GetGlobalIndex(context.Background(), types.IndexListOptions{Search: repositoryToComplete, Limit: CompletionLimit})
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveError
 	}
@@ -94,7 +98,7 @@ func CompleteVersion(registry, repository, versionToComplete string) ([]string,
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveError
 	}
-	index, err := details.Client().GetIndex(context.Background(), repository, versionToComplete)
+	index, err := details.Client().GetIndex(context.Background(), repository, types.IndexListOptions{Search: versionToComplete, Limit: CompletionLimit})
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveError
 	}
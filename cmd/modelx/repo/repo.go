@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -32,10 +33,21 @@ type RepoDetails struct {
 	Name  string `json:"name,omitempty"`
 	URL   string `json:"url,omitempty"`
 	Token string `json:"token,omitempty"`
+	// Username and Password are basic credentials, used instead of token if username set.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Authorization returns the value of Authorization header to access the repo.
+func (r RepoDetails) Authorization() string {
+	if r.Username != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(r.Username+":"+r.Password))
+	}
+	return "Bearer " + r.Token
 }
 
 func (r RepoDetails) Client() *client.Client {
-	return client.NewClient(r.URL, "Bearer "+r.Token)
+	return client.NewClient(r.URL, r.Authorization())
 }
 
 var DefaultRepoManager = Repomanager{
@@ -127,5 +139,9 @@ func (r *Repomanager) save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(r.Path, content, 0o644)
+	// the file contains credentials
+	if err := os.WriteFile(r.Path, content, 0o600); err != nil {
+		return err
+	}
+	return os.Chmod(r.Path, 0o600)
 }
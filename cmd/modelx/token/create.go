@@ -0,0 +1,55 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"kubegems.io/modelx/cmd/modelx/model"
+	"kubegems.io/modelx/cmd/modelx/repo"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func NewTokenCreateCmd() *cobra.Command {
+	robot := false
+	req := types.APITokenRequest{}
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "create an api token",
+		Long:  "create <repo> <name> [--robot] [--scope=<repository>:<role>] [--expires-in=<duration>]",
+		Example: `
+	# Create a personal token
+
+		modelx token create myrepo laptop --expires-in 720h
+
+	# Create a robot account can push to all repositories of project team
+
+		modelx token create myrepo ci --robot --scope "team/*:writer"
+		`,
+		ValidArgsFunction: completeRegistry,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := model.BaseContext()
+			defer cancel()
+			if len(args) != 2 {
+				return fmt.Errorf("token create requires two arguments")
+			}
+			details, err := repo.DefaultRepoManager.Get(args[0])
+			if err != nil {
+				return err
+			}
+			req.Name = args[1]
+			if robot {
+				req.Type = types.APITokenTypeRobot
+			}
+			token, err := details.Client().Remote.CreateAPIToken(ctx, req)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Token %s created for %s, it will not be shown again:\n%s\n", token.ID, token.Username, token.Token)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&robot, "robot", "", robot, "create a robot account, scopes are required")
+	cmd.Flags().StringSliceVarP(&req.Scopes, "scope", "", req.Scopes, "limit the token to {repository}:{role}, e.g. team/*:reader")
+	cmd.Flags().StringVarP(&req.ExpiresIn, "expires-in", "", req.ExpiresIn, "lifetime of the token, e.g. 720h, never expires if empty")
+	return cmd
+}
@@ -0,0 +1,57 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"kubegems.io/modelx/cmd/modelx/model"
+	"kubegems.io/modelx/cmd/modelx/repo"
+)
+
+func NewTokenListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list api tokens",
+		Long:  "List the api tokens created by the current user, admins list all tokens",
+		Example: `
+	# List api tokens
+
+		modelx token list myrepo
+		`,
+		ValidArgsFunction: completeRegistry,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := model.BaseContext()
+			defer cancel()
+			if len(args) != 1 {
+				return fmt.Errorf("token list requires one argument")
+			}
+			details, err := repo.DefaultRepoManager.Get(args[0])
+			if err != nil {
+				return err
+			}
+			tokens, err := details.Client().Remote.ListAPITokens(ctx)
+			if err != nil {
+				return err
+			}
+			t := table.NewWriter()
+			t.SetOutputMirror(cmd.OutOrStdout())
+			t.AppendHeader(table.Row{"ID", "Name", "Type", "Username", "Scopes", "Created", "Expires"})
+			for _, token := range tokens {
+				expires := "never"
+				if token.ExpiresAt != nil {
+					expires = token.ExpiresAt.Local().Format(time.RFC3339)
+				}
+				t.AppendRow(table.Row{
+					token.ID, token.Name, token.Type, token.Username, strings.Join(token.Scopes, ","),
+					token.CreatedAt.Local().Format(time.RFC3339), expires,
+				})
+			}
+			t.Render()
+			return nil
+		},
+	}
+	return cmd
+}
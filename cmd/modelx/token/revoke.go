@@ -0,0 +1,43 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"kubegems.io/modelx/cmd/modelx/model"
+	"kubegems.io/modelx/cmd/modelx/repo"
+)
+
+func NewTokenRevokeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "revoke api tokens",
+		Long:  "revoke <repo> <id>...",
+		Example: `
+	# Revoke a token by id
+
+		modelx token revoke myrepo 3f2a9c0d1e4b5a67
+		`,
+		ValidArgsFunction: completeRegistry,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := model.BaseContext()
+			defer cancel()
+			if len(args) < 2 {
+				return fmt.Errorf("token revoke requires a repo and at least one token id")
+			}
+			details, err := repo.DefaultRepoManager.Get(args[0])
+			if err != nil {
+				return err
+			}
+			remote := details.Client().Remote
+			for _, id := range args[1:] {
+				if err := remote.RevokeAPIToken(ctx, id); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Token %s revoked\n", id)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
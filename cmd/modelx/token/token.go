@@ -0,0 +1,25 @@
+package token
+
+import (
+	"github.com/spf13/cobra"
+	"kubegems.io/modelx/cmd/modelx/repo"
+)
+
+func NewTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "API token management",
+		Long:  "Manage the personal tokens and robot accounts issued by a modelx repository",
+	}
+	cmd.AddCommand(NewTokenCreateCmd())
+	cmd.AddCommand(NewTokenListCmd())
+	cmd.AddCommand(NewTokenRevokeCmd())
+	return cmd
+}
+
+func completeRegistry(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return repo.CompleteRegistry(toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
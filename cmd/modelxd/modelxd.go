@@ -11,6 +11,7 @@ import (
 	"github.com/go-logr/stdr"
 	"github.com/spf13/cobra"
 	"kubegems.io/modelx/pkg/registry"
+	"kubegems.io/modelx/pkg/tracing"
 	"kubegems.io/modelx/pkg/version"
 )
 
@@ -30,17 +31,23 @@ func NewRegistryCmd() *cobra.Command {
 		Short:   "modelxd",
 		Version: version.Get().String(),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+			ctx, cancel := BaseContext()
 			defer cancel()
 
-			log.SetFlags(log.LstdFlags | log.Lshortfile)
-			ctx = logr.NewContext(ctx, stdr.NewWithOptions(log.Default(), stdr.Options{LogCaller: stdr.Error}))
+			shutdown, err := tracing.Init(ctx, "modelxd")
+			if err != nil {
+				return err
+			}
+			defer shutdown(context.Background())
 
 			return registry.Run(ctx, options)
 		},
 	}
 
-	flags := cmd.Flags()
+	cmd.AddCommand(NewReindexCmd(options))
+
+	// flags are shared by sub commands, e.g. reindex needs the storage flags
+	flags := cmd.PersistentFlags()
 	flags.StringVar(&options.Listen, "listen", options.Listen, "listen address")
 	flags.StringVar(&options.TLS.CAFile, "tls-ca", options.TLS.CAFile, "tls ca file")
 	flags.StringVar(&options.TLS.CertFile, "tls-cert", options.TLS.CertFile, "tls cert file")
@@ -52,7 +59,59 @@ func NewRegistryCmd() *cobra.Command {
 	flags.DurationVar(&options.S3.PresignExpire, "s3-presign-expire", options.S3.PresignExpire, "s3 presign expire")
 	flags.StringVar(&options.S3.Region, "s3-region", options.S3.Region, "s3 region")
 	flags.StringVar(&options.OIDC.Issuer, "oidc-issuer", options.OIDC.Issuer, "oidc issuer")
+	flags.StringVar(&options.OIDC.GroupsClaim, "oidc-groups-claim", options.OIDC.GroupsClaim, "oidc token claim contains the groups of user")
+	flags.StringVar(&options.Auth.TokenFile, "auth-token-file", options.Auth.TokenFile, "static tokens file of users")
+	flags.StringVar(&options.Auth.HtpasswdFile, "auth-htpasswd-file", options.Auth.HtpasswdFile, "htpasswd file of basic auth users, only bcrypt is supported")
+	flags.StringVar(&options.AuthWebhook.URL, "auth-webhook-url", options.AuthWebhook.URL, "token review webhook url to authenticate bearer tokens")
+	flags.DurationVar(&options.AuthWebhook.Timeout, "auth-webhook-timeout", options.AuthWebhook.Timeout, "timeout of token review requests")
+	flags.DurationVar(&options.AuthWebhook.CacheTTL, "auth-webhook-cache-ttl", options.AuthWebhook.CacheTTL, "duration to cache accepted tokens")
+	flags.DurationVar(&options.AuthWebhook.NegativeCacheTTL, "auth-webhook-negative-cache-ttl", options.AuthWebhook.NegativeCacheTTL, "duration to cache rejected tokens")
+	flags.StringVar(&options.AuthorizationConfig, "authorization-config", options.AuthorizationConfig, "roles file of users and groups on projects, reloaded on change")
+	flags.StringVar(&options.UploadDir, "upload-dir", options.UploadDir, "directory to keep in-progress blob uploads")
+	flags.DurationVar(&options.UploadTTL, "upload-ttl", options.UploadTTL, "remove in-progress blob uploads received no data within the duration, 0 to keep forever")
+	flags.DurationVar(&options.GC.Interval, "gc-interval", options.GC.Interval, "interval of periodic blobs garbage collect, 0 to disable")
+	flags.BoolVar(&options.GC.DryRun, "gc-dry-run", options.GC.DryRun, "only report unused blobs in periodic garbage collect")
+	flags.DurationVar(&options.GC.GracePeriod, "gc-grace-period", options.GC.GracePeriod, "keep unused blobs modified within the period")
+	flags.StringVar(&options.Retention.Config, "retention-config", options.Retention.Config, "retention rules file of repositories")
+	flags.DurationVar(&options.Retention.Interval, "retention-interval", options.Retention.Interval, "interval of periodic retention, 0 to disable")
+	flags.BoolVar(&options.Retention.DryRun, "retention-dry-run", options.Retention.DryRun, "only report expired versions in periodic retention")
+	flags.StringVar(&options.ImmutabilityConfig, "immutability-config", options.ImmutabilityConfig, "immutability rules file of repository versions")
+	flags.StringSliceVar(&options.AdminUsers, "admin-users", options.AdminUsers, "users are admins of all repositories, e.g. can force to overwrite or delete immutable versions")
+	flags.StringVar(&options.Audit.File, "audit-file", options.Audit.File, "file to append audit events as json lines")
+	flags.BoolVar(&options.Audit.Stdout, "audit-stdout", options.Audit.Stdout, "write audit events to stdout as json lines")
+	flags.StringVar(&options.Audit.WebhookURL, "audit-webhook-url", options.Audit.WebhookURL, "webhook url to post audit events")
+	flags.DurationVar(&options.Audit.WebhookTimeout, "audit-webhook-timeout", options.Audit.WebhookTimeout, "timeout of audit webhook requests")
+	flags.StringVar(&options.Notification.Config, "notification-config", options.Notification.Config, "notification endpoints file")
+	flags.StringVar(&options.Notification.QueueDir, "notification-queue-dir", options.Notification.QueueDir, "directory to keep the notifications not delivered yet")
+	flags.IntVar(&options.EventsBufferSize, "events-buffer-size", options.EventsBufferSize, "number of recent events kept to resume event streams, 0 disables event streams")
+	flags.StringVar(&options.MetadataDB, "metadata-db", options.MetadataDB, "metadata database file to serve indexes, the index files in storage are used if empty. it is local to modelxd, so modelxd must run as a single replica if set")
+	flags.StringVar(&options.MetricsListen, "metrics-listen", options.MetricsListen, "listen address of metrics without authentication, metrics are served on the api listen address to admins if empty")
 	flags.BoolVar(&options.EnableRedirect, "enable-redirect", options.EnableRedirect, "enable blob storage redirect")
 
 	return cmd
 }
+
+func NewReindexCmd(options *registry.Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "reindex",
+		Short: "rebuild the indexes from storage",
+		Long: `Rebuild the metadata database, or the index files if --metadata-db is not set, from the manifests in storage.
+modelxd must be stopped before reindexing the metadata database.`,
+		Example: `
+		modelxd reindex --s3-url=http://minio:9000 --s3-bucket=modelx --metadata-db=data/metadata.db
+		`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := BaseContext()
+			defer cancel()
+			return registry.Reindex(ctx, options)
+		},
+	}
+}
+
+// BaseContext returns the context canceled on interrupt, with the logger.
+func BaseContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	ctx = logr.NewContext(ctx, stdr.NewWithOptions(log.Default(), stdr.Options{LogCaller: stdr.Error}))
+	return ctx, cancel
+}
@@ -8,8 +8,11 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 	"kubegems.io/modelx/cmd/modelx/model"
+	"kubegems.io/modelx/pkg/client"
+	"kubegems.io/modelx/pkg/tracing"
 	"kubegems.io/modelx/pkg/types"
 	"kubegems.io/modelx/pkg/version"
 )
@@ -17,13 +20,21 @@ import (
 const ErrExitCode = 1
 
 func main() {
-	if err := NewDLCmd().Execute(); err != nil {
+	shutdown, err := tracing.Init(context.Background(), "modelxdl")
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(ErrExitCode)
+	}
+	err = NewDLCmd().Execute()
+	shutdown(context.Background())
+	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(ErrExitCode)
 	}
 }
 
 func NewDLCmd() *cobra.Command {
+	options := model.PullOptions{Concurrency: client.DownloadPartConcurrency}
 	cmd := &cobra.Command{
 		Use:     "modelxdl",
 		Short:   "modelx storage initalizer for seldon",
@@ -41,19 +52,26 @@ func NewDLCmd() *cobra.Command {
 
 			// Seldon Storage Initializer accept two arguments: modelUri and modelPath
 			// Authorizations config from environment variable MODELX_AUTH
-			return Run(ctx, args[0], args[1])
+			return Run(ctx, args[0], args[1], options)
 		},
 	}
+	options.AddFlags(cmd)
 	return cmd
 }
 
-func Run(ctx context.Context, uri string, dest string) error {
+func Run(ctx context.Context, uri string, dest string, options model.PullOptions) (err error) {
 	ref, err := model.ParseReference(uri)
 	if err != nil {
 		return err
 	}
+	ctx, span := tracing.Start(ctx, "Pull", attribute.String("modelx.repository", ref.Repository), attribute.String("modelx.version", ref.Version))
+	defer func() { tracing.End(span, err) }()
+
 	fmt.Printf("Pulling %s into %s \n", ref.String(), dest)
 	cli := ref.Client()
+	if err := options.Apply(cli); err != nil {
+		return err
+	}
 
 	manifest, err := cli.Remote.GetManifest(ctx, ref.Repository, ref.Version)
 	if err != nil {
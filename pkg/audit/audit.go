@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	ActionPutManifest    = "put-manifest"
+	ActionDeleteManifest = "delete-manifest"
+	ActionDeleteIndex    = "delete-index"
+	ActionPutBlob        = "put-blob"
+	ActionGarbageCollect = "garbage-collect"
+)
+
+// Event is a mutation of the registry.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// User is empty if authentication is disabled.
+	User     string `json:"user,omitempty"`
+	ClientIP string `json:"clientIP,omitempty"`
+	// ForwardedFor is the X-Forwarded-For header, set by proxies or the client itself.
+	ForwardedFor string `json:"forwardedFor,omitempty"`
+	Repository   string `json:"repository"`
+	Reference    string `json:"reference,omitempty"`
+	// OldDigest is the digest of the manifest overwritten or deleted.
+	OldDigest string `json:"oldDigest,omitempty"`
+	// NewDigest is the digest of the manifest or blob pushed.
+	NewDigest string         `json:"newDigest,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// Auditor records events into sinks, failures of sinks are logged and never fail the requests.
+type Auditor struct {
+	Sinks []Sink
+}
+
+func NewAuditor(sinks ...Sink) *Auditor {
+	return &Auditor{Sinks: sinks}
+}
+
+// Enabled reports whether any sink is configured, events are expensive to collect sometimes.
+func (a *Auditor) Enabled() bool {
+	return a != nil && len(a.Sinks) > 0
+}
+
+func (a *Auditor) Record(ctx context.Context, event Event) {
+	if !a.Enabled() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	for _, sink := range a.Sinks {
+		if err := sink.Write(ctx, event); err != nil {
+			logr.FromContextOrDiscard(ctx).Error(err, "write audit event", "action", event.Action, "repository", event.Repository)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterSink writes events as json lines.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink appends events to file as json lines.
+func NewFileSink(file string) (*WriterSink, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(f), nil
+}
+
+func (s *WriterSink) Write(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readEvents parses the json lines of content.
+func readEvents(t *testing.T, content []byte) []Event {
+	t.Helper()
+	events := []Event{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid json line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewWriterSink(buf)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := Event{
+		Time:       now,
+		Action:     ActionPutManifest,
+		User:       "alice",
+		ClientIP:   "10.0.0.1",
+		Repository: "project/a",
+		Reference:  "v1",
+		OldDigest:  "sha256:old",
+		NewDigest:  "sha256:new",
+	}
+	if err := sink.Write(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(context.Background(), Event{Time: now, Action: ActionGarbageCollect, Repository: "project/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		t.Errorf("output %q does not end with a newline", buf.String())
+	}
+	events := readEvents(t, buf.Bytes())
+	if len(events) != 2 || !reflect.DeepEqual(events[0], event) || events[1].Action != ActionGarbageCollect {
+		t.Errorf("written events = %+v, want %+v and a garbage-collect", events, event)
+	}
+	// empty fields are omitted
+	if bytes.Contains(buf.Bytes(), []byte(`"user":""`)) {
+		t.Errorf("empty user written: %s", buf)
+	}
+}
+
+func TestWriterSinkConcurrent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewWriterSink(buf)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sink.Write(context.Background(), Event{Action: ActionPutBlob, Repository: "project/a", Reference: strconv.Itoa(i)})
+		}(i)
+	}
+	wg.Wait()
+	// lines never interleave
+	if events := readEvents(t, buf.Bytes()); len(events) != 50 {
+		t.Errorf("written %d events, want 50", len(events))
+	}
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	for _, reference := range []string{"v1", "v2"} {
+		// reopened as if restarted
+		sink, err := NewFileSink(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(context.Background(), Event{Action: ActionPutManifest, Repository: "project/a", Reference: reference}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := readEvents(t, content)
+	if len(events) != 2 || events[0].Reference != "v1" || events[1].Reference != "v2" {
+		t.Errorf("events in file = %+v, want v1 and v2", events)
+	}
+}
+
+type sinkFunc func(ctx context.Context, event Event) error
+
+func (f sinkFunc) Write(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+func TestAuditorRecord(t *testing.T) {
+	buf := &bytes.Buffer{}
+	failing := sinkFunc(func(ctx context.Context, event Event) error { return errors.New("broken") })
+	auditor := NewAuditor(failing, NewWriterSink(buf))
+	auditor.Record(context.Background(), Event{Action: ActionDeleteIndex, Repository: "project/a"})
+
+	// a failed sink does not stop the others
+	events := readEvents(t, buf.Bytes())
+	if len(events) != 1 || events[0].Time.IsZero() {
+		t.Errorf("recorded events = %+v, want one with time set", events)
+	}
+	var disabled *Auditor
+	if disabled.Enabled() || NewAuditor().Enabled() {
+		t.Error("auditor without sinks enabled")
+	}
+	disabled.Record(context.Background(), Event{})
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	DefaultWebhookTimeout = 10 * time.Second
+
+	// webhookQueueSize is the events waiting to post, new events are dropped if the queue is full.
+	webhookQueueSize = 1024
+)
+
+var ErrWebhookQueueFull = errors.New("audit webhook queue is full, event dropped")
+
+// WebhookSink posts events to a webhook one by one in background, so a slow webhook never blocks requests.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+
+	queue chan Event
+}
+
+func NewWebhookSink(ctx context.Context, url string, timeout time.Duration) *WebhookSink {
+	s := &WebhookSink{
+		URL:    url,
+		Client: &http.Client{Timeout: timeout},
+		queue:  make(chan Event, webhookQueueSize),
+	}
+	go s.run(ctx)
+	return s
+}
+
+func (s *WebhookSink) Write(ctx context.Context, event Event) error {
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return ErrWebhookQueueFull
+	}
+}
+
+func (s *WebhookSink) run(ctx context.Context) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("url", s.URL)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			if err := s.post(ctx, event); err != nil {
+				log.Error(err, "post audit event", "action", event.Action, "repository", event.Repository)
+			}
+		}
+	}
+}
+
+func (s *WebhookSink) post(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSinkPost(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := Event{}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := NewWebhookSink(ctx, server.URL, DefaultWebhookTimeout)
+	if err := sink.Write(ctx, Event{Action: ActionPutManifest, Repository: "project/a", Reference: "v1", User: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-received:
+		if event.Action != ActionPutManifest || event.Reference != "v1" || event.User != "alice" {
+			t.Errorf("posted event = %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not posted")
+	}
+}
+
+func TestWebhookSinkQueueFull(t *testing.T) {
+	posting := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case posting <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := NewWebhookSink(ctx, server.URL, DefaultWebhookTimeout)
+	// the first event blocks the webhook, the others fill the queue
+	if err := sink.Write(ctx, Event{Action: ActionPutBlob}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-posting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not posted")
+	}
+	start := time.Now()
+	for i := 0; i < webhookQueueSize; i++ {
+		if err := sink.Write(ctx, Event{Action: ActionPutBlob}); err != nil {
+			t.Fatalf("write %d into the queue: %v", i, err)
+		}
+	}
+	// dropped instead of blocking the request
+	if err := sink.Write(ctx, Event{Action: ActionPutBlob}); !errors.Is(err, ErrWebhookQueueFull) {
+		t.Errorf("write into the full queue error = %v, want %v", err, ErrWebhookQueueFull)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("writes blocked for %s", elapsed)
+	}
+}
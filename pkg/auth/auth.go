@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnauthenticated is returned by authenticators when the token is not accepted.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+type UserInfo struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+	// Scopes limit what the token can access, e.g. "project/*:writer", empty means not limited.
+	Scopes []string `json:"scopes,omitempty"`
+	// Robot accounts are authorized by their scopes only, never set by external authenticators.
+	Robot bool `json:"-"`
+}
+
+type TokenAuthenticator interface {
+	// Authenticate returns the user of token, or ErrUnauthenticated if the token is not accepted.
+	Authenticate(ctx context.Context, token string) (*UserInfo, error)
+}
+
+// Union tries authenticators in order and returns the first accepted user.
+func Union(authenticators ...TokenAuthenticator) TokenAuthenticator {
+	if len(authenticators) == 1 {
+		return authenticators[0]
+	}
+	return unionAuthenticator(authenticators)
+}
+
+type unionAuthenticator []TokenAuthenticator
+
+func (u unionAuthenticator) Authenticate(ctx context.Context, token string) (*UserInfo, error) {
+	var errs []error
+	for _, authenticator := range u {
+		user, err := authenticator.Authenticate(ctx, token)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrUnauthenticated) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, ErrUnauthenticated
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordAuthenticator interface {
+	// AuthenticatePassword returns the user of username and password, or ErrUnauthenticated if not accepted.
+	AuthenticatePassword(ctx context.Context, username, password string) (*UserInfo, error)
+}
+
+// HtpasswdCacheTTL is how long a verified password is cached, bcrypt is slow by design.
+const HtpasswdCacheTTL = 5 * time.Minute
+
+// HtpasswdAuthenticator authenticates users in a htpasswd file, only bcrypt hashes are supported.
+type HtpasswdAuthenticator struct {
+	hashes map[string][]byte
+
+	// verified caches the HMAC of passwords verified, keyed by a random key of the process,
+	// so the cache can not be used to guess passwords faster than bcrypt.
+	key      []byte
+	ttl      time.Duration
+	mu       sync.Mutex
+	verified map[string]htpasswdCacheEntry
+}
+
+type htpasswdCacheEntry struct {
+	mac     []byte
+	expires time.Time
+}
+
+func NewHtpasswdAuthenticator(file string) (*HtpasswdAuthenticator, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	a := &HtpasswdAuthenticator{
+		hashes:   map[string][]byte{},
+		key:      key,
+		ttl:      HtpasswdCacheTTL,
+		verified: map[string]htpasswdCacheEntry{},
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(text, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("htpasswd file %s: line %d: invalid entry", file, line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("htpasswd file %s: line %d: user %s: only bcrypt is supported", file, line, username)
+		}
+		a.hashes[username] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *HtpasswdAuthenticator) AuthenticatePassword(ctx context.Context, username, password string) (*UserInfo, error) {
+	hash, ok := a.hashes[username]
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(username + ":" + password))
+	sum := mac.Sum(nil)
+	now := time.Now()
+	a.mu.Lock()
+	verified, ok := a.verified[username]
+	a.mu.Unlock()
+	if ok && now.Before(verified.expires) && hmac.Equal(verified.mac, sum) {
+		return &UserInfo{Username: username}, nil
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	a.mu.Lock()
+	a.verified[username] = htpasswdCacheEntry{mac: sum, expires: now.Add(a.ttl)}
+	a.mu.Unlock()
+	return &UserInfo{Username: username}, nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestNewHtpasswdAuthenticator(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "bcrypt", content: "# users\n\nalice:" + string(hash) + "\n"},
+		{name: "md5 not supported", content: "alice:$apr1$salt$hash\n", wantErr: true},
+		{name: "sha1 not supported", content: "alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n", wantErr: true},
+		{name: "no hash", content: "alice\n", wantErr: true},
+		{name: "no username", content: ":" + string(hash) + "\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHtpasswdAuthenticator(writeTestFile(t, "htpasswd", tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewHtpasswdAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHtpasswdAuthenticatePassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewHtpasswdAuthenticator(writeTestFile(t, "htpasswd", "alice:"+string(hash)+"\nbob:"+string(hash)+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{name: "valid", username: "alice", password: "secret"},
+		// verified passwords are cached, the cache must not accept others
+		{name: "valid cached", username: "alice", password: "secret"},
+		{name: "wrong password after cached", username: "alice", password: "wrong", wantErr: true},
+		{name: "password of another user", username: "bob", password: "wrong", wantErr: true},
+		{name: "unknown user", username: "carol", password: "secret", wantErr: true},
+		{name: "empty password", username: "alice", password: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := a.AuthenticatePassword(context.Background(), tt.username, tt.password)
+			if tt.wantErr {
+				if err != ErrUnauthenticated {
+					t.Fatalf("AuthenticatePassword() error = %v, want unauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticatePassword() error = %v", err)
+			}
+			if user.Username != tt.username || len(user.Scopes) != 0 {
+				t.Errorf("AuthenticatePassword() = %+v, want %s without scopes", user, tt.username)
+			}
+		})
+	}
+}
+
+func TestHtpasswdAuthenticatePasswordCache(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewHtpasswdAuthenticator(writeTestFile(t, "htpasswd", "alice:"+string(hash)+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AuthenticatePassword(context.Background(), "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	unsalted := sha256.Sum256([]byte("secret"))
+	if entry := a.verified["alice"]; bytes.Equal(entry.mac, unsalted[:]) || entry.expires.IsZero() {
+		t.Errorf("cached %+v, want a keyed mac with expiry", entry)
+	}
+	// the password changed, a cached password is accepted until it expires
+	changed, _ := bcrypt.GenerateFromPassword([]byte("changed"), bcrypt.MinCost)
+	a.hashes["alice"] = changed
+	if _, err := a.AuthenticatePassword(context.Background(), "alice", "secret"); err != nil {
+		t.Errorf("AuthenticatePassword() of cached password error = %v", err)
+	}
+	entry := a.verified["alice"]
+	entry.expires = time.Now().Add(-time.Second)
+	a.verified["alice"] = entry
+	if _, err := a.AuthenticatePassword(context.Background(), "alice", "secret"); err != ErrUnauthenticated {
+		t.Errorf("AuthenticatePassword() of expired password error = %v, want unauthenticated", err)
+	}
+	// each process has its own key
+	other, _ := NewHtpasswdAuthenticator(writeTestFile(t, "htpasswd", "alice:"+string(hash)+"\n"))
+	if bytes.Equal(other.key, a.key) {
+		t.Errorf("processes share the cache key")
+	}
+}
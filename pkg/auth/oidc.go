@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// OIDCAuthenticator authenticates oidc id tokens issued by issuer.
+type OIDCAuthenticator struct {
+	verifier    *oidc.IDTokenVerifier
+	groupsClaim string
+}
+
+func NewOIDCAuthenticator(ctx context.Context, issuer string, groupsClaim string) (*OIDCAuthenticator, error) {
+	ctx = oidc.InsecureIssuerURLContext(ctx, issuer)
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	verifier := provider.Verifier(&oidc.Config{
+		SkipClientIDCheck: true,
+		SkipIssuerCheck:   true,
+	})
+	return &OIDCAuthenticator{verifier: verifier, groupsClaim: groupsClaim}, nil
+}
+
+func (a *OIDCAuthenticator) Authenticate(ctx context.Context, token string) (*UserInfo, error) {
+	idtoken, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	claims := map[string]any{}
+	if err := idtoken.Claims(&claims); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	return &UserInfo{Username: idtoken.Subject, Groups: groupsOfClaim(claims, a.groupsClaim)}, nil
+}
+
+// groupsOfClaim returns the groups in claim, the claim is a string or a list of strings.
+func groupsOfClaim(claims map[string]any, claim string) []string {
+	switch val := claims[claim].(type) {
+	case string:
+		return []string{val}
+	case []any:
+		groups := make([]string, 0, len(val))
+		for _, item := range val {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StaticTokenFile is the file of static tokens, one token per user.
+//
+//	tokens:
+//	  - token: "a-long-random-string"
+//	    username: alice
+//	    groups: ["ml-team"]
+//	    scopes: ["team/*:writer"]
+type StaticTokenFile struct {
+	Tokens []StaticToken `json:"tokens" yaml:"tokens"`
+}
+
+type StaticToken struct {
+	Token    string   `json:"token" yaml:"token"`
+	Username string   `json:"username" yaml:"username"`
+	Groups   []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Scopes   []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+}
+
+// StaticTokenAuthenticator authenticates tokens listed in a static token file.
+type StaticTokenAuthenticator struct {
+	// users keyed by the hash of token
+	users map[[sha256.Size]byte]*UserInfo
+}
+
+func NewStaticTokenAuthenticator(file string) (*StaticTokenAuthenticator, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tokens := StaticTokenFile{}
+	if err := yaml.Unmarshal(content, &tokens); err != nil {
+		return nil, fmt.Errorf("parse token file %s: %w", file, err)
+	}
+	a := &StaticTokenAuthenticator{users: map[[sha256.Size]byte]*UserInfo{}}
+	usernames := map[string]bool{}
+	for i, token := range tokens.Tokens {
+		if token.Token == "" || token.Username == "" {
+			return nil, fmt.Errorf("token file %s: token %d: token and username are required", file, i)
+		}
+		if usernames[token.Username] {
+			return nil, fmt.Errorf("token file %s: duplicated user %s", file, token.Username)
+		}
+		usernames[token.Username] = true
+		a.users[sha256.Sum256([]byte(token.Token))] = &UserInfo{
+			Username: token.Username,
+			Groups:   token.Groups,
+			Scopes:   token.Scopes,
+		}
+	}
+	return a, nil
+}
+
+func (a *StaticTokenAuthenticator) Authenticate(ctx context.Context, token string) (*UserInfo, error) {
+	// compare hashes, so the lookup takes no hints of the tokens
+	if user, ok := a.users[sha256.Sum256([]byte(token))]; ok {
+		return user, nil
+	}
+	return nil, ErrUnauthenticated
+}
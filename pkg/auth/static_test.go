@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStaticTokenAuthenticator(t *testing.T) {
+	valid := `
+tokens:
+  - token: alice-token
+    username: alice
+    groups: ["ml-team"]
+    scopes: ["team/*:writer"]
+  - token: bob-token
+    username: bob
+`
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: valid},
+		{name: "no token", content: "tokens:\n  - username: alice\n", wantErr: true},
+		{name: "no username", content: "tokens:\n  - token: t\n", wantErr: true},
+		{name: "duplicated user", content: "tokens:\n  - {token: a, username: alice}\n  - {token: b, username: alice}\n", wantErr: true},
+		{name: "invalid yaml", content: "tokens: [", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStaticTokenAuthenticator(writeTestFile(t, "tokens.yaml", tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewStaticTokenAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	a, err := NewStaticTokenAuthenticator(writeTestFile(t, "tokens.yaml", valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := a.Authenticate(context.Background(), "alice-token")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if user.Username != "alice" || len(user.Groups) != 1 || len(user.Scopes) != 1 {
+		t.Errorf("Authenticate() = %+v, want alice with groups and scopes", user)
+	}
+	for _, token := range []string{"unknown", "alice", ""} {
+		if _, err := a.Authenticate(context.Background(), token); err != ErrUnauthenticated {
+			t.Errorf("Authenticate(%q) error = %v, want unauthenticated", token, err)
+		}
+	}
+}
@@ -1 +1,142 @@
 package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWebhookCacheTTL         = 5 * time.Minute
+	DefaultWebhookNegativeCacheTTL = 30 * time.Second
+	DefaultWebhookTimeout          = 10 * time.Second
+
+	// webhookCachePruneSize is the cache size to start removing expired entries.
+	webhookCachePruneSize = 1024
+)
+
+// TokenReviewRequest is posted to the webhook to review a bearer token.
+type TokenReviewRequest struct {
+	Token string `json:"token"`
+}
+
+// TokenReviewResponse is the review result responded by the webhook.
+type TokenReviewResponse struct {
+	Authenticated bool     `json:"authenticated"`
+	User          UserInfo `json:"user,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// WebhookAuthenticator authenticates tokens by posting them to a token review webhook,
+// the results are cached by the hash of token.
+type WebhookAuthenticator struct {
+	URL    string
+	Client *http.Client
+	// TTL is how long an accepted token is cached.
+	TTL time.Duration
+	// NegativeTTL is how long a rejected token is cached.
+	NegativeTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]webhookCacheEntry
+}
+
+type webhookCacheEntry struct {
+	user    *UserInfo
+	expires time.Time
+}
+
+func NewWebhookAuthenticator(url string, timeout, ttl, negativeTTL time.Duration) *WebhookAuthenticator {
+	return &WebhookAuthenticator{
+		URL:         url,
+		Client:      &http.Client{Timeout: timeout},
+		TTL:         ttl,
+		NegativeTTL: negativeTTL,
+		cache:       map[string]webhookCacheEntry{},
+	}
+}
+
+func (a *WebhookAuthenticator) Authenticate(ctx context.Context, token string) (*UserInfo, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	if entry, ok := a.cached(key); ok {
+		if entry.user == nil {
+			return nil, ErrUnauthenticated
+		}
+		return entry.user, nil
+	}
+	review, err := a.review(ctx, token)
+	if err != nil {
+		// not cached, the webhook may recover
+		return nil, err
+	}
+	if !review.Authenticated || review.User.Username == "" {
+		a.store(key, nil, a.NegativeTTL)
+		return nil, ErrUnauthenticated
+	}
+	user := review.User
+	a.store(key, &user, a.TTL)
+	return &user, nil
+}
+
+func (a *WebhookAuthenticator) review(ctx context.Context, token string) (*TokenReviewResponse, error) {
+	body, err := json.Marshal(TokenReviewRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token review: %w", err)
+	}
+	defer resp.Body.Close()
+	// the webhook rejects tokens with 401 or 403 too
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return &TokenReviewResponse{Authenticated: false}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token review: unexpected status %s", resp.Status)
+	}
+	review := &TokenReviewResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(review); err != nil {
+		return nil, fmt.Errorf("token review: decode response: %w", err)
+	}
+	return review, nil
+}
+
+func (a *WebhookAuthenticator) cached(key string) (webhookCacheEntry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return webhookCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (a *WebhookAuthenticator) store(key string, user *UserInfo, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if len(a.cache) >= webhookCachePruneSize {
+		for k, entry := range a.cache {
+			if now.After(entry.expires) {
+				delete(a.cache, k)
+			}
+		}
+	}
+	a.cache[key] = webhookCacheEntry{user: user, expires: now.Add(ttl)}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTokenReview responds the token reviews by the token, and counts the requests of each token.
+type fakeTokenReview struct {
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (f *fakeTokenReview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review := TokenReviewRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests[review.Token]++
+	f.mu.Unlock()
+	switch review.Token {
+	case "alice":
+		w.Write([]byte(`{"authenticated":true,"user":{"username":"alice","groups":["ml-team"],"scopes":["team/*:writer"]}}`))
+	case "robot":
+		// robot can not be set by webhooks
+		w.Write([]byte(`{"authenticated":true,"user":{"username":"robot$ci","robot":true}}`))
+	case "rejected":
+		w.Write([]byte(`{"authenticated":false,"error":"token expired"}`))
+	case "no-username":
+		w.Write([]byte(`{"authenticated":true,"user":{}}`))
+	case "forbidden":
+		w.WriteHeader(http.StatusForbidden)
+	case "unavailable":
+		w.WriteHeader(http.StatusServiceUnavailable)
+	default:
+		w.Write([]byte(`not json`))
+	}
+}
+
+func (f *fakeTokenReview) count(token string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[token]
+}
+
+func TestWebhookAuthenticator(t *testing.T) {
+	fake := &fakeTokenReview{requests: map[string]int{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	a := NewWebhookAuthenticator(server.URL, time.Second, time.Minute, time.Minute)
+
+	tests := []struct {
+		token        string
+		wantUser     string
+		wantErr      error // ErrUnauthenticated or any other error if not nil
+		wantRequests int   // after authenticated twice
+	}{
+		{token: "alice", wantUser: "alice", wantRequests: 1},
+		{token: "robot", wantUser: "robot$ci", wantRequests: 1},
+		{token: "rejected", wantErr: ErrUnauthenticated, wantRequests: 1},
+		{token: "no-username", wantErr: ErrUnauthenticated, wantRequests: 1},
+		{token: "forbidden", wantErr: ErrUnauthenticated, wantRequests: 1},
+		// failures of the webhook are not cached
+		{token: "unavailable", wantErr: errors.New("unexpected status"), wantRequests: 2},
+		{token: "malformed", wantErr: errors.New("decode response"), wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				user, err := a.Authenticate(context.Background(), tt.token)
+				switch {
+				case tt.wantErr == nil:
+					if err != nil {
+						t.Fatalf("Authenticate() error = %v", err)
+					}
+					if user.Username != tt.wantUser || user.Robot {
+						t.Fatalf("Authenticate() = %+v, want user %s not robot", user, tt.wantUser)
+					}
+				case tt.wantErr == ErrUnauthenticated:
+					if err != ErrUnauthenticated {
+						t.Fatalf("Authenticate() error = %v, want unauthenticated", err)
+					}
+				default:
+					if err == nil || err == ErrUnauthenticated {
+						t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+					}
+				}
+			}
+			if n := fake.count(tt.token); n != tt.wantRequests {
+				t.Errorf("webhook requests = %d, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+
+	user, _ := a.Authenticate(context.Background(), "alice")
+	if len(user.Groups) != 1 || user.Groups[0] != "ml-team" || len(user.Scopes) != 1 || user.Scopes[0] != "team/*:writer" {
+		t.Errorf("Authenticate() = %+v, want groups and scopes of the review", user)
+	}
+	// the cache is keyed by the hash of token
+	for key := range a.cache {
+		if key == "alice" {
+			t.Errorf("token cached in plain text")
+		}
+	}
+}
+
+func TestWebhookAuthenticatorCacheTTL(t *testing.T) {
+	fake := &fakeTokenReview{requests: map[string]int{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		negativeTTL  time.Duration
+		token        string
+		wantRequests int
+	}{
+		{name: "accepted cached", ttl: time.Minute, token: "alice", wantRequests: 1},
+		{name: "accepted expired", ttl: time.Nanosecond, token: "alice", wantRequests: 2},
+		{name: "accepted not cached", token: "alice", wantRequests: 2},
+		{name: "rejected cached", negativeTTL: time.Minute, token: "rejected", wantRequests: 1},
+		{name: "rejected not cached", ttl: time.Minute, token: "rejected", wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.mu.Lock()
+			fake.requests = map[string]int{}
+			fake.mu.Unlock()
+			a := NewWebhookAuthenticator(server.URL, time.Second, tt.ttl, tt.negativeTTL)
+			for i := 0; i < 2; i++ {
+				_, _ = a.Authenticate(context.Background(), tt.token)
+				time.Sleep(time.Millisecond)
+			}
+			if n := fake.count(tt.token); n != tt.wantRequests {
+				t.Errorf("webhook requests = %d, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
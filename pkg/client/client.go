@@ -9,17 +9,30 @@ import (
 type Client struct {
 	Remote    *RegistryClient
 	Extension Extension
+
+	// DownloadPartSize is the size of each part when downloading a large blob in parallel.
+	DownloadPartSize int64
+	// DownloadConcurrency is the number of parts downloaded at the same time, 1 disables parallel download.
+	DownloadConcurrency int
+	// MountFrom are the repositories in the same registry may have the blobs to push,
+	// blobs are mounted from them instead of uploading if possible.
+	MountFrom []string
+	// Annotations are set on the manifests pushed.
+	Annotations map[string]string
 }
 
 func NewClient(registry string, auth string) *Client {
 	return &Client{
 		Remote:    NewRegistryClient(registry, auth),
 		Extension: NewDelegateExtension(),
+
+		DownloadPartSize:    DefaultDownloadPartSize,
+		DownloadConcurrency: DownloadPartConcurrency,
 	}
 }
 
 func (c Client) Ping(ctx context.Context) error {
-	if _, err := c.Remote.GetGlobalIndex(ctx, ""); err != nil {
+	if _, err := c.Remote.GetGlobalIndex(ctx, types.IndexListOptions{Limit: 1}); err != nil {
 		return err
 	}
 	return nil
@@ -33,10 +46,42 @@ func (c Client) PutManifest(ctx context.Context, repo, version string, manifest
 	return c.Remote.PutManifest(ctx, repo, version, manifest)
 }
 
-func (c Client) GetIndex(ctx context.Context, repo string, search string) (*types.Index, error) {
-	return c.Remote.GetIndex(ctx, repo, search)
+func (c Client) GetIndex(ctx context.Context, repo string, options types.IndexListOptions) (*types.Index, error) {
+	return c.Remote.GetIndex(ctx, repo, options)
 }
 
-func (c Client) GetGlobalIndex(ctx context.Context, search string) (*types.Index, error) {
-	return c.Remote.GetGlobalIndex(ctx, search)
+func (c Client) GetGlobalIndex(ctx context.Context, options types.IndexListOptions) (*types.Index, error) {
+	return c.Remote.GetGlobalIndex(ctx, options)
+}
+
+// WalkIndex calls fn with each page of the versions of repo, the next page is requested after fn returns.
+func (c Client) WalkIndex(ctx context.Context, repo string, options types.IndexListOptions, fn func(page []types.Descriptor) error) error {
+	return walkIndexPages(options, func(options types.IndexListOptions) (*types.Index, error) {
+		return c.Remote.GetIndex(ctx, repo, options)
+	}, fn)
+}
+
+// WalkGlobalIndex calls fn with each page of the repositories, the next page is requested after fn returns.
+func (c Client) WalkGlobalIndex(ctx context.Context, options types.IndexListOptions, fn func(page []types.Descriptor) error) error {
+	return walkIndexPages(options, func(options types.IndexListOptions) (*types.Index, error) {
+		return c.Remote.GetGlobalIndex(ctx, options)
+	}, fn)
+}
+
+func walkIndexPages(options types.IndexListOptions,
+	get func(options types.IndexListOptions) (*types.Index, error), fn func(page []types.Descriptor) error,
+) error {
+	for {
+		index, err := get(options)
+		if err != nil {
+			return err
+		}
+		if err := fn(index.Manifests); err != nil {
+			return err
+		}
+		if index.Continue == "" {
+			return nil
+		}
+		options.Continue = index.Continue
+	}
 }
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/sync/errgroup"
+	"kubegems.io/modelx/pkg/types"
+)
+
+const (
+	DefaultDownloadPartSize = 64 << 20 // 64MiB
+	DownloadRetries         = 3
+)
+
+// RangeDownloadFunc downloads length bytes of a blob start from offset into w.
+type RangeDownloadFunc func(ctx context.Context, offset, length int64, into io.Writer) error
+
+// ParallelDownload downloads range [offset, total) in parts of partsize with concurrency parallel requests,
+// each part is written into its own offset of into.
+// it returns the end of the contiguous downloaded content from offset,
+// so the caller can resume from there when an error occurs.
+func ParallelDownload(ctx context.Context, fn RangeDownloadFunc, into io.WriterAt, offset, total, partsize int64, concurrency int) (int64, error) {
+	if partsize <= 0 {
+		partsize = DefaultDownloadPartSize
+	}
+	if concurrency <= 0 {
+		concurrency = DownloadPartConcurrency
+	}
+	parts := []PartRange{}
+	for start := offset; start < total; start += partsize {
+		length := partsize
+		if start+length > total {
+			length = total - start
+		}
+		parts = append(parts, PartRange{offset: start, length: length, w: into})
+	}
+
+	done := make([]bool, len(parts))
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(concurrency)
+	for i := range parts {
+		i, part := i, parts[i]
+		eg.Go(func() error {
+			err := retry(ctx, DownloadRetries, func() error {
+				return fn(ctx, part.offset, part.length, io.NewOffsetWriter(part.w, part.offset))
+			})
+			if err != nil {
+				return err
+			}
+			done[i] = true
+			return nil
+		})
+	}
+	err := eg.Wait()
+
+	end := offset
+	for i, part := range parts {
+		if !done[i] {
+			break
+		}
+		end = part.offset + part.length
+	}
+	return end, err
+}
+
+// PullBlobParallel pulls the blob from offset to the end in parallel ranged requests,
+// it returns the end of the contiguous downloaded content, see ParallelDownload.
+func (c Client) PullBlobParallel(ctx context.Context, repo string, desc types.Descriptor, offset int64, into io.WriterAt) (int64, error) {
+	var fn RangeDownloadFunc
+	location, err := c.Remote.GetBlobLocation(ctx, repo, desc, types.BlobLocationPurposeDownload)
+	if err != nil {
+		if !IsServerUnsupportError(err) {
+			return offset, err
+		}
+		fn = func(ctx context.Context, offset, length int64, into io.Writer) error {
+			return c.Remote.GetBlobContentRange(ctx, repo, desc.Digest, offset, length, into)
+		}
+	} else {
+		fn = func(ctx context.Context, offset, length int64, into io.Writer) error {
+			return c.Extension.DownloadRange(ctx, desc, *location, offset, length, into)
+		}
+	}
+	return ParallelDownload(ctx, fn, into, offset, desc.Size, c.DownloadPartSize, c.DownloadConcurrency)
+}
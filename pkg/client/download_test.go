@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"kubegems.io/modelx/pkg/client/progress"
+)
+
+const testBlobContent = "0123456789abcdefghij"
+
+// rangeServer serves ranges of testBlobContent, failing the requests of part at failAt for failures times.
+type rangeServer struct {
+	mu       sync.Mutex
+	failAt   int64
+	failures int
+	requests []int64
+}
+
+func (s *rangeServer) download(ctx context.Context, offset, length int64, into io.Writer) error {
+	s.mu.Lock()
+	s.requests = append(s.requests, offset)
+	fail := offset == s.failAt && s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.mu.Unlock()
+	if fail {
+		// a broken response may have written a part of the content
+		_, _ = into.Write([]byte("xx"))
+		return errors.New("connection reset")
+	}
+	_, err := into.Write([]byte(testBlobContent[offset : offset+length]))
+	return err
+}
+
+func TestParallelDownload(t *testing.T) {
+	tests := []struct {
+		name         string
+		offset       int64
+		failAt       int64
+		failures     int
+		wantEnd      int64
+		wantErr      bool
+		wantRequests int
+	}{
+		{name: "all parts", failAt: -1, wantEnd: 20, wantRequests: 5},
+		{name: "resume from offset", offset: 8, failAt: -1, wantEnd: 20, wantRequests: 3},
+		{name: "resume from unaligned offset", offset: 6, failAt: -1, wantEnd: 20, wantRequests: 4},
+		{name: "failure retried", failAt: 8, failures: 1, wantEnd: 20, wantRequests: 6},
+		{name: "failed part", failAt: 8, failures: DownloadRetries, wantEnd: 8, wantErr: true},
+		{name: "first part failed", failAt: 0, failures: DownloadRetries, wantEnd: 0, wantErr: true},
+		{name: "failed part after resume", offset: 4, failAt: 12, failures: DownloadRetries, wantEnd: 12, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "blob"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			// content before offset is downloaded before
+			if _, err := f.WriteAt([]byte(testBlobContent[:tt.offset]), 0); err != nil {
+				t.Fatal(err)
+			}
+			// written through the progress bar as pull does, parts write it concurrently
+			bar := &progress.Bar{}
+			into := bar.WrapWriter(f, "blob", int64(len(testBlobContent)), "downloading").(io.WriterAt)
+
+			server := &rangeServer{failAt: tt.failAt, failures: tt.failures}
+			end, err := ParallelDownload(context.Background(), server.download, into, tt.offset, int64(len(testBlobContent)), 4, 4)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParallelDownload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if end != tt.wantEnd {
+				t.Fatalf("ParallelDownload() end = %d, want %d", end, tt.wantEnd)
+			}
+			for _, offset := range server.requests {
+				if offset < tt.offset {
+					t.Errorf("requested offset %d before resumed offset %d", offset, tt.offset)
+				}
+			}
+			if !tt.wantErr && len(server.requests) != tt.wantRequests {
+				t.Errorf("requests = %v, want %d requests", server.requests, tt.wantRequests)
+			}
+			content := make([]byte, end)
+			if _, err := f.ReadAt(content, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, []byte(testBlobContent[:end])) {
+				t.Errorf("content to end = %q, want %q", content, testBlobContent[:end])
+			}
+		})
+	}
+}
@@ -15,6 +15,8 @@ var GlobalExtensions = map[string]Extension{}
 
 type Extension interface {
 	Download(ctx context.Context, blob types.Descriptor, location types.BlobLocation, into io.Writer) error
+	// DownloadRange downloads length bytes of blob start from offset, length -1 means to the end.
+	DownloadRange(ctx context.Context, blob types.Descriptor, location types.BlobLocation, offset, length int64, into io.Writer) error
 	Upload(ctx context.Context, blob DescriptorWithContent, location types.BlobLocation) error
 }
 
@@ -40,6 +42,19 @@ func (e DelegateExtension) Download(ctx context.Context, blob types.Descriptor,
 	return errors.NewUnsupportedError("provider: " + location.Provider)
 }
 
+func (e DelegateExtension) DownloadRange(ctx context.Context, blob types.Descriptor, location types.BlobLocation, offset, length int64, into io.Writer) error {
+	log := logr.FromContextOrDiscard(ctx).WithValues(
+		"provider", location.Provider,
+		"offset", offset,
+		"length", length)
+	log.Info("extend downloading blob range")
+
+	if ext, ok := e.Extensions[location.Provider]; ok {
+		return ext.DownloadRange(ctx, blob, location, offset, length, into)
+	}
+	return errors.NewUnsupportedError("provider: " + location.Provider)
+}
+
 func (e DelegateExtension) Upload(ctx context.Context, blob DescriptorWithContent, location types.BlobLocation) error {
 	log := logr.FromContextOrDiscard(ctx).WithValues(
 		"provider", location.Provider,
@@ -75,7 +90,9 @@ func (t *RegistryClient) extrequest(ctx context.Context, method, url string, hea
 		},
 	}
 
+	req, span := traceRequest(req, true)
 	resp, err := norediretccli.Do(req)
+	endRequestSpan(span, resp, err)
 	if err != nil {
 		return nil, err
 	}
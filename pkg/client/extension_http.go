@@ -2,13 +2,22 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 )
 
+// ErrRangeNotSupported is returned when a range is requested but the server responds the whole content.
+var ErrRangeNotSupported = errors.New("range request not supported")
+
 func HTTPDownload(ctx context.Context, location *url.URL, header http.Header, into io.Writer) error {
+	return HTTPDownloadRange(ctx, location, header, 0, -1, into)
+}
+
+// HTTPDownloadRange downloads length bytes start from offset, length -1 means to the end.
+func HTTPDownloadRange(ctx context.Context, location *url.URL, header http.Header, offset, length int64, into io.Writer) (err error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", location.String(), nil)
 	if err != nil {
 		return err
@@ -17,18 +26,54 @@ func HTTPDownload(ctx context.Context, location *url.URL, header http.Header, in
 	for k, v := range header {
 		req.Header[k] = v
 	}
-	resp, err := http.DefaultClient.Do(req)
+	if rangeHeader := RangeHeader(offset, length); rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	// the span covers the transfer of content
+	var resp *http.Response
+	req, span := traceRequest(req, false)
+	defer func() { endRequestSpan(span, resp, err) }()
+
+	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != http.StatusOK {
+	defer resp.Body.Close()
+	return copyRangeResponse(resp, offset, length, into)
+}
+
+// RangeHeader returns the Range header value, empty if the whole content is requested.
+func RangeHeader(offset, length int64) string {
+	switch {
+	case length >= 0:
+		return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	case offset > 0:
+		return fmt.Sprintf("bytes=%d-", offset)
+	default:
+		return ""
+	}
+}
+
+func copyRangeResponse(resp *http.Response, offset, length int64, into io.Writer) error {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server ignores range, it's fine if the range starts from 0
+		if offset > 0 {
+			return ErrRangeNotSupported
+		}
+	default:
 		return fmt.Errorf("unexpected status: %s", resp.Status)
 	}
-	_, err = io.Copy(into, resp.Body)
+	if length >= 0 {
+		_, err := io.CopyN(into, resp.Body, length)
+		return err
+	}
+	_, err := io.Copy(into, resp.Body)
 	return err
 }
 
-func HTTPUpload(ctx context.Context, location *url.URL, header http.Header, contentlen int64, getbody func() (io.ReadCloser, error)) error {
+func HTTPUpload(ctx context.Context, location *url.URL, header http.Header, contentlen int64, getbody func() (io.ReadCloser, error)) (err error) {
 	method := http.MethodPost
 	// s3 upload use PUT
 	if location.Query().Has("X-Amz-Credential") {
@@ -49,7 +94,11 @@ func HTTPUpload(ctx context.Context, location *url.URL, header http.Header, cont
 	}
 	req.ContentLength, req.GetBody = contentlen, getbody
 
-	resp, err := http.DefaultClient.Do(req)
+	var resp *http.Response
+	req, span := traceRequest(req, false)
+	defer func() { endRequestSpan(span, resp, err) }()
+
+	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -17,11 +17,16 @@ func init() {
 const (
 	UploadPartConcurrency   = 3
 	DownloadPartConcurrency = 3
+	UploadRetries           = 3
 )
 
 type S3Extension struct{}
 
 func (e S3Extension) Download(ctx context.Context, blob types.Descriptor, location types.BlobLocation, into io.Writer) error {
+	return e.DownloadRange(ctx, blob, location, 0, -1, into)
+}
+
+func (e S3Extension) DownloadRange(ctx context.Context, blob types.Descriptor, location types.BlobLocation, offset, length int64, into io.Writer) error {
 	var properties S3Properties
 	convertProperties(&properties, location.Properties)
 
@@ -33,7 +38,7 @@ func (e S3Extension) Download(ctx context.Context, blob types.Descriptor, locati
 	if err != nil {
 		return err
 	}
-	return HTTPDownload(ctx, u, firstpart.SignedHeader, into)
+	return HTTPDownloadRange(ctx, u, firstpart.SignedHeader, offset, length, into)
 }
 
 type S3Properties struct {
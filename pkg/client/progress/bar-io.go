@@ -36,8 +36,10 @@ type barr struct {
 }
 
 func (r *barr) Seek(offset int64, whence int) (int64, error) {
-	r.fragment.Processed = 0 // reset processed
 	n, err := r.rc.Seek(offset, whence)
+
+	r.b.mu.Lock()
+	r.fragment.Processed = 0 // reset processed
 	if err != nil {
 		r.b.Status = "failed"
 		r.b.Done = true
@@ -50,19 +52,18 @@ func (r *barr) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekEnd:
 		r.fragment.Offset = r.b.Total - n
 	}
-	r.b.mp.haschange = true
+	r.b.mu.Unlock()
+	r.b.Notify()
 	return n, err
 }
 
 func (r *barr) Read(p []byte) (int, error) {
 	n, err := r.rc.Read(p)
 	if err != nil && err != io.EOF {
-		r.b.Status = "failed"
-		r.b.Done = true
 		r.haserr = true
+		r.b.fail()
 	}
-	r.fragment.Processed += int64(n)
-	r.b.mp.haschange = true
+	r.b.process(r.fragment, n)
 	return n, err
 }
 
@@ -111,12 +112,10 @@ type barw struct {
 func (r *barw) Write(p []byte) (int, error) {
 	n, err := r.wc.Write(p)
 	if err != nil && err != io.EOF {
-		r.b.Done = true
-		r.b.Status = "failed"
 		r.haserr = true
+		r.b.fail()
 	}
-	r.fragment.Processed += int64(n)
-	r.b.mp.haschange = true
+	r.b.process(r.fragment, n)
 	return n, err
 }
 
@@ -129,6 +128,7 @@ func (r *barw) Close() error {
 	return r.wc.Close()
 }
 
+// barwa is safe for concurrent WriteAt calls, as parallel range downloads do.
 type barwa struct {
 	*barw
 }
@@ -140,12 +140,9 @@ func (r barwa) WriteAt(p []byte, off int64) (int, error) {
 	}
 	n, err := wat.WriteAt(p, off)
 	if err != nil {
-		r.b.Done = true
-		r.b.Status = "failed"
-		r.b.mp.haschange = true
+		r.b.fail()
 		return n, err
 	}
-	r.fragment.Processed += int64(n)
-	r.b.mp.haschange = true
+	r.b.process(r.fragment, n)
 	return n, nil
 }
@@ -35,27 +35,45 @@ type BarFragment struct {
 }
 
 func (b *Bar) SetNameStatus(name, status string, done bool) {
+	b.mu.Lock()
 	b.Name, b.Status, b.Done = name, status, done
+	b.mu.Unlock()
 	b.Notify()
 }
 
 func (b *Bar) SetStatus(status string, done bool) {
+	b.mu.Lock()
 	b.Status = status
 	b.Done = done
+	b.mu.Unlock()
 	b.Notify()
 }
 
 func (b *Bar) SetDone() {
+	b.mu.Lock()
 	b.Done = true
+	b.mu.Unlock()
 	b.Notify()
 }
 
 func (r *Bar) Notify() {
 	if r.mp != nil {
-		r.mp.haschange = true
+		r.mp.haschange.Store(true)
 	}
 }
 
+// process adds n bytes processed to fragment f, it may be called concurrently.
+func (b *Bar) process(f *BarFragment, n int) {
+	b.mu.Lock()
+	f.Processed += int64(n)
+	b.mu.Unlock()
+	b.Notify()
+}
+
+func (b *Bar) fail() {
+	b.SetStatus("failed", true)
+}
+
 func (b *Bar) Print(w io.Writer) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -104,7 +122,7 @@ func (b *Bar) Print(w io.Writer) {
 	}
 	showname := b.Name
 	if len(b.Name) > b.MaxNameLen {
-		b.mp.haschange = true // force print
+		b.mp.haschange.Store(true) // force print
 		fullname := b.Name + "  "
 		lowptr := b.nameindex % len(fullname)
 		maxptr := lowptr + b.MaxNameLen
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -21,7 +22,7 @@ type MultiBar struct {
 	bars            []*Bar
 	barslock        sync.Mutex
 	eg              *errgroup.Group
-	haschange       bool // state machine to reduce print
+	haschange       atomic.Bool // state machine to reduce print
 }
 
 func NewMuiltiBarContext(ctx context.Context, dest io.Writer, width int, concurent int) (*MultiBar, context.Context) {
@@ -84,8 +85,7 @@ func (m *MultiBar) run(ctx context.Context) {
 			m.print()
 			return
 		case <-t.C:
-			if m.haschange {
-				m.haschange = false
+			if m.haschange.Swap(false) {
 				m.print()
 			}
 		}
@@ -107,14 +107,15 @@ func (m *MultiBar) Go(name string, initstatus string, fun func(b *Bar) error) {
 
 	m.eg.Go(func() error {
 		if err := fun(bar); err != nil {
+			bar.mu.Lock()
 			bar.Status = "failed"
+			bar.mu.Unlock()
 			bar.Notify()
 			// cancel all other bars
 			m.cancel()
 			return err
 		}
-		bar.Done = true
-		bar.Notify()
+		bar.SetDone()
 		return nil
 	})
 }
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	stderrors "errors"
 	"fmt"
 	"io"
@@ -10,13 +11,18 @@ import (
 	"path/filepath"
 
 	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 	"kubegems.io/modelx/pkg/client/progress"
 	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/tracing"
 	"kubegems.io/modelx/pkg/types"
 )
 
-func (c Client) Pull(ctx context.Context, repo string, version string, into string) error {
+func (c Client) Pull(ctx context.Context, repo string, version string, into string) (err error) {
+	ctx, span := tracing.Start(ctx, "Pull", attribute.String("modelx.repository", repo), attribute.String("modelx.version", version))
+	defer func() { tracing.End(span, err) }()
+
 	// check if the directory exists and is empty
 	if dirInfo, err := os.Stat(into); err != nil {
 		if !os.IsNotExist(err) {
@@ -35,7 +41,45 @@ func (c Client) Pull(ctx context.Context, repo string, version string, into stri
 	if err != nil {
 		return err
 	}
-	return c.PullBlobs(ctx, repo, into, append(manifest.Blobs, manifest.Config))
+	if err := c.PullBlobs(ctx, repo, into, append(manifest.Blobs, manifest.Config)); err != nil {
+		return err
+	}
+	return WriteOrigin(into, Origin{Registry: c.Remote.Registry, Repository: repo, Version: version})
+}
+
+// Origin records where a model directory pulled from.
+type Origin struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Version    string `json:"version,omitempty"`
+}
+
+func OriginFilename(basedir string) string {
+	return filepath.Join(basedir, ".modelx", "origin.json")
+}
+
+func WriteOrigin(basedir string, origin Origin) error {
+	content, err := json.Marshal(origin)
+	if err != nil {
+		return err
+	}
+	filename := OriginFilename(basedir)
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, content, 0o644)
+}
+
+func ReadOrigin(basedir string) (*Origin, error) {
+	content, err := os.ReadFile(OriginFilename(basedir))
+	if err != nil {
+		return nil, err
+	}
+	origin := &Origin{}
+	if err := json.Unmarshal(content, origin); err != nil {
+		return nil, err
+	}
+	return origin, nil
 }
 
 func (c Client) PullBlobs(ctx context.Context, repo string, basedir string, blobs []types.Descriptor) error {
@@ -49,7 +93,10 @@ func (c Client) PullBlobs(ctx context.Context, repo string, basedir string, blob
 	return mb.Wait()
 }
 
-func (c Client) pullBlobProgress(ctx context.Context, repo string, desc types.Descriptor, basedir string, bar *progress.Bar) error {
+func (c Client) pullBlobProgress(ctx context.Context, repo string, desc types.Descriptor, basedir string, bar *progress.Bar) (err error) {
+	ctx, span := tracing.Start(ctx, "PullBlob", blobAttrs(repo, desc)...)
+	defer func() { tracing.End(span, err) }()
+
 	switch desc.MediaType {
 	case MediaTypeModelDirectoryTarGz:
 		return c.pullDirectory(ctx, repo, desc, basedir, bar, true)
@@ -126,20 +173,108 @@ func (c Client) pullFile(ctx context.Context, repo string, desc types.Descriptor
 		return err
 	}
 
-	f, err := OpenWriteFile(filename, desc.Mode.Perm())
+	if desc.Digest == EmptyFileDigiest {
+		f, err := OpenWriteFile(filename, desc.Mode.Perm())
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	if err := c.pullBlobToFile(ctx, repo, desc, basedir, filename, bar); err != nil {
+		return err
+	}
+	bar.SetStatus("done", true)
+	return nil
+}
+
+// PartialFilename returns the side file to keep the partially downloaded blob.
+func PartialFilename(basedir string, desc types.Descriptor) string {
+	return filepath.Join(basedir, ".modelx", "partial", desc.Digest.Encoded())
+}
+
+// pullBlobToFile downloads the blob into a partial file then moves it to filename once the digest verified.
+// a partial file left by an interrupted pull is resumed from its length.
+func (c Client) pullBlobToFile(ctx context.Context, repo string, desc types.Descriptor, basedir, filename string, bar *progress.Bar) error {
+	partial := PartialFilename(basedir, desc)
+	if err := os.MkdirAll(filepath.Dir(partial), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	if desc.Digest == EmptyFileDigiest {
-		return nil
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := fi.Size()
+	if offset > desc.Size {
+		offset = 0
+	}
+	if offset < desc.Size {
+		if err := resetFile(f, offset); err != nil {
+			return err
+		}
+		w := bar.WrapWriter(f, desc.Digest.Hex()[:8], desc.Size, "downloading")
+		var err error
+		if wat, ok := w.(io.WriterAt); ok && c.DownloadConcurrency > 1 && desc.Size-offset > c.DownloadPartSize {
+			var end int64
+			end, err = c.PullBlobParallel(ctx, repo, desc, offset, wat)
+			if err != nil && !stderrors.Is(err, ErrRangeNotSupported) {
+				// keep only the contiguous downloaded content, so the next pull resumes from there
+				_ = f.Truncate(end)
+				return err
+			}
+		} else {
+			err = c.PullBlobRange(ctx, repo, desc, offset, -1, w)
+		}
+		if stderrors.Is(err, ErrRangeNotSupported) {
+			if err := resetFile(f, 0); err != nil {
+				return err
+			}
+			err = c.PullBlobRange(ctx, repo, desc, 0, -1, w)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	w := bar.WrapWriter(f, desc.Digest.Hex()[:8], desc.Size, "downloading")
-	if err := c.PullBlob(ctx, repo, desc, w); err != nil {
+
+	// verify
+	bar.SetStatus("verifying", false)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
-	bar.SetStatus("done", true)
-	return nil
+	verifier := desc.Digest.Verifier()
+	if _, err := io.Copy(verifier, f); err != nil {
+		return err
+	}
+	_ = f.Close()
+	if !verifier.Verified() {
+		os.Remove(partial)
+		return fmt.Errorf("digest mismatch of %s, expected %s", desc.Name, desc.Digest)
+	}
+	perm := desc.Mode.Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	if err := os.Chmod(partial, perm); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(partial, filename)
+}
+
+// resetFile truncates the file to size and moves the offset to the end.
+func resetFile(f *os.File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	_, err := f.Seek(size, io.SeekStart)
+	return err
 }
 
 func (c Client) pullDirectory(ctx context.Context, repo string, desc types.Descriptor, basedir string, bar *progress.Bar, useCache bool) error {
@@ -157,17 +292,9 @@ func (c Client) pullDirectory(ctx context.Context, repo string, desc types.Descr
 	// pull to cache
 	if useCache {
 		cache := filepath.Join(basedir, ".modelx", desc.Name+".tar.gz")
-		wf, err := OpenWriteFile(cache, desc.Mode)
-		if err != nil {
+		if err := c.pullBlobToFile(ctx, repo, desc, basedir, cache, bar); err != nil {
 			return err
 		}
-		defer wf.Close()
-
-		w := bar.WrapWriter(wf, desc.Digest.Hex()[:8], desc.Size, "downloading")
-		if err := c.PullBlob(ctx, repo, desc, w); err != nil {
-			return err
-		}
-		_ = wf.Close()
 
 		// extract
 		rf, err := os.Open(cache)
@@ -204,14 +331,19 @@ func (c Client) pullDirectory(ctx context.Context, repo string, desc types.Descr
 }
 
 func (c Client) PullBlob(ctx context.Context, repo string, desc types.Descriptor, into io.Writer) error {
+	return c.PullBlobRange(ctx, repo, desc, 0, -1, into)
+}
+
+// PullBlobRange pulls length bytes of the blob start from offset, length -1 means to the end.
+func (c Client) PullBlobRange(ctx context.Context, repo string, desc types.Descriptor, offset, length int64, into io.Writer) error {
 	location, err := c.Remote.GetBlobLocation(ctx, repo, desc, types.BlobLocationPurposeDownload)
 	if err != nil {
 		if !IsServerUnsupportError(err) {
 			return err
 		}
-		return c.Remote.GetBlobContent(ctx, repo, desc.Digest, into)
+		return c.Remote.GetBlobContentRange(ctx, repo, desc.Digest, offset, length, into)
 	}
-	return c.Extension.Download(ctx, desc, *location, into)
+	return c.Extension.DownloadRange(ctx, desc, *location, offset, length, into)
 }
 
 func IsServerUnsupportError(err error) bool {
@@ -9,8 +9,11 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/exp/slices"
 	"kubegems.io/modelx/pkg/client/progress"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/tracing"
 	"kubegems.io/modelx/pkg/types"
 )
 
@@ -26,11 +29,19 @@ var EmptyFileDigiest = digest.Canonical.FromBytes(nil)
 
 const PullPushConcurrency = 3
 
-func (c Client) Push(ctx context.Context, repo, version string, configfile, basedir string) error {
+func (c Client) Push(ctx context.Context, repo, version string, configfile, basedir string) (err error) {
+	ctx, span := tracing.Start(ctx, "Push", attribute.String("modelx.repository", repo), attribute.String("modelx.version", version))
+	defer func() { tracing.End(span, err) }()
+
 	manifest, err := ParseManifest(ctx, basedir, configfile)
 	if err != nil {
 		return err
 	}
+	manifest.Annotations = c.Annotations
+	// the repository pulled from is likely to have the same blobs
+	if origin, err := ReadOrigin(basedir); err == nil && origin.Registry == c.Remote.Registry {
+		c.MountFrom = append(slices.Clone(c.MountFrom), origin.Repository)
+	}
 	p, ctx := progress.NewMuiltiBarContext(ctx, os.Stdout, 60, PullPushConcurrency)
 	// push blobs
 	for i := range manifest.Blobs {
@@ -160,7 +171,10 @@ func (c Client) digest(ctx context.Context, blobfile string) (digest.Digest, err
 	return digest.FromReader(f)
 }
 
-func (c Client) PushBlob(ctx context.Context, repo string, desc DescriptorWithContent, p *progress.Bar) error {
+func (c Client) PushBlob(ctx context.Context, repo string, desc DescriptorWithContent, p *progress.Bar) (err error) {
+	ctx, span := tracing.Start(ctx, "PushBlob", blobAttrs(repo, desc.Descriptor)...)
+	defer func() { tracing.End(span, err) }()
+
 	log := logr.FromContextOrDiscard(ctx).WithValues("digest", desc.Digest)
 	if desc.Digest == EmptyFileDigiest {
 		p.SetStatus("empty", true)
@@ -175,6 +189,23 @@ func (c Client) PushBlob(ctx context.Context, repo string, desc DescriptorWithCo
 		p.SetStatus("exists", true)
 		return nil
 	}
+	for _, from := range c.MountFrom {
+		if from == repo {
+			continue
+		}
+		mounted, err := c.Remote.MountBlob(ctx, repo, from, desc.Digest)
+		if err != nil {
+			if IsServerUnsupportError(err) {
+				break
+			}
+			log.Error(err, "mount blob", "from", from)
+			continue
+		}
+		if mounted {
+			p.SetStatus("mounted", true)
+			return nil
+		}
+	}
 	wrappdesc := DescriptorWithContent{
 		Descriptor: desc.Descriptor,
 		GetContent: func() (io.ReadSeekCloser, error) {
@@ -187,6 +218,11 @@ func (c Client) PushBlob(ctx context.Context, repo string, desc DescriptorWithCo
 		},
 	}
 	if err := c.pushBlob(ctx, repo, wrappdesc); err != nil {
+		// the blob is verified by the registry since the head
+		if errors.IsErrCode(err, errors.ErrCodeConflict) {
+			p.SetStatus("exists", true)
+			return nil
+		}
 		return err
 	}
 	p.SetStatus("done", true)
@@ -199,9 +235,7 @@ func (c Client) pushBlob(ctx context.Context, repo string, desc DescriptorWithCo
 		if !IsServerUnsupportError(err) {
 			return err
 		}
-		if err := c.Remote.UploadBlobContent(ctx, repo, desc); err != nil {
-			return err
-		}
+		return c.Remote.UploadBlobContent(ctx, repo, desc)
 	}
 	return c.Extension.Upload(ctx, desc, *location)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -39,6 +40,16 @@ func (t *RegistryClient) GetManifest(ctx context.Context, repository string, ver
 	if err := t.simplerequest(ctx, "GET", path, manifest); err != nil {
 		return nil, err
 	}
+	// make sure the content is exactly what the digest pins
+	if expected, err := digest.Parse(version); err == nil {
+		got, err := manifest.Digest()
+		if err != nil {
+			return nil, err
+		}
+		if got != expected {
+			return nil, fmt.Errorf("manifest digest mismatch, expected %s, got %s", expected, got)
+		}
+	}
 	return manifest, nil
 }
 
@@ -50,22 +61,23 @@ func (t *RegistryClient) PutManifest(ctx context.Context, repository string, ver
 	return t.simpleuploadrequest(ctx, "PUT", path, manifest, nil)
 }
 
-func (t *RegistryClient) GetIndex(ctx context.Context, repository string, search string) (*types.Index, error) {
+// GetIndex returns a page of the versions of repository, index.Continue is set if more pages remain.
+func (t *RegistryClient) GetIndex(ctx context.Context, repository string, options types.IndexListOptions) (*types.Index, error) {
 	index := &types.Index{}
-	path := "/" + repository + "/index" + "?search=" + search
+	path := "/" + repository + "/index"
+	if query := options.Values(); len(query) > 0 {
+		path += "?" + query.Encode()
+	}
 	if err := t.simplerequest(ctx, "GET", path, index); err != nil {
 		return nil, err
 	}
 	return index, nil
 }
 
-func (t *RegistryClient) GetGlobalIndex(ctx context.Context, search string) (*types.Index, error) {
-	query := url.Values{}
-	if search != "" {
-		query.Add("search", search)
-	}
+// GetGlobalIndex returns a page of the repositories, index.Continue is set if more pages remain.
+func (t *RegistryClient) GetGlobalIndex(ctx context.Context, options types.IndexListOptions) (*types.Index, error) {
 	path := "/"
-	if len(query) > 0 {
+	if query := options.Values(); len(query) > 0 {
 		path += "?" + query.Encode()
 	}
 	index := &types.Index{}
@@ -75,6 +87,26 @@ func (t *RegistryClient) GetGlobalIndex(ctx context.Context, search string) (*ty
 	return index, nil
 }
 
+func (t *RegistryClient) CreateAPIToken(ctx context.Context, req types.APITokenRequest) (*types.APIToken, error) {
+	token := &types.APIToken{}
+	if err := t.simpleuploadrequest(ctx, "POST", "/_tokens", req, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (t *RegistryClient) ListAPITokens(ctx context.Context) ([]types.APIToken, error) {
+	tokens := []types.APIToken{}
+	if err := t.simplerequest(ctx, "GET", "/_tokens", &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (t *RegistryClient) RevokeAPIToken(ctx context.Context, id string) error {
+	return t.simplerequest(ctx, "DELETE", "/_tokens/"+url.PathEscape(id), nil)
+}
+
 func (t *RegistryClient) HeadBlob(ctx context.Context, repository string, digest digest.Digest) (bool, error) {
 	path := "/" + repository + "/blobs/" + digest.String()
 	resp, err := t.request(ctx, "HEAD", path, nil, nil, nil)
@@ -89,6 +121,21 @@ func (t *RegistryClient) GetBlobContent(ctx context.Context, repository string,
 	return t.simplerequest(ctx, "GET", path, into)
 }
 
+// GetBlobContentRange downloads length bytes of the blob start from offset, length -1 means to the end.
+func (t *RegistryClient) GetBlobContentRange(ctx context.Context, repository string, digest digest.Digest, offset, length int64, into io.Writer) error {
+	path := "/" + repository + "/blobs/" + digest.String()
+	header := map[string][]string{}
+	if rangeHeader := RangeHeader(offset, length); rangeHeader != "" {
+		header["Range"] = []string{rangeHeader}
+	}
+	resp, err := t.extrequest(ctx, "GET", path, header, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return copyRangeResponse(resp, offset, length, into)
+}
+
 func (t *RegistryClient) GetBlobLocation(ctx context.Context, repository string, desc types.Descriptor, purpose string) (*types.BlobLocation, error) {
 	reqpath := "/" + path.Join(repository, "blobs", desc.Digest.String(), "locations", purpose)
 	query := url.Values{}
@@ -106,7 +153,36 @@ func (t *RegistryClient) GetBlobLocation(ctx context.Context, repository string,
 	return into, nil
 }
 
+// UploadBlobContent uploads blob via a resumable upload session.
+// if the upload is interrupted, it continues from the offset committed by server.
 func (t *RegistryClient) UploadBlobContent(ctx context.Context, repository string, blob DescriptorWithContent) error {
+	upload, err := t.StartBlobUpload(ctx, repository, blob.Digest)
+	if err != nil {
+		if !IsServerUnsupportError(err) {
+			return err
+		}
+		return t.PutBlobContent(ctx, repository, blob)
+	}
+	if upload.Offset > blob.Size {
+		return fmt.Errorf("upload %s offset %d exceeds blob size %d", upload.ID, upload.Offset, blob.Size)
+	}
+	if err := retry(ctx, UploadRetries, func() error {
+		status, err := t.GetBlobUpload(ctx, repository, upload.ID)
+		if err != nil {
+			return err
+		}
+		if status.Offset == blob.Size {
+			return nil
+		}
+		return t.PatchBlobUpload(ctx, repository, *status, blob)
+	}); err != nil {
+		return err
+	}
+	return t.CommitBlobUpload(ctx, repository, upload.ID, blob.Digest)
+}
+
+// PutBlobContent uploads the whole blob in one request.
+func (t *RegistryClient) PutBlobContent(ctx context.Context, repository string, blob DescriptorWithContent) error {
 	header := map[string]string{
 		"Content-Type": "application/octet-stream",
 	}
@@ -119,6 +195,66 @@ func (t *RegistryClient) UploadBlobContent(ctx context.Context, repository strin
 	return err
 }
 
+func (t *RegistryClient) StartBlobUpload(ctx context.Context, repository string, digest digest.Digest) (*types.BlobUploadStatus, error) {
+	path := "/" + repository + "/blobs/uploads/?digest=" + digest.String()
+	status := &types.BlobUploadStatus{}
+	if _, err := t.request(ctx, "POST", path, nil, nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// MountBlob mounts the blob from repository from into repository, it reports false if the blob is not mounted.
+func (t *RegistryClient) MountBlob(ctx context.Context, repository string, from string, digest digest.Digest) (bool, error) {
+	query := url.Values{}
+	query.Set("digest", digest.String())
+	query.Set("from", from)
+	path := "/" + repository + "/blobs/uploads/?" + query.Encode()
+	resp, err := t.request(ctx, "POST", path, nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusCreated, nil
+}
+
+func (t *RegistryClient) GetBlobUpload(ctx context.Context, repository string, id string) (*types.BlobUploadStatus, error) {
+	path := "/" + repository + "/blobs/uploads/" + id
+	status := &types.BlobUploadStatus{}
+	if err := t.simplerequest(ctx, "GET", path, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// PatchBlobUpload uploads the rest of the blob start from the committed offset.
+func (t *RegistryClient) PatchBlobUpload(ctx context.Context, repository string, status types.BlobUploadStatus, blob DescriptorWithContent) error {
+	content, err := blob.GetContent()
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(status.Offset, io.SeekStart); err != nil {
+		content.Close()
+		return err
+	}
+	length := blob.Size - status.Offset
+	header := map[string][]string{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {fmt.Sprintf("%d-%d", status.Offset, blob.Size-1)},
+	}
+	path := "/" + repository + "/blobs/uploads/" + status.ID
+	resp, err := t.extrequest(ctx, "PATCH", path, header, length, content)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *RegistryClient) CommitBlobUpload(ctx context.Context, repository string, id string, digest digest.Digest) error {
+	path := "/" + repository + "/blobs/uploads/" + id + "?digest=" + digest.String()
+	return t.simplerequest(ctx, "PUT", path, nil)
+}
+
 type GetContentFunc func() (io.ReadSeekCloser, error)
 
 type RqeuestBody struct {
@@ -156,7 +292,9 @@ func (t *RegistryClient) request(ctx context.Context, method, url string,
 	req.Header.Set("Authorization", t.Authorization)
 	req.Header.Set("User-Agent", UserAgent)
 
+	req, span := traceRequest(req, true)
 	resp, err := http.DefaultClient.Do(req)
+	endRequestSpan(span, resp, err)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"kubegems.io/modelx/pkg/tracing"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// traceRequest starts a client span of req, the trace context is sent to the server if propagate,
+// it's not sent to the presigned locations of object storage.
+func traceRequest(req *http.Request, propagate bool) (*http.Request, trace.Span) {
+	ctx, span := tracing.Tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethod(req.Method),
+			semconv.HTTPURL(req.URL.Scheme+"://"+req.URL.Host+req.URL.Path),
+		),
+	)
+	if propagate {
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	}
+	return req.WithContext(ctx), span
+}
+
+func endRequestSpan(span trace.Span, resp *http.Response, err error) {
+	if resp != nil {
+		span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+		// not implemented means unsupported by the registry, it falls back
+		if resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	tracing.End(span, err)
+}
+
+func blobAttrs(repo string, desc types.Descriptor) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("modelx.repository", repo),
+		attribute.String("modelx.blob.name", desc.Name),
+		attribute.String("modelx.digest", desc.Digest.String()),
+		attribute.Int64("modelx.blob.size", desc.Size),
+	}
+}
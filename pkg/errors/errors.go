@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/opencontainers/go-digest"
 )
@@ -26,6 +27,8 @@ const (
 	ErrCodeConfigInvalid       ErrCode = "CONFIG_INVALID"
 	ErrCodeInvalidParameter    ErrCode = "INVALID_PARAMETER"
 	ErrCodeIndexUnknown        ErrCode = "INDEX_UNKNOWN"
+	ErrCodeTokenUnknown        ErrCode = "TOKEN_UNKNOWN"
+	ErrCodeConflict            ErrCode = "CONFLICT"
 	ErrCodeUnknow              ErrCode = "UNKNOWN"
 	ErrCodeInternal            ErrCode = "INTERNAL"
 )
@@ -58,6 +61,10 @@ func NewUnauthorizedError(msg string) ErrorInfo {
 	return ErrorInfo{HttpStatus: http.StatusUnauthorized, Code: ErrCodeUnauthorized, Message: msg}
 }
 
+func NewDeniedError(msg string) ErrorInfo {
+	return ErrorInfo{HttpStatus: http.StatusForbidden, Code: ErrCodeDenied, Message: msg}
+}
+
 func NewUnsupportedError(msg string) ErrorInfo {
 	return ErrorInfo{HttpStatus: http.StatusNotImplemented, Code: ErrCodeUnsupported, Message: msg}
 }
@@ -74,6 +81,14 @@ func NewIndexUnknownError(repository string) ErrorInfo {
 	return ErrorInfo{HttpStatus: http.StatusNotFound, Code: ErrCodeIndexUnknown, Message: fmt.Sprintf("index: %s not found", repository)}
 }
 
+func NewTokenUnknownError(id string) ErrorInfo {
+	return ErrorInfo{HttpStatus: http.StatusNotFound, Code: ErrCodeTokenUnknown, Message: fmt.Sprintf("token: %s not found", id)}
+}
+
+func NewConflictError(msg string) ErrorInfo {
+	return ErrorInfo{HttpStatus: http.StatusConflict, Code: ErrCodeConflict, Message: msg}
+}
+
 func NewBlobUnknownError(digest digest.Digest) ErrorInfo {
 	return ErrorInfo{HttpStatus: http.StatusNotFound, Code: ErrCodeBlobUnknown, Message: fmt.Sprintf("blob: %s not found", digest.String())}
 }
@@ -82,6 +97,14 @@ func NewManifestUnknownError(reference string) ErrorInfo {
 	return ErrorInfo{HttpStatus: http.StatusNotFound, Code: ErrCodeManifestUnknown, Message: fmt.Sprintf("manifest: %s not found", reference)}
 }
 
+func NewManifestBlobUnknownError(digests []digest.Digest) ErrorInfo {
+	strs := make([]string, len(digests))
+	for i, d := range digests {
+		strs[i] = d.String()
+	}
+	return ErrorInfo{HttpStatus: http.StatusBadRequest, Code: ErrCodeManifestBlobUnknown, Message: fmt.Sprintf("manifest blob unknown: %s", strings.Join(strs, ", "))}
+}
+
 func NewManifestInvalidError(err error) ErrorInfo {
 	return ErrorInfo{HttpStatus: http.StatusBadRequest, Code: ErrCodeManifestInvalid, Message: err.Error()}
 }
@@ -105,3 +128,15 @@ func NewConfigInvalidError(msg string) ErrorInfo {
 func NewParameterInvalidError(msg string) ErrorInfo {
 	return ErrorInfo{HttpStatus: http.StatusBadRequest, Code: ErrCodeInvalidParameter, Message: msg}
 }
+
+func NewBlobUploadUnknownError(id string) ErrorInfo {
+	return ErrorInfo{HttpStatus: http.StatusNotFound, Code: ErrCodeBlobUploadUnknown, Message: fmt.Sprintf("blob upload: %s not found", id)}
+}
+
+func NewBlobUploadInvalidError(msg string) ErrorInfo {
+	return ErrorInfo{HttpStatus: http.StatusBadRequest, Code: ErrCodeBlobUploadInvalid, Message: fmt.Sprintf("blob upload invalid: %s", msg)}
+}
+
+func NewBlobUploadRangeInvalidError(offset int64) ErrorInfo {
+	return ErrorInfo{HttpStatus: http.StatusRequestedRangeNotSatisfiable, Code: ErrCodeBlobUploadInvalid, Message: fmt.Sprintf("blob upload range invalid: expected start at %d", offset)}
+}
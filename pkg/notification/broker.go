@@ -0,0 +1,107 @@
+package notification
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBrokerLogSize = 1000
+
+	// subscriberBufferSize is the events a subscriber can fall behind, a slower subscriber is dropped.
+	subscriberBufferSize = 64
+)
+
+// Entry is an event in the log of broker, ID is {epoch}.{sequence}, the epoch changes on restart.
+type Entry struct {
+	ID    string
+	Event Event
+}
+
+// Broker publishes events to subscribers, and keeps the last events in a bounded log,
+// so a subscriber can resume from the last event it received.
+type Broker struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	log         []Entry
+	size        int
+	subscribers map[chan Entry]struct{}
+}
+
+func NewBroker(size int) *Broker {
+	if size <= 0 {
+		size = DefaultBrokerLogSize
+	}
+	return &Broker{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:        size,
+		subscribers: map[chan Entry]struct{}{},
+	}
+}
+
+func (b *Broker) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	entry := Entry{ID: b.epoch + "." + strconv.FormatUint(b.seq, 10), Event: event}
+	if len(b.log) >= b.size {
+		b.log = append(b.log[:0], b.log[1:]...)
+	}
+	b.log = append(b.log, entry)
+	for ch := range b.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			// resumes by the last event id on reconnect
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the events after lastEventID in the log and the channel of new events,
+// the channel is closed if the subscriber falls behind. No events in the log are returned
+// if lastEventID is empty, a new subscriber receives new events only; all events in the log are returned
+// if lastEventID is from another epoch or not in the log anymore.
+func (b *Broker) Subscribe(lastEventID string) ([]Entry, <-chan Entry, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	backlog := []Entry{}
+	if lastEventID != "" {
+		backlog = append(backlog, b.log[b.after(lastEventID):]...)
+	}
+	ch := make(chan Entry, subscriberBufferSize)
+	b.subscribers[ch] = struct{}{}
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+// after returns the index in log of the first event after id.
+func (b *Broker) after(id string) int {
+	epoch, seqstr, _ := strings.Cut(id, ".")
+	seq, err := strconv.ParseUint(seqstr, 10, 64)
+	if epoch != b.epoch || err != nil || len(b.log) == 0 {
+		return 0
+	}
+	first := b.seq - uint64(len(b.log)) + 1
+	if seq < first {
+		return 0
+	}
+	if seq >= b.seq {
+		return len(b.log)
+	}
+	return int(seq - first + 1)
+}
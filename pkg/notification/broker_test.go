@@ -0,0 +1,79 @@
+package notification
+
+import (
+	"strconv"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func entryRefs(entries []Entry) []string {
+	refs := []string{}
+	for _, entry := range entries {
+		refs = append(refs, entry.Event.Reference)
+	}
+	return refs
+}
+
+func TestBrokerSubscribe(t *testing.T) {
+	b := NewBroker(3)
+	for i := 1; i <= 5; i++ {
+		b.Publish(Event{Action: ActionPush, Reference: "v" + strconv.Itoa(i)})
+	}
+	// the log keeps v3, v4 and v5
+	id := func(seq int) string { return b.epoch + "." + strconv.Itoa(seq) }
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []string
+	}{
+		{name: "new subscriber", lastEventID: "", want: []string{}},
+		{name: "resume", lastEventID: id(3), want: []string{"v4", "v5"}},
+		{name: "up to date", lastEventID: id(5), want: []string{}},
+		{name: "not in the log anymore", lastEventID: id(1), want: []string{"v3", "v4", "v5"}},
+		{name: "another epoch", lastEventID: "previous.4", want: []string{"v3", "v4", "v5"}},
+		{name: "invalid id", lastEventID: "invalid", want: []string{"v3", "v4", "v5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backlog, _, cancel := b.Subscribe(tt.lastEventID)
+			defer cancel()
+			if refs := entryRefs(backlog); !slices.Equal(refs, tt.want) {
+				t.Errorf("Subscribe() backlog = %v, want %v", refs, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrokerPublish(t *testing.T) {
+	b := NewBroker(0)
+	_, events, cancel := b.Subscribe("")
+	defer cancel()
+	_, slow, slowcancel := b.Subscribe("")
+	defer slowcancel()
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		b.Publish(Event{Action: ActionPush, Reference: strconv.Itoa(i)})
+		if entry := <-events; entry.Event.Reference != strconv.Itoa(i) || entry.ID != b.epoch+"."+strconv.Itoa(i+1) {
+			t.Fatalf("received %+v, want event %d", entry, i)
+		}
+	}
+	// the slow subscriber falls behind, and is dropped
+	b.Publish(Event{Action: ActionPush, Reference: "overflow"})
+	<-events
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBufferSize {
+		t.Errorf("slow subscriber received %d events before closed, want %d", received, subscriberBufferSize)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("channel expect closed after cancel")
+	}
+	// publishing to a nil broker is a no-op
+	(*Broker)(nil).Publish(Event{})
+}
@@ -0,0 +1,198 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// backoff of the retries, variables to be shortened by tests.
+var (
+	initialBackoff = time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// endpoint delivers its queued events one by one in order.
+type endpoint struct {
+	EndpointConfig
+	repositories *regexp.Regexp
+	client       *http.Client
+	// dir keeps the events not delivered yet, one file per event.
+	dir  string
+	wake chan struct{}
+}
+
+func newEndpoint(config EndpointConfig, queuedir string) (*endpoint, error) {
+	dir := filepath.Join(queuedir, config.Name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	e := &endpoint{
+		EndpointConfig: config,
+		client:         &http.Client{Timeout: config.Timeout},
+		dir:            dir,
+		wake:           make(chan struct{}, 1),
+	}
+	if config.Repositories != "" {
+		e.repositories = regexp.MustCompile(config.Repositories)
+	}
+	return e, nil
+}
+
+func (e *endpoint) match(event Event) bool {
+	if e.repositories != nil && !e.repositories.MatchString(event.Repository) {
+		return false
+	}
+	if len(e.Actions) == 0 {
+		return true
+	}
+	for _, action := range e.Actions {
+		if action == event.Action {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue saves event into the queue, the file names keep the order of events.
+func (e *endpoint) enqueue(event Event) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d-%s.json", event.Timestamp.UnixNano(), event.ID)
+	// rename after written, so a partial event is never delivered
+	tmp := filepath.Join(e.dir, ".tmp-"+name)
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(e.dir, name)); err != nil {
+		return err
+	}
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (e *endpoint) run(ctx context.Context) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("endpoint", e.Name)
+	for {
+		files, err := e.pending()
+		if err != nil {
+			log.Error(err, "list queued notifications")
+		}
+		for _, file := range files {
+			if !e.deliver(ctx, log, file) {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.wake:
+		}
+	}
+}
+
+// pending returns the queued events in order.
+func (e *endpoint) pending() ([]string, error) {
+	entries, err := os.ReadDir(e.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		files = append(files, entry.Name())
+	}
+	return files, nil
+}
+
+// deliver posts the queued event with backoff until it succeeds or the retries exhausted,
+// the event is removed from the queue then. It returns false if ctx is done.
+func (e *endpoint) deliver(ctx context.Context, log logr.Logger, file string) bool {
+	path := filepath.Join(e.dir, file)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Error(err, "read queued notification", "file", file)
+		return true
+	}
+	event := Event{}
+	if err := json.Unmarshal(content, &event); err != nil {
+		log.Error(err, "drop invalid notification", "file", file)
+		os.Remove(path)
+		return true
+	}
+	backoff := initialBackoff
+	for retries := 0; ; retries++ {
+		err := e.post(ctx, event, content)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if retries >= e.MaxRetries {
+			log.Error(err, "drop notification, retries exhausted", "id", event.ID, "retries", retries)
+			break
+		}
+		log.Error(err, "post notification", "id", event.ID, "retryAfter", backoff.String())
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		log.Error(err, "remove queued notification", "file", file)
+	}
+	return true
+}
+
+func (e *endpoint) post(ctx context.Context, event Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Action)
+	req.Header.Set(HeaderDelivery, event.ID)
+	if e.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(e.Secret, body))
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value of body, receivers verify it with the shared secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
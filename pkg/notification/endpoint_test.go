@@ -0,0 +1,211 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+type delivery struct {
+	header http.Header
+	body   []byte
+	event  Event
+}
+
+// receiver records the deliveries, it fails the first failures requests with 500.
+type receiver struct {
+	mu         sync.Mutex
+	failures   int
+	requests   int
+	deliveries []delivery
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	if r.requests <= r.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	event := Event{}
+	json.Unmarshal(body, &event)
+	r.deliveries = append(r.deliveries, delivery{header: req.Header.Clone(), body: body, event: event})
+}
+
+// wait returns the deliveries once there are n of them.
+func (r *receiver) wait(t *testing.T, n int) []delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		deliveries := slices.Clone(r.deliveries)
+		r.mu.Unlock()
+		if len(deliveries) >= n {
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d deliveries", n)
+	return nil
+}
+
+func newTestEndpoint(t *testing.T, r *receiver, queuedir string) *endpoint {
+	t.Helper()
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	e, err := newEndpoint(EndpointConfig{
+		Name:       "test",
+		URL:        server.URL,
+		Secret:     "secret",
+		Timeout:    DefaultTimeout,
+		MaxRetries: DefaultMaxRetries,
+	}, queuedir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// runTestEndpoint runs e until the test ends.
+func runTestEndpoint(t *testing.T, e *endpoint) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func enqueueTestEvents(t *testing.T, e *endpoint, references ...string) {
+	t.Helper()
+	base := time.Now().UTC()
+	for i, reference := range references {
+		event := Event{
+			ID:         "id-" + reference,
+			Timestamp:  base.Add(time.Duration(i) * time.Millisecond),
+			Action:     ActionPush,
+			Repository: "project/a",
+			Reference:  reference,
+		}
+		if err := e.enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func deliveredRefs(deliveries []delivery) []string {
+	refs := []string{}
+	for _, delivery := range deliveries {
+		refs = append(refs, delivery.event.Reference)
+	}
+	return refs
+}
+
+// waitQueueEmpty waits for the delivered events removed from the queue.
+func waitQueueEmpty(t *testing.T, e *endpoint) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		files, err := e.pending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("queued events not removed after delivered")
+}
+
+func TestEndpointDeliverSigned(t *testing.T) {
+	r := &receiver{}
+	e := newTestEndpoint(t, r, t.TempDir())
+	runTestEndpoint(t, e)
+	enqueueTestEvents(t, e, "v1")
+
+	got := r.wait(t, 1)[0]
+	if want := Sign("secret", got.body); got.header.Get(HeaderSignature) != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, got.header.Get(HeaderSignature), want)
+	}
+	if Sign("another secret", got.body) == got.header.Get(HeaderSignature) {
+		t.Error("signature does not depend on the secret")
+	}
+	if got.header.Get(HeaderEvent) != ActionPush {
+		t.Errorf("%s = %q, want %q", HeaderEvent, got.header.Get(HeaderEvent), ActionPush)
+	}
+	if got.header.Get(HeaderDelivery) != "id-v1" {
+		t.Errorf("%s = %q, want %q", HeaderDelivery, got.header.Get(HeaderDelivery), "id-v1")
+	}
+	if got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got.header.Get("Content-Type"))
+	}
+}
+
+func TestEndpointDeliverInOrder(t *testing.T) {
+	r := &receiver{}
+	e := newTestEndpoint(t, r, t.TempDir())
+	references := []string{}
+	for i := 1; i <= 10; i++ {
+		references = append(references, "v"+strconv.Itoa(i))
+	}
+	// queued before running, so they are delivered in one pass
+	enqueueTestEvents(t, e, references...)
+	runTestEndpoint(t, e)
+
+	if got := deliveredRefs(r.wait(t, len(references))); !slices.Equal(got, references) {
+		t.Errorf("delivered %v, want %v", got, references)
+	}
+	waitQueueEmpty(t, e)
+}
+
+func TestEndpointDeliverRetry(t *testing.T) {
+	// restored after the endpoint stopped, cleanups run in reverse order
+	initial := initialBackoff
+	t.Cleanup(func() { initialBackoff = initial })
+	initialBackoff = time.Millisecond
+
+	r := &receiver{failures: 3}
+	e := newTestEndpoint(t, r, t.TempDir())
+	enqueueTestEvents(t, e, "v1", "v2")
+	runTestEndpoint(t, e)
+
+	// v2 waits for v1 to succeed
+	if got := deliveredRefs(r.wait(t, 2)); !slices.Equal(got, []string{"v1", "v2"}) {
+		t.Errorf("delivered %v, want [v1 v2]", got)
+	}
+	waitQueueEmpty(t, e)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.requests != 5 {
+		t.Errorf("requests = %d, want 3 failed and 2 succeeded", r.requests)
+	}
+}
+
+func TestEndpointDeliverAfterRestart(t *testing.T) {
+	queuedir := t.TempDir()
+	r := &receiver{}
+	// queued by the previous process, which exited before delivering them
+	enqueueTestEvents(t, newTestEndpoint(t, r, queuedir), "v1", "v2", "v3")
+
+	e := newTestEndpoint(t, r, queuedir)
+	runTestEndpoint(t, e)
+	if got := deliveredRefs(r.wait(t, 3)); !slices.Equal(got, []string{"v1", "v2", "v3"}) {
+		t.Errorf("delivered %v, want [v1 v2 v3]", got)
+	}
+	waitQueueEmpty(t, e)
+}
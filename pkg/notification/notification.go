@@ -0,0 +1,161 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ActionPush is a version pushed with a manifest new to the repository.
+	ActionPush = "push"
+	// ActionTag is a version pushed with a manifest already in the repository.
+	ActionTag = "tag"
+	// ActionDelete is a version deleted, deleting a repository deletes all its versions.
+	ActionDelete = "delete"
+)
+
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 10
+
+	// HeaderEvent is the action of the event.
+	HeaderEvent = "Modelx-Event"
+	// HeaderDelivery is the id of the event, the same event may be delivered more than once.
+	HeaderDelivery = "Modelx-Delivery"
+	// HeaderSignature is sha256={hex hmac-sha256 of body keyed by the secret}.
+	HeaderSignature = "Modelx-Signature"
+)
+
+type Event struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Action     string    `json:"action"`
+	Repository string    `json:"repository"`
+	Reference  string    `json:"reference"`
+	// Digest is the manifest digest of the version, the deleted one for delete events.
+	Digest string `json:"digest,omitempty"`
+	// PreviousDigest is the manifest digest the version pointed to before push or tag.
+	PreviousDigest string `json:"previousDigest,omitempty"`
+	Actor          string `json:"actor,omitempty"`
+}
+
+// Config is the file of notification endpoints.
+//
+//	endpoints:
+//	  - name: deployer
+//	    url: https://deployer.example.com/hooks/modelx
+//	    secret: a-long-random-string
+//	    repositories: "^team/.*"
+//	    actions: ["push", "tag"]
+type Config struct {
+	Endpoints []EndpointConfig `json:"endpoints" yaml:"endpoints"`
+}
+
+type EndpointConfig struct {
+	// Name identifies the endpoint and its retry queue.
+	Name string `json:"name" yaml:"name"`
+	URL  string `json:"url" yaml:"url"`
+	// Secret signs the events with hmac-sha256, events are not signed if empty.
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// Repositories is the regexp of repositories to notify, all repositories if empty.
+	Repositories string `json:"repositories,omitempty" yaml:"repositories,omitempty"`
+	// Actions to notify, all actions if empty.
+	Actions    []string      `json:"actions,omitempty" yaml:"actions,omitempty"`
+	Timeout    time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	MaxRetries int           `json:"maxRetries,omitempty" yaml:"maxRetries,omitempty"`
+}
+
+var endpointNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]+(?:[._-][a-zA-Z0-9]+)*$`)
+
+func LoadConfig(file string) (*Config, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("parse notification config %s: %w", file, err)
+	}
+	names := map[string]bool{}
+	for i := range config.Endpoints {
+		endpoint := &config.Endpoints[i]
+		if !endpointNameRegexp.MatchString(endpoint.Name) || names[endpoint.Name] {
+			return nil, fmt.Errorf("notification config %s: endpoint %d: invalid or duplicated name %q", file, i, endpoint.Name)
+		}
+		names[endpoint.Name] = true
+		if endpoint.URL == "" {
+			return nil, fmt.Errorf("notification config %s: endpoint %s: url is required", file, endpoint.Name)
+		}
+		if _, err := regexp.Compile(endpoint.Repositories); err != nil {
+			return nil, fmt.Errorf("notification config %s: endpoint %s: %w", file, endpoint.Name, err)
+		}
+		for _, action := range endpoint.Actions {
+			switch action {
+			case ActionPush, ActionTag, ActionDelete:
+			default:
+				return nil, fmt.Errorf("notification config %s: endpoint %s: unknown action %q", file, endpoint.Name, action)
+			}
+		}
+		if endpoint.Timeout <= 0 {
+			endpoint.Timeout = DefaultTimeout
+		}
+		if endpoint.MaxRetries <= 0 {
+			endpoint.MaxRetries = DefaultMaxRetries
+		}
+	}
+	return config, nil
+}
+
+// Notifier delivers events to the endpoints, events are queued in a directory until delivered,
+// so they survive restarts.
+type Notifier struct {
+	endpoints []*endpoint
+}
+
+func NewNotifier(ctx context.Context, config *Config, queuedir string) (*Notifier, error) {
+	n := &Notifier{}
+	for _, endpointConfig := range config.Endpoints {
+		endpoint, err := newEndpoint(endpointConfig, queuedir)
+		if err != nil {
+			return nil, err
+		}
+		n.endpoints = append(n.endpoints, endpoint)
+	}
+	for _, endpoint := range n.endpoints {
+		go endpoint.run(ctx)
+	}
+	return n, nil
+}
+
+// Enabled reports whether any endpoint is configured, events are expensive to collect sometimes.
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.endpoints) > 0
+}
+
+// Notify queues event to the matched endpoints, failures are logged and never fail the requests.
+func (n *Notifier) Notify(ctx context.Context, event Event) {
+	if !n.Enabled() {
+		return
+	}
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	for _, endpoint := range n.endpoints {
+		if !endpoint.match(event) {
+			continue
+		}
+		if err := endpoint.enqueue(event); err != nil {
+			logr.FromContextOrDiscard(ctx).Error(err, "queue notification", "endpoint", endpoint.Name, "id", event.ID)
+		}
+	}
+}
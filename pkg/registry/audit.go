@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"kubegems.io/modelx/pkg/audit"
+)
+
+// audit records the event of request r with the user and client.
+func (s *Registry) audit(r *http.Request, event audit.Event) {
+	if !s.Audit.Enabled() {
+		return
+	}
+	event.ClientIP = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		event.ClientIP = host
+	}
+	event.ForwardedFor = r.Header.Get("X-Forwarded-For")
+	s.recordAudit(r.Context(), event)
+}
+
+// recordAudit records the event with the user of ctx, the user is empty for the mutations of the registry itself,
+// e.g. retention on schedule.
+func (s *Registry) recordAudit(ctx context.Context, event audit.Event) {
+	if !s.Audit.Enabled() {
+		return
+	}
+	event.User = UsernameFromContext(ctx)
+	s.Audit.Record(ctx, event)
+}
+
+// previousManifestDigest returns the digest of the manifest before it is changed,
+// empty if the manifest not exists or both audit and notification are disabled.
+func (s *Registry) previousManifestDigest(ctx context.Context, repository, reference string) string {
+	if !s.Audit.Enabled() && !s.notifyEnabled() {
+		return ""
+	}
+	if dgst, ok := ParseDigestReference(reference); ok {
+		return dgst.String()
+	}
+	manifest, err := s.Store.GetManifest(ctx, repository, reference)
+	if err != nil {
+		return ""
+	}
+	dgst, err := manifest.Digest()
+	if err != nil {
+		return ""
+	}
+	return dgst.String()
+}
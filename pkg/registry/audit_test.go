@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/audit"
+)
+
+// recordingSink keeps the events recorded.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (s *recordingSink) Write(ctx context.Context, event audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// last returns the last event recorded and clears the events.
+func (s *recordingSink) last(t *testing.T) audit.Event {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(s.events))
+	}
+	event := s.events[0]
+	s.events = nil
+	return event
+}
+
+func TestRegistryAudit(t *testing.T) {
+	store, _ := newTestFSStore(t)
+	sink := &recordingSink{}
+	s := &Registry{Store: store, Audit: audit.NewAuditor(sink)}
+	router := s.route()
+	repository := "project/a"
+
+	serve := func(method, target string, body []byte) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req = req.WithContext(testUser{username: "alice"}.request().Context())
+		req.RemoteAddr = "10.0.0.1:51234"
+		req.Header.Set("X-Forwarded-For", "192.168.0.1")
+		req.Header.Set("Content-Type", "application/octet-stream")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s status = %d, body = %s", method, target, rec.Code, rec.Body)
+		}
+	}
+	manifestDigest := func(blob string) ([]byte, digest.Digest) {
+		manifest := testManifest(putTestBlob(t, store, repository, blob))
+		content, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := manifest.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content, dgst
+	}
+	check := func(want audit.Event) {
+		t.Helper()
+		got := sink.last(t)
+		if got.Action != want.Action || got.Repository != repository || got.Reference != want.Reference ||
+			got.OldDigest != want.OldDigest || got.NewDigest != want.NewDigest {
+			t.Errorf("recorded %+v, want %+v", got, want)
+		}
+		if got.User != "alice" || got.ClientIP != "10.0.0.1" || got.ForwardedFor != "192.168.0.1" || got.Time.IsZero() {
+			t.Errorf("recorded user %q, client %q forwarded for %q at %s, want alice from 10.0.0.1 for 192.168.0.1",
+				got.User, got.ClientIP, got.ForwardedFor, got.Time)
+		}
+	}
+
+	blob := digest.FromString("weights")
+	serve(http.MethodPut, "/"+repository+"/blobs/"+blob.String(), []byte("weights"))
+	check(audit.Event{Action: audit.ActionPutBlob, NewDigest: blob.String()})
+
+	v1, v1Digest := manifestDigest("weights v1")
+	serve(http.MethodPut, "/"+repository+"/manifests/v1", v1)
+	check(audit.Event{Action: audit.ActionPutManifest, Reference: "v1", NewDigest: v1Digest.String()})
+
+	v2, v2Digest := manifestDigest("weights v2")
+	serve(http.MethodPut, "/"+repository+"/manifests/v1", v2)
+	check(audit.Event{Action: audit.ActionPutManifest, Reference: "v1", OldDigest: v1Digest.String(), NewDigest: v2Digest.String()})
+
+	serve(http.MethodDelete, "/"+repository+"/manifests/v1", nil)
+	check(audit.Event{Action: audit.ActionDeleteManifest, Reference: "v1", OldDigest: v2Digest.String()})
+
+	serve(http.MethodPost, "/"+repository+"/garbage-collect", nil)
+	check(audit.Event{Action: audit.ActionGarbageCollect})
+
+	serve(http.MethodPut, "/"+repository+"/manifests/v3", v1)
+	sink.last(t)
+	serve(http.MethodDelete, "/"+repository+"/index", nil)
+	check(audit.Event{Action: audit.ActionDeleteIndex})
+}
@@ -0,0 +1,296 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"kubegems.io/modelx/pkg/errors"
+)
+
+// AuthorizationReloadInterval is the interval to check the authorization config file for changes.
+const AuthorizationReloadInterval = 10 * time.Second
+
+// Role is the permission of a user on a project, a higher role includes the permissions of lower ones.
+type Role int
+
+const (
+	RoleNone Role = iota
+	// RoleReader can pull models.
+	RoleReader
+	// RoleWriter can push and delete versions.
+	RoleWriter
+	// RoleAdmin can delete repositories, collect garbage and apply retention.
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleReader:
+		return "reader"
+	case RoleWriter:
+		return "writer"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "reader":
+		return RoleReader, nil
+	case "writer":
+		return RoleWriter, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q, must be one of reader, writer and admin", s)
+	}
+}
+
+// AuthorizationPolicy grants roles on projects to users and groups, loaded from the authorization config file.
+//
+//	rules:
+//	  - projects: ["*"]
+//	    role: reader
+//	    subjects: ["*"]
+//	  - projects: ["team"]
+//	    role: writer
+//	    groups: ["ml-team"]
+type AuthorizationPolicy struct {
+	Rules []AuthorizationRule `json:"rules" yaml:"rules"`
+}
+
+type AuthorizationRule struct {
+	// Projects are the first part of repository names, "*" for all projects.
+	Projects []string `json:"projects" yaml:"projects"`
+	// Role is one of reader, writer and admin.
+	Role string `json:"role" yaml:"role"`
+	// Subjects are the subjects of oidc tokens, "*" for all authenticated users.
+	Subjects []string `json:"subjects,omitempty" yaml:"subjects,omitempty"`
+	// Groups are the values of the groups claim of oidc tokens.
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+
+	role Role
+}
+
+func LoadAuthorizationPolicy(file string) (*AuthorizationPolicy, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &AuthorizationPolicy{}
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("parse authorization config %s: %w", file, err)
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		role, err := ParseRole(rule.Role)
+		if err != nil {
+			return nil, fmt.Errorf("authorization config %s: rule %d: %w", file, i, err)
+		}
+		rule.role = role
+	}
+	return policy, nil
+}
+
+// RoleOf returns the highest role granted to the user on project.
+func (p *AuthorizationPolicy) RoleOf(username string, groups []string, project string) Role {
+	role := RoleNone
+	if username == "" {
+		return role
+	}
+	for _, rule := range p.Rules {
+		if rule.role <= role || !containsOrWildcard(rule.Projects, project) {
+			continue
+		}
+		if containsOrWildcard(rule.Subjects, username) || containsAny(rule.Groups, groups) {
+			role = rule.role
+		}
+	}
+	return role
+}
+
+func containsOrWildcard(list []string, val string) bool {
+	for _, item := range list {
+		if item == "*" || item == val {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, vals []string) bool {
+	for _, item := range list {
+		for _, val := range vals {
+			if item == val {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authorizer authorizes requests by the policy in file, the policy is reloaded when the file changed.
+type Authorizer struct {
+	file    string
+	policy  atomic.Pointer[AuthorizationPolicy]
+	modtime time.Time
+}
+
+func NewAuthorizer(ctx context.Context, file string) (*Authorizer, error) {
+	a := &Authorizer{file: file}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	go a.watch(ctx, AuthorizationReloadInterval)
+	return a, nil
+}
+
+func (a *Authorizer) reload() error {
+	info, err := os.Stat(a.file)
+	if err != nil {
+		return err
+	}
+	if !info.ModTime().After(a.modtime) {
+		return nil
+	}
+	policy, err := LoadAuthorizationPolicy(a.file)
+	if err != nil {
+		return err
+	}
+	a.policy.Store(policy)
+	a.modtime = info.ModTime()
+	return nil
+}
+
+func (a *Authorizer) watch(ctx context.Context, interval time.Duration) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("file", a.file)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modtime := a.modtime
+			// keep the last valid policy on error
+			if err := a.reload(); err != nil {
+				log.Error(err, "reload authorization config")
+				continue
+			}
+			if a.modtime != modtime {
+				log.Info("authorization config reloaded")
+			}
+		}
+	}
+}
+
+// RoleOf returns the role of the user in ctx on the project of repository.
+func (a *Authorizer) RoleOf(ctx context.Context, repository string) Role {
+	project, _, _ := strings.Cut(repository, "/")
+	return a.policy.Load().RoleOf(UsernameFromContext(ctx), GroupsFromContext(ctx), project)
+}
+
+// RoleOfScopes returns the highest role granted by scopes on repository,
+// a scope is {repository pattern}:{role}, e.g. "project/*:writer".
+func RoleOfScopes(scopes []string, repository string) Role {
+	role := RoleNone
+	for _, scope := range scopes {
+		pattern, scoped, err := ParseScope(scope)
+		if err != nil || scoped <= role || !MatchRepository(pattern, repository) {
+			continue
+		}
+		role = scoped
+	}
+	return role
+}
+
+// ParseScope parses a scope like "project/*:writer" into the repository pattern and role.
+func ParseScope(scope string) (string, Role, error) {
+	i := strings.LastIndex(scope, ":")
+	if i <= 0 {
+		return "", RoleNone, fmt.Errorf("invalid scope %q, must be {repository}:{role}", scope)
+	}
+	role, err := ParseRole(scope[i+1:])
+	if err != nil {
+		return "", RoleNone, fmt.Errorf("invalid scope %q: %w", scope, err)
+	}
+	return scope[:i], role, nil
+}
+
+// checkRole returns an error if the user of r has no role on repository,
+// all roles are granted without authorizer, admin users are admins of all repositories,
+// either way unless the token is limited by scopes.
+// everyone can read public projects, anonymous requests can do nothing else.
+func (s *Registry) checkRole(r *http.Request, repository string, role Role) error {
+	if role == RoleReader && s.Projects.IsPublic(r.Context(), repository) {
+		return nil
+	}
+	if IsAnonymousFromContext(r.Context()) {
+		return errors.NewUnauthorizedError("authentication required")
+	}
+	granted := RoleAdmin
+	// robot accounts have no roles but their scopes
+	if s.Authorizer != nil && !IsRobotFromContext(r.Context()) &&
+		!slices.Contains(s.Admins, UsernameFromContext(r.Context())) {
+		granted = s.Authorizer.RoleOf(r.Context(), repository)
+	}
+	// the token may be limited to scopes
+	if scopes := ScopesFromContext(r.Context()); scopes != nil {
+		if scoped := RoleOfScopes(scopes, repository); scoped < granted {
+			granted = scoped
+		}
+	}
+	if granted >= role {
+		return nil
+	}
+	username := UsernameFromContext(r.Context())
+	if username == "" {
+		return errors.NewUnauthorizedError("authentication required")
+	}
+	return errors.NewDeniedError(fmt.Sprintf("user %s requires role %s on %s", username, role, repository))
+}
+
+// isAdmin reports whether the user of r has the admin role on repository, there is no admin without authentication.
+func (s *Registry) isAdmin(r *http.Request, repository string) bool {
+	return UsernameFromContext(r.Context()) != "" && s.checkRole(r, repository, RoleAdmin) == nil
+}
+
+// authorize requires role on the repository of the request.
+func (s *Registry) authorize(role Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, _ := GetRepositoryReference(r)
+		if err := s.checkRole(r, name, role); err != nil {
+			ResponseError(w, err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// ociAuthorize is authorize responds oci errors.
+func (s *Registry) ociAuthorize(role Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, _ := GetRepositoryReference(r)
+		if err := s.checkRole(r, name, role); err != nil {
+			ResponseOCIError(w, err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// canRead reports whether the user of r can read repository, used to filter repositories and mount sources.
+func (s *Registry) canRead(r *http.Request, repository string) bool {
+	return s.checkRole(r, repository, RoleReader) == nil
+}
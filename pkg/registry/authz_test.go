@@ -0,0 +1,236 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+const testAuthorizationConfig = `
+rules:
+  - projects: ["*"]
+    role: reader
+    subjects: ["*"]
+  - projects: ["team"]
+    role: writer
+    groups: ["ml-team"]
+  - projects: ["team"]
+    role: admin
+    subjects: ["alice"]
+`
+
+func newTestAuthorizer(t *testing.T) *Authorizer {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "authorization.yaml")
+	if err := os.WriteFile(file, []byte(testAuthorizationConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a := &Authorizer{file: file}
+	if err := a.reload(); err != nil {
+		t.Fatalf("load authorization config: %v", err)
+	}
+	return a
+}
+
+func TestAuthorizationPolicyRoleOf(t *testing.T) {
+	policy := newTestAuthorizer(t).policy.Load()
+	tests := []struct {
+		name     string
+		username string
+		groups   []string
+		project  string
+		want     Role
+	}{
+		{name: "wildcard subject", username: "bob", project: "other", want: RoleReader},
+		{name: "group", username: "bob", groups: []string{"ml-team"}, project: "team", want: RoleWriter},
+		{name: "highest role", username: "alice", groups: []string{"ml-team"}, project: "team", want: RoleAdmin},
+		{name: "role on other project", username: "alice", project: "other", want: RoleReader},
+		{name: "unauthenticated", project: "team", want: RoleNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.RoleOf(tt.username, tt.groups, tt.project); got != tt.want {
+				t.Errorf("RoleOf() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadAuthorizationPolicyInvalidRole(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "authorization.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - projects: [\"*\"]\n    role: owner\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAuthorizationPolicy(file); err == nil {
+		t.Error("LoadAuthorizationPolicy() expect error of unknown role")
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		scope       string
+		wantPattern string
+		wantRole    Role
+		wantErr     bool
+	}{
+		{scope: "project/*:writer", wantPattern: "project/*", wantRole: RoleWriter},
+		{scope: "*:reader", wantPattern: "*", wantRole: RoleReader},
+		{scope: "project/name:admin", wantPattern: "project/name", wantRole: RoleAdmin},
+		{scope: "project/*", wantErr: true},
+		{scope: ":reader", wantErr: true},
+		{scope: "project/*:owner", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			pattern, role, err := ParseScope(tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if pattern != tt.wantPattern || role != tt.wantRole {
+				t.Errorf("ParseScope() = %q, %s, want %q, %s", pattern, role, tt.wantPattern, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestRoleOfScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		repository string
+		want       Role
+	}{
+		{name: "matched", scopes: []string{"team/*:writer"}, repository: "team/demo", want: RoleWriter},
+		{name: "highest matched", scopes: []string{"*:reader", "team/*:admin"}, repository: "team/demo", want: RoleAdmin},
+		{name: "not matched", scopes: []string{"team/*:writer"}, repository: "other/demo", want: RoleNone},
+		{name: "invalid scope ignored", scopes: []string{"team/*", "*:reader"}, repository: "team/demo", want: RoleReader},
+		{name: "no scopes", repository: "team/demo", want: RoleNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RoleOfScopes(tt.scopes, tt.repository); got != tt.want {
+				t.Errorf("RoleOfScopes() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// testUser describes the user of a request set by the auth filter.
+type testUser struct {
+	username  string
+	groups    []string
+	scopes    []string
+	robot     bool
+	anonymous bool
+}
+
+func (u testUser) request() *http.Request {
+	ctx := context.Background()
+	if u.anonymous {
+		ctx = NewAnonymousContext(ctx)
+	} else {
+		ctx = NewGroupsContext(NewUsernameContext(ctx, u.username), u.groups)
+		if u.scopes != nil {
+			ctx = NewScopesContext(ctx, u.scopes)
+		}
+		if u.robot {
+			ctx = NewRobotContext(ctx)
+		}
+	}
+	return httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+}
+
+func newTestProjects(t *testing.T, public ...string) *Projects {
+	t.Helper()
+	fs, err := NewLocalFSProvider(&LocalFSOptions{Basepath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects := NewProjects(fs)
+	for _, project := range public {
+		if err := projects.Put(context.Background(), types.Project{Name: project, Visibility: types.ProjectVisibilityPublic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return projects
+}
+
+func TestRegistryCheckRole(t *testing.T) {
+	authorizer := newTestAuthorizer(t)
+	projects := newTestProjects(t, "public")
+
+	tests := []struct {
+		name       string
+		registry   *Registry
+		user       testUser
+		repository string
+		role       Role
+		wantCode   errors.ErrCode
+	}{
+		{name: "granted by policy", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "bob", groups: []string{"ml-team"}}, repository: "team/demo", role: RoleWriter},
+		{name: "denied by policy", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "bob"}, repository: "team/demo", role: RoleWriter, wantCode: errors.ErrCodeDenied},
+		{name: "limited by scopes", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "alice", scopes: []string{"team/*:reader"}}, repository: "team/demo", role: RoleWriter, wantCode: errors.ErrCodeDenied},
+		{name: "scopes grant no more than policy", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "bob", scopes: []string{"team/*:admin"}}, repository: "team/demo", role: RoleWriter, wantCode: errors.ErrCodeDenied},
+		{name: "admin user", registry: &Registry{Authorizer: authorizer, Admins: []string{"carol"}}, user: testUser{username: "carol"}, repository: "other/demo", role: RoleAdmin},
+		{name: "admin user limited by scopes", registry: &Registry{Authorizer: authorizer, Admins: []string{"carol"}}, user: testUser{username: "carol", scopes: []string{"*:reader"}}, repository: "other/demo", role: RoleWriter, wantCode: errors.ErrCodeDenied},
+		{name: "robot by scopes", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "robot$ci", robot: true, scopes: []string{"other/*:writer"}}, repository: "other/demo", role: RoleWriter},
+		{name: "robot out of scopes", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "robot$ci", robot: true, scopes: []string{"other/*:writer"}}, repository: "team/demo", role: RoleReader, wantCode: errors.ErrCodeDenied},
+		{name: "no authorizer", registry: &Registry{}, user: testUser{username: "bob"}, repository: "team/demo", role: RoleAdmin},
+		{name: "no authorizer limited by scopes", registry: &Registry{}, user: testUser{username: "bob", scopes: []string{"team/*:writer"}}, repository: "team/demo", role: RoleAdmin, wantCode: errors.ErrCodeDenied},
+		{name: "anonymous reads public project", registry: &Registry{Authorizer: authorizer, Projects: projects}, user: testUser{anonymous: true}, repository: "public/demo", role: RoleReader},
+		{name: "anonymous writes public project", registry: &Registry{Authorizer: authorizer, Projects: projects}, user: testUser{anonymous: true}, repository: "public/demo", role: RoleWriter, wantCode: errors.ErrCodeUnauthorized},
+		{name: "anonymous reads private project", registry: &Registry{Authorizer: authorizer, Projects: projects}, user: testUser{anonymous: true}, repository: "team/demo", role: RoleReader, wantCode: errors.ErrCodeUnauthorized},
+		{name: "anonymous without authorizer", registry: &Registry{Projects: projects}, user: testUser{anonymous: true}, repository: "team/demo", role: RoleReader, wantCode: errors.ErrCodeUnauthorized},
+		{name: "out of scopes reads public project", registry: &Registry{Authorizer: authorizer, Projects: projects}, user: testUser{username: "robot$ci", robot: true, scopes: []string{"other/*:writer"}}, repository: "public/demo", role: RoleReader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.registry.checkRole(tt.user.request(), tt.repository, tt.role)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("checkRole() error = %v", err)
+				}
+				return
+			}
+			if !errors.IsErrCode(err, tt.wantCode) {
+				t.Fatalf("checkRole() error = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRegistryIsAdmin(t *testing.T) {
+	authorizer := newTestAuthorizer(t)
+	tests := []struct {
+		name       string
+		registry   *Registry
+		user       testUser
+		repository string
+		want       bool
+	}{
+		{name: "admin role on project", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "alice"}, repository: "team/demo", want: true},
+		{name: "admin role on other project", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "alice"}, repository: "*", want: false},
+		{name: "admin user", registry: &Registry{Authorizer: authorizer, Admins: []string{"carol"}}, user: testUser{username: "carol"}, repository: "*", want: true},
+		{name: "read scoped token of admin user", registry: &Registry{Authorizer: authorizer, Admins: []string{"carol"}}, user: testUser{username: "carol", scopes: []string{"*:reader"}}, repository: "team/demo", want: false},
+		{name: "admin scoped token of admin user", registry: &Registry{Authorizer: authorizer, Admins: []string{"carol"}}, user: testUser{username: "carol", scopes: []string{"team/*:admin"}}, repository: "team/demo", want: true},
+		{name: "admin user without authorizer", registry: &Registry{Admins: []string{"carol"}}, user: testUser{username: "carol"}, repository: "*", want: true},
+		{name: "any user without authorizer", registry: &Registry{}, user: testUser{username: "bob"}, repository: "*", want: true},
+		{name: "read scoped token without authorizer", registry: &Registry{}, user: testUser{username: "bob", scopes: []string{"*:reader"}}, repository: "team/demo", want: false},
+		{name: "robot named as admin user", registry: &Registry{Authorizer: authorizer, Admins: []string{"robot$ci"}}, user: testUser{username: "robot$ci", robot: true, scopes: []string{"team/*:writer"}}, repository: "team/demo", want: false},
+		{name: "unauthenticated", registry: &Registry{}, user: testUser{}, repository: "*", want: false},
+		{name: "anonymous", registry: &Registry{}, user: testUser{anonymous: true}, repository: "*", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.registry.isAdmin(tt.user.request(), tt.repository); got != tt.want {
+				t.Errorf("isAdmin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
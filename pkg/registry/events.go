@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/notification"
+)
+
+// EventsHeartbeatInterval is the interval of comments sent to keep idle event streams alive through proxies.
+const EventsHeartbeatInterval = 30 * time.Second
+
+// StreamEvents streams the changes of versions as server-sent events, only the repositories the user can read are streamed.
+// query "repository" filters repositories by pattern, e.g. "project/*", and a client resumes from the event
+// in header "Last-Event-ID" or query "lastEventId", the events missed are sent first if still kept.
+func (s *Registry) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	if s.Events == nil {
+		ResponseError(w, errors.NewUnsupportedError("event stream is disabled"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ResponseError(w, errors.NewUnsupportedError("streaming is not supported"))
+		return
+	}
+	pattern := r.URL.Query().Get("repository")
+	if pattern == "" {
+		pattern = "*"
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	backlog, entries, cancel := s.Events.Subscribe(lastEventID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// disable response buffering of nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	write := func(entry notification.Entry) error {
+		if !MatchRepository(pattern, entry.Event.Repository) || !s.canRead(r, entry.Event.Repository) {
+			return nil
+		}
+		data, err := json.Marshal(entry.Event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", entry.ID, entry.Event.Action, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	for _, entry := range backlog {
+		if err := write(entry); err != nil {
+			return
+		}
+	}
+	heartbeat := time.NewTicker(EventsHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case entry, ok := <-entries:
+			if !ok {
+				// fell behind, the client reconnects and resumes from the last event received
+				return
+			}
+			if err := write(entry); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -2,18 +2,28 @@ package registry
 
 import (
 	"context"
+	"errors"
+	"os"
 	"time"
 )
 
+// ErrPreconditionFailed is returned by PutIfMatch when the object changed since its ETag was read.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
 type FsObjectMeta struct {
 	Name         string
 	Size         int64
 	LastModified time.Time
 	ContentType  string
+	// ETag changes on every write of the object, it is only set by Stat.
+	ETag string
 }
 
 type FSProvider interface {
 	Put(ctx context.Context, path string, content BlobContent) error
+	// PutIfMatch writes the object only if its current ETag equals etag,
+	// an empty etag means the object must not exist. It returns ErrPreconditionFailed otherwise.
+	PutIfMatch(ctx context.Context, path string, content BlobContent, etag string) error
 	Get(ctx context.Context, path string) (*BlobContent, error)
 	Stat(ctx context.Context, path string) (FsObjectMeta, error)
 	Remove(ctx context.Context, path string, recursive bool) error
@@ -32,6 +42,16 @@ func (s BlobContent) Read(p []byte) (int, error) {
 	return s.Content.Read(p)
 }
 
+// IsStorageNotFound reports whether err is a not found error of any FSProvider.
+func IsStorageNotFound(err error) bool {
+	return os.IsNotExist(err) || IsS3StorageNotFound(err)
+}
+
+// IsPreconditionFailed reports whether err means a conditional write lost to a concurrent one.
+func IsPreconditionFailed(err error) bool {
+	return errors.Is(err, ErrPreconditionFailed)
+}
+
 func StringDeref(ptr *string, def string) string {
 	if ptr != nil {
 		return *ptr
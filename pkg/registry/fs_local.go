@@ -1,13 +1,16 @@
 package registry
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	iopath "path"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 const (
@@ -29,6 +32,8 @@ var _ FSProvider = &LocalFSProvider{}
 
 type LocalFSProvider struct {
 	basepath string
+	// condmu serializes conditional writes, they are atomic within this process only.
+	condmu sync.Mutex
 }
 
 func NewLocalFSProvider(options *LocalFSOptions) (*LocalFSProvider, error) {
@@ -50,6 +55,28 @@ func (f *LocalFSProvider) Put(ctx context.Context, path string, content BlobCont
 	return f.writedata(path, content)
 }
 
+func (f *LocalFSProvider) PutIfMatch(ctx context.Context, path string, content BlobContent, etag string) error {
+	f.condmu.Lock()
+	defer f.condmu.Unlock()
+
+	current := ""
+	if fi, err := os.Stat(iopath.Join(f.basepath, path)); err == nil {
+		current = localETag(fi)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if current != etag {
+		return ErrPreconditionFailed
+	}
+	return f.Put(ctx, path, content)
+}
+
+// localETag derives an ETag from the modification time and size,
+// every write renames a new file into place so the ETag changes.
+func localETag(fi os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
+
 func (f *LocalFSProvider) Get(ctx context.Context, path string) (*BlobContent, error) {
 	meta, err := f.readmeta(path)
 	if err != nil {
@@ -60,9 +87,9 @@ func (f *LocalFSProvider) Get(ctx context.Context, path string) (*BlobContent, e
 		return nil, err
 	}
 	return &BlobContent{
-		ContentType: meta.ContentType,
-
-		Content: stream,
+		ContentType:   meta.ContentType,
+		ContentLength: meta.ContentLength,
+		Content:       stream,
 	}, nil
 }
 
@@ -95,6 +122,7 @@ func (f *LocalFSProvider) Stat(ctx context.Context, path string) (FsObjectMeta,
 		Size:         fi.Size(),
 		LastModified: fi.ModTime(),
 		ContentType:  meta.ContentType,
+		ETag:         localETag(fi),
 	}, nil
 }
 
@@ -105,7 +133,7 @@ func (f *LocalFSProvider) List(ctx context.Context, path string, recursive bool)
 			if err != nil {
 				return err
 			}
-			if strings.HasSuffix(path, ".meta") {
+			if strings.HasSuffix(path, ".meta") || strings.HasPrefix(d.Name(), ".tmp-") {
 				return nil
 			}
 			if d.IsDir() {
@@ -132,7 +160,7 @@ func (f *LocalFSProvider) List(ctx context.Context, path string, recursive bool)
 			return nil, err
 		}
 		for _, fi := range files {
-			if strings.HasSuffix(fi.Name(), ".meta") {
+			if strings.HasSuffix(fi.Name(), ".meta") || strings.HasPrefix(fi.Name(), ".tmp-") {
 				continue
 			}
 			if fi.IsDir() {
@@ -165,18 +193,33 @@ func (f *LocalFSProvider) writemeta(path string, content BlobContent) error {
 	if err := os.MkdirAll(iopath.Dir(metafile), DefaultDirMode); err != nil {
 		return err
 	}
-	return os.WriteFile(metafile, jsonData, DefaultFileMode)
+	// readers of the object may read the meta meanwhile, it must not be seen partially written
+	return writeFileAtomic(metafile, bytes.NewReader(jsonData))
 }
 
 func (f *LocalFSProvider) writedata(path string, content BlobContent) error {
-	datafile := iopath.Join(f.basepath, path)
-	fi, err := os.OpenFile(datafile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, DefaultFileMode)
+	return writeFileAtomic(iopath.Join(f.basepath, path), content.Content)
+}
+
+// writeFileAtomic writes to a temporary file then rename, so a failed write leaves nothing at filename.
+func writeFileAtomic(filename string, content io.Reader) error {
+	fi, err := os.CreateTemp(iopath.Dir(filename), ".tmp-"+iopath.Base(filename)+"-")
 	if err != nil {
 		return err
 	}
-	defer fi.Close()
-	_, err = io.Copy(fi, content.Content)
-	return err
+	defer os.Remove(fi.Name())
+	if _, err := io.Copy(fi, content); err != nil {
+		fi.Close()
+		return err
+	}
+	if err := fi.Chmod(DefaultFileMode); err != nil {
+		fi.Close()
+		return err
+	}
+	if err := fi.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fi.Name(), filename)
 }
 
 func (f *LocalFSProvider) getdata(path string) (io.ReadCloser, error) {
@@ -1,8 +1,11 @@
 package registry
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
@@ -94,6 +97,34 @@ func (m *S3StorageProvider) Put(ctx context.Context, path string, content BlobCo
 	}
 }
 
+// PutIfMatch uses the conditional writes of S3, the If-Match and If-None-Match headers are sent with the PutObject request.
+// A storage not supports conditional writes ignores the headers, then the last write wins.
+// The content is read into memory to sign the request, it is for small objects like index files.
+func (m *S3StorageProvider) PutIfMatch(ctx context.Context, path string, content BlobContent, etag string) error {
+	data, err := io.ReadAll(content.Content)
+	if err != nil {
+		return err
+	}
+	condition := http.AddHeaderValue("If-None-Match", "*")
+	if etag != "" {
+		condition = http.AddHeaderValue("If-Match", etag)
+	}
+	_, err = m.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(m.Bucket),
+		Key:           m.prefixedKey(path),
+		Body:          bytes.NewReader(data),
+		ContentLength: int64(len(data)),
+		ContentType:   aws.String(content.ContentType),
+	}, s3.WithAPIOptions(condition))
+	if err != nil {
+		if IsS3PreconditionFailed(err) {
+			return ErrPreconditionFailed
+		}
+		return modelxerrors.NewInternalError(err)
+	}
+	return nil
+}
+
 func (m *S3StorageProvider) Remove(ctx context.Context, path string, recursive bool) error {
 	if recursive {
 		prefix := m.prefixedKey(path)
@@ -133,6 +164,7 @@ func (m *S3StorageProvider) Remove(ctx context.Context, path string, recursive b
 	}
 }
 
+// Get requests the whole object at once, the size, type and ETag are of the response.
 func (m *S3StorageProvider) Get(ctx context.Context, path string) (*BlobContent, error) {
 	getobjout, err := m.Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(m.Bucket),
@@ -141,13 +173,87 @@ func (m *S3StorageProvider) Get(ctx context.Context, path string) (*BlobContent,
 	if err != nil {
 		return nil, err
 	}
+	body := &s3ObjectReader{
+		ctx:      ctx,
+		provider: m,
+		path:     path,
+		size:     getobjout.ContentLength,
+		etag:     getobjout.ETag,
+		body:     getobjout.Body,
+	}
 	return &BlobContent{
-		Content:       getobjout.Body,
+		Content:       body,
 		ContentType:   StringDeref(getobjout.ContentType, ""),
 		ContentLength: getobjout.ContentLength,
 	}, nil
 }
 
+// s3ObjectReader is a seekable reader of s3 object.
+// it reads the body of the object got, seeking costs no request, as http.ServeContent does to find the size,
+// only a read at another offset than the body requests the object again with a range start from the offset.
+type s3ObjectReader struct {
+	ctx        context.Context
+	provider   *S3StorageProvider
+	path       string
+	size       int64
+	etag       *string // the object read must be the one got
+	offset     int64
+	body       io.ReadCloser
+	bodyoffset int64 // the offset of the next read from body
+}
+
+func (r *s3ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body != nil && r.bodyoffset != r.offset {
+		r.body.Close()
+		r.body = nil
+	}
+	if r.body == nil {
+		getobjout, err := r.provider.Client.GetObject(r.ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(r.provider.Bucket),
+			Key:     r.provider.prefixedKey(r.path),
+			IfMatch: r.etag,
+			Range:   aws.String(fmt.Sprintf("bytes=%d-", r.offset)),
+		})
+		if err != nil {
+			return 0, err
+		}
+		r.body, r.bodyoffset = getobjout.Body, r.offset
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	r.bodyoffset += int64(n)
+	return n, err
+}
+
+func (r *s3ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *s3ObjectReader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
 func (m *S3StorageProvider) Exists(ctx context.Context, path string) (bool, error) {
 	_, err := m.Client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(m.Bucket),
@@ -178,6 +284,7 @@ func (m *S3StorageProvider) Stat(ctx context.Context, path string) (FsObjectMeta
 		Size:         headobjout.ContentLength,
 		LastModified: TimeDeref(headobjout.LastModified, time.Time{}),
 		ContentType:  StringDeref(headobjout.ContentType, ""),
+		ETag:         StringDeref(headobjout.ETag, ""),
 	}, nil
 }
 
@@ -230,6 +337,16 @@ func IsS3StorageNotFound(err error) bool {
 	return false
 }
 
+// IsS3PreconditionFailed reports whether a conditional write failed,
+// 409 is returned when a concurrent conditional write is in progress.
+func IsS3PreconditionFailed(err error) bool {
+	var apie *http.ResponseError
+	if errors.As(err, &apie) {
+		return apie.HTTPStatusCode() == 412 || apie.HTTPStatusCode() == 409
+	}
+	return false
+}
+
 func (m *S3StorageProvider) prefixedKey(key string) *string {
 	return aws.String(path.Join(m.Prefix, key))
 }
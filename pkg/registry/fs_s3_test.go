@@ -0,0 +1,237 @@
+package registry
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/exp/slices"
+)
+
+// fakeS3 serves the objects with the path style urls, it records the methods and ranges of requests.
+// it supports the object reads, writes with conditions, removals and listing used by the registry.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string]string
+	modified map[string]time.Time
+	requests []string
+	// beforePut is called before a put is applied, e.g. to change the object concurrently.
+	beforePut func(key string)
+}
+
+func fakeS3ETag(content string) string {
+	return `"` + digest.FromString(content).Encoded()[:16] + `"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && f.beforePut != nil {
+		f.beforePut(r.URL.Path)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.Header.Get("Range")))
+	if f.modified == nil {
+		f.modified = map[string]time.Time{}
+	}
+	// the bucket itself
+	if !strings.Contains(strings.Trim(r.URL.Path, "/"), "/") {
+		switch {
+		case r.Method == http.MethodGet:
+			f.list(w, r)
+		case r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+			f.deleteObjects(w, r)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+	content, ok := f.objects[r.URL.Path]
+	switch r.Method {
+	case http.MethodPut:
+		if (r.Header.Get("If-None-Match") == "*" && ok) ||
+			(r.Header.Get("If-Match") != "" && (!ok || r.Header.Get("If-Match") != fakeS3ETag(content))) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path], f.modified[r.URL.Path] = string(body), time.Now()
+		w.Header().Set("ETag", fakeS3ETag(string(body)))
+		return
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	etag := fakeS3ETag(content)
+	if match := r.Header.Get("If-Match"); match != "" && match != etag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", f.modified[r.URL.Path], strings.NewReader(content))
+}
+
+// list serves ListObjects, keys under a delimiter are omitted as the registry does not use common prefixes.
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	bucket := strings.Trim(r.URL.Path, "/")
+	prefix, delimiter := r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter")
+	result := struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Contents []struct {
+			Key          string
+			LastModified time.Time
+			Size         int64
+		}
+	}{}
+	keys := []string{}
+	for name := range f.objects {
+		key := strings.TrimPrefix(name, "/"+bucket+"/")
+		if !strings.HasPrefix(key, prefix) || (delimiter != "" && strings.Contains(strings.TrimPrefix(key, prefix), delimiter)) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		name := "/" + bucket + "/" + key
+		modified := f.modified[name]
+		if modified.IsZero() {
+			modified = time.Now()
+		}
+		result.Contents = append(result.Contents, struct {
+			Key          string
+			LastModified time.Time
+			Size         int64
+		}{Key: key, LastModified: modified.UTC(), Size: int64(len(f.objects[name]))})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// deleteObjects serves DeleteObjects.
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	bucket := strings.Trim(r.URL.Path, "/")
+	request := struct {
+		Objects []struct{ Key string } `xml:"Object"`
+	}{}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, object := range request.Objects {
+		delete(f.objects, "/"+bucket+"/"+object.Key)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(`<DeleteResult></DeleteResult>`))
+}
+
+func newTestS3Provider(t *testing.T, objects map[string]string) (*S3StorageProvider, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{objects: objects}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	provider, err := NewS3FSProvider(context.Background(), &S3Options{
+		URL:       server.URL,
+		Region:    "us-east-1",
+		Buket:     "bucket",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, fake
+}
+
+// newTestS3Store returns a S3RegistryStore on a fake s3.
+func newTestS3Store(t *testing.T) (*S3RegistryStore, *fakeS3) {
+	t.Helper()
+	provider, fake := newTestS3Provider(t, map[string]string{})
+	store := &FSRegistryStore{FS: provider}
+	if err := store.InitIndex(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return &S3RegistryStore{fs: store, provider: provider}, fake
+}
+
+func TestS3StorageProviderGetServeBlobContent(t *testing.T) {
+	content := "0123456789"
+	tests := []struct {
+		name         string
+		rangeHeader  string
+		wantBody     string
+		wantRequests []string
+	}{
+		{name: "whole object", wantBody: content, wantRequests: []string{"GET"}},
+		{name: "range", rangeHeader: "bytes=4-", wantBody: "456789", wantRequests: []string{"GET", "GET bytes=4-"}},
+		{name: "bounded range", rangeHeader: "bytes=2-4", wantBody: "234", wantRequests: []string{"GET", "GET bytes=2-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, fake := newTestS3Provider(t, map[string]string{"/bucket/registry/blobs/sha256/test": content})
+			blob, err := provider.Get(context.Background(), "blobs/sha256/test")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			defer blob.Content.Close()
+			if blob.ContentLength != int64(len(content)) {
+				t.Errorf("Get() content length = %d, want %d", blob.ContentLength, len(content))
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			rec := httptest.NewRecorder()
+			ServeBlobContent(rec, req, digest.FromString(content), blob)
+			if body, _ := io.ReadAll(rec.Body); string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if !slices.Equal(fake.requests, tt.wantRequests) {
+				t.Errorf("requests = %v, want %v", fake.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestS3StorageProviderGetNotFound(t *testing.T) {
+	provider, _ := newTestS3Provider(t, map[string]string{})
+	if _, err := provider.Get(context.Background(), "blobs/sha256/missing"); !IsStorageNotFound(err) {
+		t.Errorf("Get() error = %v, want not found", err)
+	}
+}
+
+func TestS3StorageProviderGetChanged(t *testing.T) {
+	objects := map[string]string{"/bucket/registry/index.json": "old"}
+	provider, _ := newTestS3Provider(t, objects)
+	blob, err := provider.Get(context.Background(), "index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Content.Close()
+	// overwritten after got, the content read from another offset must not mix up with the object got
+	objects["/bucket/registry/index.json"] = "newer"
+	if _, err := blob.Content.(io.Seeker).Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(blob.Content); err == nil {
+		t.Errorf("read of changed object expect error")
+	}
+}
@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// newTestFSProviders returns a local and a s3 provider.
+func newTestFSProviders(t *testing.T) map[string]FSProvider {
+	t.Helper()
+	local, err := NewLocalFSProvider(&LocalFSOptions{Basepath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3, _ := newTestS3Provider(t, map[string]string{})
+	return map[string]FSProvider{"local": local, "s3": s3}
+}
+
+func testContent(content string) BlobContent {
+	return BlobContent{ContentLength: int64(len(content)), Content: io.NopCloser(strings.NewReader(content))}
+}
+
+func TestFSProviderPutIfMatch(t *testing.T) {
+	ctx := context.Background()
+	for name, fs := range newTestFSProviders(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := fs.PutIfMatch(ctx, "index.json", testContent("v1"), ""); err != nil {
+				t.Fatalf("PutIfMatch() of a new object error = %v", err)
+			}
+			if err := fs.PutIfMatch(ctx, "index.json", testContent("v1 again"), ""); !IsPreconditionFailed(err) {
+				t.Fatalf("PutIfMatch() of an existing object without etag error = %v, want precondition failed", err)
+			}
+			meta, err := fs.Stat(ctx, "index.json")
+			if err != nil || meta.ETag == "" {
+				t.Fatalf("Stat() = %+v, %v, want an etag", meta, err)
+			}
+			if err := fs.PutIfMatch(ctx, "index.json", testContent("v2"), meta.ETag); err != nil {
+				t.Fatalf("PutIfMatch() of current etag error = %v", err)
+			}
+			// the etag read before the last write is stale
+			if err := fs.PutIfMatch(ctx, "index.json", testContent("v3"), meta.ETag); !IsPreconditionFailed(err) {
+				t.Fatalf("PutIfMatch() of stale etag error = %v, want precondition failed", err)
+			}
+			content, err := fs.Get(ctx, "index.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer content.Close()
+			if read, _ := io.ReadAll(content.Content); string(read) != "v2" {
+				t.Errorf("content = %q, want v2", read)
+			}
+		})
+	}
+}
@@ -2,67 +2,288 @@ package registry
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/types"
 )
 
-func GCBlobsAll(ctx context.Context, store RegistryStore) error {
-	globalindex, err := store.GetGlobalIndex(ctx, "")
+// DefaultGCGracePeriod keeps blobs uploaded recently, they may belong to a push whose manifest is not uploaded yet.
+const DefaultGCGracePeriod = time.Hour
+
+const (
+	GCBlobStatusReclaimable = "reclaimable"
+	GCBlobStatusRemoved     = "removed"
+	GCBlobStatusUnlinked    = "unlinked"
+)
+
+type GCOptions struct {
+	// DryRun reports the blobs to remove without removing them.
+	DryRun bool
+	// GracePeriod skips unused blobs and links modified within the period.
+	GracePeriod time.Duration
+}
+
+type GCResult struct {
+	DryRun bool `json:"dryRun"`
+	// ReclaimableBytes is the total size of unused blobs, they are removed unless dry run.
+	ReclaimableBytes int64 `json:"reclaimableBytes"`
+	// Blobs is the status of each unused blob or link, keyed by {repository}@{digest}.
+	Blobs map[string]string `json:"blobs"`
+}
+
+// blobKey identifies a blob by the repository holds its data.
+type blobKey struct {
+	repository string
+	digest     digest.Digest
+}
+
+// GCBlobsAll removes the unused blobs of all repositories.
+func GCBlobsAll(ctx context.Context, store RegistryStore, opts GCOptions) (*GCResult, error) {
+	repositories, err := store.ListRepositories(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, repository := range globalindex.Manifests {
-		if _, err := GCBlobs(ctx, store, repository.Name); err != nil {
-			return err
-		}
+	return gcBlobs(ctx, store, repositories, repositories, opts)
+}
+
+// GCBlobs removes the unused blobs of repository, blobs in use by any repository of the registry are kept.
+func GCBlobs(ctx context.Context, store RegistryStore, repository string, opts GCOptions) (*GCResult, error) {
+	repositories, err := store.ListRepositories(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return gcBlobs(ctx, store, repositories, []string{repository}, opts)
 }
 
-func GCBlobs(ctx context.Context, store RegistryStore, repository string) (map[digest.Digest]string, error) {
-	log := logr.FromContextOrDiscard(ctx).WithValues("repository", repository)
+func gcBlobs(ctx context.Context, store RegistryStore, all []string, sweep []string, opts GCOptions) (*GCResult, error) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("dryRun", opts.DryRun, "gracePeriod", opts.GracePeriod.String())
 
-	log.Info("star blobs garbage collect")
+	log.Info("start blobs garbage collect")
 	defer log.Info("stop blobs garbage collect")
 
-	manifests, err := store.GetIndex(ctx, repository, "")
+	dryrun := strconv.FormatBool(opts.DryRun)
+	// blobs and links modified after the deadline are kept, including those modified during mark
+	deadline := time.Now().Add(-opts.GracePeriod)
+	inuse, linksinuse, err := markBlobsInUse(ctx, store, all, deadline)
 	if err != nil {
+		gcRunsTotal.WithLabelValues("error", dryrun).Inc()
+		return nil, err
+	}
+	result := &GCResult{DryRun: opts.DryRun, Blobs: map[string]string{}}
+	for _, repository := range sweep {
+		if err := sweepBlobs(ctx, store, repository, inuse, deadline, opts.DryRun, result); err != nil {
+			gcRunsTotal.WithLabelValues("error", dryrun).Inc()
+			return nil, err
+		}
+		if err := sweepBlobLinks(ctx, store, repository, linksinuse, deadline, opts.DryRun, result); err != nil {
+			gcRunsTotal.WithLabelValues("error", dryrun).Inc()
+			return nil, err
+		}
+	}
+	gcRunsTotal.WithLabelValues("success", dryrun).Inc()
+	if !opts.DryRun {
+		gcReclaimedBytesTotal.Add(float64(result.ReclaimableBytes))
+	}
+	log.Info("blobs garbage collected", "reclaimableBytes", result.ReclaimableBytes, "blobs", len(result.Blobs))
+	return result, nil
+}
+
+// RunGC collects unused blobs of all repositories every interval until ctx done.
+func (s *Registry) RunGC(ctx context.Context, opts GCScheduleOptions) {
+	log := logr.FromContextOrDiscard(ctx).WithName("gc")
+	ctx = logr.NewContext(ctx, log)
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			unlock := s.lockGC()
+			_, err := GCBlobsAll(ctx, s.Store, GCOptions{DryRun: opts.DryRun, GracePeriod: opts.GracePeriod})
+			unlock()
+			if err != nil {
+				log.Error(err, "periodic garbage collect")
+			}
+		}
+	}
+}
+
+// lockGC locks out manifest puts and blob mounts for garbage collect and returns the function to unlock.
+// only those of this process are locked out, a manifest put on another replica may reference a blob being removed.
+func (s *Registry) lockGC() func() {
+	s.gcmu.Lock()
+	return s.gcmu.Unlock
+}
+
+// putManifest puts the manifest, it waits for the running garbage collect,
+// which could remove the blobs checked by the put.
+func (s *Registry) putManifest(ctx context.Context, repository string, reference string, contentType string, manifest types.Manifest) error {
+	s.gcmu.RLock()
+	defer s.gcmu.RUnlock()
+	return s.Store.PutManifest(ctx, repository, reference, contentType, manifest)
+}
+
+// mountBlob mounts the blob, it waits for the running garbage collect, which could remove the blob mounted.
+func (s *Registry) mountBlob(ctx context.Context, repository string, from string, dgst digest.Digest) error {
+	s.gcmu.RLock()
+	defer s.gcmu.RUnlock()
+	return s.Store.MountBlob(ctx, repository, from, dgst)
+}
+
+// markBlobsInUse returns the blobs referenced by manifests of all repositories, keyed by the repository holds the data,
+// and the links used by the repositories mounted them.
+// repositories should be listed from storage, a repository missing from the global index may still hold or link blobs.
+// links modified after deadline are in use, the blobs are mounted for a push whose manifest is not uploaded yet.
+func markBlobsInUse(ctx context.Context, store RegistryStore, repositories []string, deadline time.Time) (map[blobKey]struct{}, map[blobKey]struct{}, error) {
+	inuse := map[blobKey]struct{}{}
+	linksinuse := map[blobKey]struct{}{}
+	for _, repository := range repositories {
+		referenced, err := blobsReferenced(ctx, store, repository)
+		if err != nil {
+			return nil, nil, err
+		}
+		links, err := store.ListBlobLinks(ctx, repository)
+		if err != nil {
+			return nil, nil, err
+		}
+		for blobdigest := range referenced {
+			if link, ok := links[blobdigest]; ok {
+				linksinuse[blobKey{repository: repository, digest: blobdigest}] = struct{}{}
+				inuse[blobKey{repository: link.Holder, digest: blobdigest}] = struct{}{}
+				continue
+			}
+			inuse[blobKey{repository: repository, digest: blobdigest}] = struct{}{}
+		}
+		for blobdigest, link := range links {
+			if link.LastModified.After(deadline) {
+				linksinuse[blobKey{repository: repository, digest: blobdigest}] = struct{}{}
+				inuse[blobKey{repository: link.Holder, digest: blobdigest}] = struct{}{}
+			}
+		}
+	}
+	return inuse, linksinuse, nil
+}
+
+// blobsReferenced returns the blobs referenced by the tagged and untagged manifests of repository,
+// including the original manifests pushed via oci api, their configs and subjects.
+func blobsReferenced(ctx context.Context, store RegistryStore, repository string) (map[digest.Digest]struct{}, error) {
+	references := []string{}
+	index, err := store.GetIndex(ctx, repository, "")
+	if err != nil && !IsRegistryStoreNotNotFound(err) {
 		return nil, err
 	}
-	all, err := store.ListBlobs(ctx, repository)
+	for _, version := range index.Manifests {
+		references = append(references, version.Name)
+	}
+	digests, err := store.ListManifestDigests(ctx, repository)
 	if err != nil {
 		return nil, err
 	}
+	for _, manifestdigest := range digests {
+		references = append(references, manifestdigest.String())
+	}
 
-	inuse := map[digest.Digest]struct{}{}
-	for _, version := range manifests.Manifests {
-		manifest, err := store.GetManifest(ctx, repository, version.Name)
+	referenced := map[digest.Digest]struct{}{}
+	for _, reference := range references {
+		manifest, err := store.GetManifest(ctx, repository, reference)
 		if err != nil {
+			// removed after listed
+			if IsNotFoundOrUnknown(err) {
+				continue
+			}
 			return nil, err
 		}
 		for _, blob := range append(manifest.Blobs, manifest.Config) {
-			inuse[blob.Digest] = struct{}{}
+			referenced[blob.Digest] = struct{}{}
+		}
+		if original, ok := manifest.Annotations[AnnotationOCIManifest]; ok {
+			referenced[digest.Digest(original)] = struct{}{}
+		}
+		// the subject is kept while a manifest refers to it, it is a blob if it was pushed via oci api
+		config, subject := OCIManifestReferences(*manifest)
+		if config != nil {
+			referenced[config.Digest] = struct{}{}
+		}
+		if subject != nil {
+			referenced[subject.Digest] = struct{}{}
 		}
 	}
+	return referenced, nil
+}
 
-	toremove := map[digest.Digest]string{}
-	for _, blobdigest := range all {
-		if _, ok := inuse[blobdigest]; !ok {
-			log.WithValues("digest", blobdigest.String()).Info("mark blob unused")
-			toremove[blobdigest] = ""
+func sweepBlobs(ctx context.Context, store RegistryStore, repository string,
+	inuse map[blobKey]struct{}, deadline time.Time, dryrun bool, result *GCResult,
+) error {
+	log := logr.FromContextOrDiscard(ctx).WithValues("repository", repository)
+
+	blobs, err := store.ListBlobs(ctx, repository)
+	if err != nil {
+		return err
+	}
+	for _, blobdigest := range blobs {
+		if _, ok := inuse[blobKey{repository: repository, digest: blobdigest}]; ok {
+			continue
 		}
+		meta, err := store.GetBlobMeta(ctx, repository, blobdigest)
+		if err != nil {
+			if IsNotFoundOrUnknown(err) {
+				continue
+			}
+			return err
+		}
+		if meta.LastModified.After(deadline) {
+			continue
+		}
+		key := repository + "@" + blobdigest.String()
+		result.ReclaimableBytes += meta.ContentLength
+		if dryrun {
+			log.Info("unused blob", "digest", blobdigest.String(), "size", meta.ContentLength)
+			result.Blobs[key] = GCBlobStatusReclaimable
+			continue
+		}
+		if err := store.DeleteBlob(ctx, repository, blobdigest); err != nil {
+			log.Error(err, "remove unused blob", "digest", blobdigest.String())
+			return err
+		}
+		log.Info("removed unused blob", "digest", blobdigest.String(), "size", meta.ContentLength)
+		result.Blobs[key] = GCBlobStatusRemoved
 	}
+	return nil
+}
 
-	for digest := range toremove {
-		if err := store.DeleteBlob(ctx, repository, digest); err != nil {
-			log.WithValues("digest", digest.String()).Error(err, "remove unused blob")
-			toremove[digest] = err.Error()
-			return nil, err
-		} else {
-			log.WithValues("digest", digest.String()).Info("removed unused blob")
-			toremove[digest] = "removed"
+// sweepBlobLinks removes the links of blobs mounted into repository but no longer referenced by its manifests.
+func sweepBlobLinks(ctx context.Context, store RegistryStore, repository string,
+	linksinuse map[blobKey]struct{}, deadline time.Time, dryrun bool, result *GCResult,
+) error {
+	log := logr.FromContextOrDiscard(ctx).WithValues("repository", repository)
+
+	links, err := store.ListBlobLinks(ctx, repository)
+	if err != nil {
+		return err
+	}
+	for blobdigest, link := range links {
+		if _, ok := linksinuse[blobKey{repository: repository, digest: blobdigest}]; ok {
+			continue
 		}
+		if link.LastModified.After(deadline) {
+			continue
+		}
+		key := repository + "@" + blobdigest.String()
+		if dryrun {
+			result.Blobs[key] = GCBlobStatusUnlinked
+			continue
+		}
+		if err := store.DeleteBlob(ctx, repository, blobdigest); err != nil {
+			log.Error(err, "remove unused blob link", "digest", blobdigest.String())
+			return err
+		}
+		log.Info("removed unused blob link", "digest", blobdigest.String(), "holder", link.Holder)
+		result.Blobs[key] = GCBlobStatusUnlinked
 	}
-	return toremove, nil
+	return nil
 }
@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestGCBlobsAll(t *testing.T) {
+	ctx := context.Background()
+	store, basepath := newTestFSStore(t)
+
+	used := putTestBlob(t, store, "project/a", "used")
+	unused := putTestBlob(t, store, "project/a", "unused")
+	mounted := putTestBlob(t, store, "project/a", "mounted")
+	pending := putTestBlob(t, store, "project/a", "pending")
+	config := putTestBlob(t, store, "project/a", "{}")
+
+	manifest := testManifest(used)
+	raw, _ := json.Marshal(OCIDescriptor{MediaType: MediaTypeOCIEmptyJSON, Digest: config.Digest, Size: config.Size})
+	manifest.Annotations = map[string]string{AnnotationOCIConfig: string(raw)}
+	putTestManifest(t, store, "project/a", "v1", manifest)
+
+	// project/b references a blob mounted from project/a
+	if err := store.MountBlob(ctx, "project/b", "project/a", mounted.Digest); err != nil {
+		t.Fatal(err)
+	}
+	putTestManifest(t, store, "project/b", "v1", testManifest(mounted))
+	ageStorage(t, basepath, 2*time.Hour)
+
+	// mounted for a push whose manifest is not put yet
+	if err := store.MountBlob(ctx, "project/b", "project/a", pending.Digest); err != nil {
+		t.Fatal(err)
+	}
+	// uploaded within the grace period
+	fresh := putTestBlob(t, store, "project/a", "fresh")
+
+	result, err := GCBlobsAll(ctx, store, GCOptions{GracePeriod: time.Hour})
+	if err != nil {
+		t.Fatalf("GCBlobsAll() error = %v", err)
+	}
+	want := map[string]string{"project/a@" + unused.Digest.String(): GCBlobStatusRemoved}
+	if len(result.Blobs) != len(want) || result.Blobs["project/a@"+unused.Digest.String()] != GCBlobStatusRemoved {
+		t.Fatalf("GCBlobsAll() blobs = %v, want %v", result.Blobs, want)
+	}
+	if result.ReclaimableBytes != unused.Size {
+		t.Errorf("GCBlobsAll() reclaimable = %d, want %d", result.ReclaimableBytes, unused.Size)
+	}
+
+	tests := []struct {
+		name       string
+		repository string
+		digest     digest.Digest
+		want       bool
+	}{
+		{name: "referenced", repository: "project/a", digest: used.Digest, want: true},
+		{name: "oci config", repository: "project/a", digest: config.Digest, want: true},
+		{name: "unreferenced", repository: "project/a", digest: unused.Digest, want: false},
+		{name: "referenced via mount", repository: "project/b", digest: mounted.Digest, want: true},
+		{name: "fresh link", repository: "project/b", digest: pending.Digest, want: true},
+		{name: "fresh blob", repository: "project/a", digest: fresh.Digest, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := store.ExistsBlob(ctx, tt.repository, tt.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists != tt.want {
+				t.Errorf("ExistsBlob(%s@%s) = %v, want %v", tt.repository, tt.digest, exists, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCBlobsDryRunAndUnlink(t *testing.T) {
+	ctx := context.Background()
+	store, basepath := newTestFSStore(t)
+
+	blob := putTestBlob(t, store, "project/a", "weights")
+	putTestManifest(t, store, "project/a", "v1", testManifest(blob))
+	if err := store.MountBlob(ctx, "project/b", "project/a", blob.Digest); err != nil {
+		t.Fatal(err)
+	}
+	putTestManifest(t, store, "project/b", "v1", testManifest(blob))
+	if err := store.DeleteManifest(ctx, "project/b", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	ageStorage(t, basepath, 2*time.Hour)
+
+	key := "project/b@" + blob.Digest.String()
+	result, err := GCBlobs(ctx, store, "project/b", GCOptions{DryRun: true, GracePeriod: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Blobs[key] != GCBlobStatusUnlinked || len(result.Blobs) != 1 {
+		t.Fatalf("dry run blobs = %v, want %s unlinked", result.Blobs, key)
+	}
+	if links, _ := store.ListBlobLinks(ctx, "project/b"); len(links) != 1 {
+		t.Fatalf("dry run removed the link")
+	}
+
+	if _, err := GCBlobs(ctx, store, "project/b", GCOptions{GracePeriod: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if links, _ := store.ListBlobLinks(ctx, "project/b"); len(links) != 0 {
+		t.Errorf("links = %v, want unlinked", links)
+	}
+	// the holder keeps the blob still referenced by its own manifest
+	if exists, _ := store.ExistsBlob(ctx, "project/a", blob.Digest); !exists {
+		t.Errorf("blob of project/a removed")
+	}
+}
+
+func TestGCBlobsRepositoryNotIndexed(t *testing.T) {
+	ctx := context.Background()
+	store, basepath := newTestFSStore(t)
+
+	blob := putTestBlob(t, store, "project/a", "weights")
+	// project/b has an untagged manifest only, it is not in the global index
+	if err := store.MountBlob(ctx, "project/b", "project/a", blob.Digest); err != nil {
+		t.Fatal(err)
+	}
+	manifest := testManifest(blob)
+	contentDigest, _ := manifest.Digest()
+	putTestManifest(t, store, "project/b", contentDigest.String(), manifest)
+	ageStorage(t, basepath, 2*time.Hour)
+
+	if index, _ := store.GetGlobalIndex(ctx, ""); len(index.Manifests) != 0 {
+		t.Fatalf("global index = %v, want empty", index.Manifests)
+	}
+	repositories, err := store.ListRepositories(ctx)
+	if err != nil || len(repositories) != 2 || repositories[0] != "project/a" || repositories[1] != "project/b" {
+		t.Fatalf("ListRepositories() = %v, %v, want project/a and project/b", repositories, err)
+	}
+	if _, err := GCBlobs(ctx, store, "project/a", GCOptions{GracePeriod: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := store.ExistsBlob(ctx, "project/a", blob.Digest); !exists {
+		t.Error("blob referenced by a repository not indexed removed")
+	}
+}
+
+func TestRegistryPutManifestWaitsForGC(t *testing.T) {
+	ctx := context.Background()
+	store, basepath := newTestFSStore(t)
+	s := &Registry{Store: store}
+
+	blob := putTestBlob(t, store, "project/a", "weights")
+	putTestManifest(t, store, "project/a", "v1", testManifest(blob))
+	if err := store.DeleteManifest(ctx, "project/a", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	ageStorage(t, basepath, 2*time.Hour)
+
+	unlock := s.lockGC()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.putManifest(ctx, "project/a", "v2", MediaTypeModelManifestJson, testManifest(blob))
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("putManifest() returned while gc running, error = %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// gc removes the unreferenced blob, the put then fails instead of publishing a version without it
+	if _, err := GCBlobs(ctx, store, "project/a", GCOptions{GracePeriod: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if err := <-done; err == nil {
+		t.Fatal("putManifest() expect error of the blob removed by gc")
+	}
+}
@@ -4,17 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
-	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/go-logr/logr"
+	"kubegems.io/modelx/pkg/auth"
 	apierr "kubegems.io/modelx/pkg/errors"
 )
 
-const MediaTypeModelIndexJson = "application/vnd.modelx.model.index.v1.json"
+const (
+	MediaTypeModelIndexJson      = "application/vnd.modelx.model.index.v1.json"
+	MediaTypeModelManifestJson   = "application/vnd.modelx.model.manifest.v1.json"
+	MediaTypeModelConfigYaml     = "application/vnd.modelx.model.config.v1.yaml"
+	MediaTypeModelFile           = "application/vnd.modelx.model.file.v1"
+	MediaTypeModelDirectoryTarGz = "application/vnd.modelx.model.directory.v1.tar+gz"
+)
 
 const MaxBytesRead = int64(1 << 20) // 1MB
 
@@ -47,6 +53,16 @@ func ResponseOK(w http.ResponseWriter, data any) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// MatchRepository reports whether repository matches pattern, "*" matches all repositories,
+// others are matched by path.Match, e.g. "project/*" matches all repositories of project.
+func MatchRepository(pattern, repository string) bool {
+	if pattern == "*" {
+		return true
+	}
+	ok, _ := path.Match(pattern, repository)
+	return ok
+}
+
 type contextUsernameKey struct{}
 
 func UsernameFromContext(ctx context.Context) string {
@@ -60,38 +76,121 @@ func NewUsernameContext(ctx context.Context, username string) context.Context {
 	return context.WithValue(ctx, contextUsernameKey{}, username)
 }
 
-func NewOIDCAuthFilter(ctx context.Context, issuer string, next http.Handler) http.Handler {
-	ctx = oidc.InsecureIssuerURLContext(ctx, issuer)
-	provider, err := oidc.NewProvider(ctx, issuer)
-	if err != nil {
-		log.Fatal(err)
+type contextGroupsKey struct{}
+
+func GroupsFromContext(ctx context.Context) []string {
+	if groups, ok := ctx.Value(contextGroupsKey{}).([]string); ok {
+		return groups
 	}
-	verifier := provider.Verifier(&oidc.Config{
-		SkipClientIDCheck: true,
-		SkipIssuerCheck:   true,
-	})
+	return nil
+}
+
+func NewGroupsContext(ctx context.Context, groups []string) context.Context {
+	return context.WithValue(ctx, contextGroupsKey{}, groups)
+}
+
+type contextScopesKey struct{}
+
+// ScopesFromContext returns the scopes limit the token of request, nil means not limited.
+func ScopesFromContext(ctx context.Context) []string {
+	if scopes, ok := ctx.Value(contextScopesKey{}).([]string); ok {
+		return scopes
+	}
+	return nil
+}
+
+func NewScopesContext(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, contextScopesKey{}, scopes)
+}
+
+type contextRobotKey struct{}
+
+// IsRobotFromContext reports whether the user is a robot account, robots are authorized by their scopes only.
+func IsRobotFromContext(ctx context.Context) bool {
+	robot, _ := ctx.Value(contextRobotKey{}).(bool)
+	return robot
+}
+
+func NewRobotContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextRobotKey{}, true)
+}
+
+type contextAnonymousKey struct{}
+
+// IsAnonymousFromContext reports whether the request has no credentials while authentication is enabled.
+func IsAnonymousFromContext(ctx context.Context) bool {
+	anonymous, _ := ctx.Value(contextAnonymousKey{}).(bool)
+	return anonymous
+}
+
+func NewAnonymousContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextAnonymousKey{}, true)
+}
+
+// NewAuthFilter authenticates the bearer token or basic credentials of requests, and sets the user into request context.
+// passwords may be nil if basic auth is disabled.
+// the challenges of enabled schemes are kept on responses of unauthenticated requests, docker and oras send credentials only after a challenge.
+func NewAuthFilter(tokens auth.TokenAuthenticator, passwords auth.PasswordAuthenticator, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		headerAuthorzation := r.Header.Get("Authorization")
-		token := strings.TrimPrefix(headerAuthorzation, "Bearer ")
-		if token == "" {
-			queries := r.URL.Query()
-			for _, k := range []string{"token", "access_token"} {
-				if token = queries.Get(k); token != "" {
-					break
+		if passwords != nil {
+			w.Header().Add("WWW-Authenticate", `Basic realm="modelx"`)
+		}
+		if tokens != nil {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="modelx"`)
+		}
+		var user *auth.UserInfo
+		var err error
+		if username, password, ok := r.BasicAuth(); ok {
+			if passwords == nil {
+				ResponseError(w, apierr.NewUnauthorizedError("basic auth is not supported"))
+				return
+			}
+			user, err = passwords.AuthenticatePassword(r.Context(), username, password)
+		} else {
+			headerAuthorzation := r.Header.Get("Authorization")
+			token := strings.TrimPrefix(headerAuthorzation, "Bearer ")
+			if token == "" {
+				queries := r.URL.Query()
+				for _, k := range []string{"token", "access_token"} {
+					if token = queries.Get(k); token != "" {
+						break
+					}
 				}
 			}
+			if len(token) == 0 {
+				// anonymous requests can read public projects only, checked by handlers
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					next.ServeHTTP(w, r.WithContext(NewAnonymousContext(r.Context())))
+					return
+				}
+				ResponseError(w, apierr.NewUnauthorizedError("missing access token"))
+				return
+			}
+			if tokens == nil {
+				ResponseError(w, apierr.NewUnauthorizedError("bearer token is not supported"))
+				return
+			}
+			user, err = tokens.Authenticate(r.Context(), token)
 		}
-		if len(token) == 0 {
-			ResponseError(w, apierr.NewUnauthorizedError("missing access token"))
-			return
-		}
-		idtoken, err := verifier.Verify(r.Context(), token)
 		if err != nil {
-			ResponseError(w, apierr.NewUnauthorizedError("invalid access token"))
+			if errors.Is(err, auth.ErrUnauthenticated) {
+				ResponseError(w, apierr.NewUnauthorizedError("invalid credentials"))
+			} else {
+				logr.FromContextOrDiscard(r.Context()).Error(err, "authenticate")
+				ResponseError(w, apierr.NewInternalError(err))
+			}
 			return
 		}
-		r.WithContext(NewUsernameContext(r.Context(), idtoken.Subject))
-		next.ServeHTTP(w, r)
+		w.Header().Del("WWW-Authenticate")
+		ctx := NewUsernameContext(r.Context(), user.Username)
+		ctx = NewGroupsContext(ctx, user.Groups)
+		if len(user.Scopes) > 0 {
+			ctx = NewScopesContext(ctx, user.Scopes)
+		}
+		if user.Robot {
+			ctx = NewRobotContext(ctx)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
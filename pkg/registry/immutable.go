@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"gopkg.in/yaml.v3"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// ImmutabilityPolicy is the immutability rules of repositories, loaded from the immutability config file.
+//
+//	rules:
+//	  - repository: "*"
+//	    tags: ["v*"]
+type ImmutabilityPolicy struct {
+	Rules []ImmutabilityRule `json:"rules" yaml:"rules"`
+}
+
+type ImmutabilityRule struct {
+	// Repository selects the repositories the rule applies to,
+	// "project/name" for a repository, "project/*" for all repositories of a project and "*" for all repositories.
+	Repository string `json:"repository" yaml:"repository"`
+	// Tags are patterns of versions can not be overwritten or deleted, e.g. "v*".
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+func LoadImmutabilityPolicy(file string) (*ImmutabilityPolicy, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &ImmutabilityPolicy{}
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("parse immutability config %s: %w", file, err)
+	}
+	for i, rule := range policy.Rules {
+		if _, err := path.Match(rule.Repository, ""); err != nil || rule.Repository == "" {
+			return nil, fmt.Errorf("immutability config %s: rule %d: invalid repository pattern %q", file, i, rule.Repository)
+		}
+		for _, tag := range rule.Tags {
+			if _, err := path.Match(tag, ""); err != nil || tag == "" {
+				return nil, fmt.Errorf("immutability config %s: rule %d: invalid tag pattern %q", file, i, tag)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// IsImmutable reports whether the version of repository matches any rule.
+func (p *ImmutabilityPolicy) IsImmutable(repository, version string) bool {
+	if p == nil {
+		return false
+	}
+	for _, rule := range p.Rules {
+		if !MatchRepository(rule.Repository, repository) {
+			continue
+		}
+		for _, tag := range rule.Tags {
+			if ok, _ := path.Match(tag, version); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MarkImmutable sets the immutable flag of the versions in index.
+func (p *ImmutabilityPolicy) MarkImmutable(repository string, index *types.Index) {
+	for i := range index.Manifests {
+		index.Manifests[i].Immutable = p.IsImmutable(repository, index.Manifests[i].Name)
+	}
+}
+
+// checkOverwrite denies to overwrite an existing immutable version with different content.
+// The repository is locked until the returned unlock is called after the put, so concurrent pushes
+// of a new immutable version can not both pass the check.
+func (s *Registry) checkOverwrite(r *http.Request, repository, version string, unchanged func(existing *types.Manifest) bool) (func(), error) {
+	if !s.Immutability.IsImmutable(repository, version) {
+		return func() {}, nil
+	}
+	unlock := s.immutableLocks.Lock(repository)
+	existing, err := s.Store.GetManifest(r.Context(), repository, version)
+	if err != nil {
+		if IsNotFoundOrUnknown(err) {
+			return unlock, nil
+		}
+		unlock()
+		return nil, err
+	}
+	if unchanged(existing) {
+		return unlock, nil
+	}
+	if err := s.denyImmutable(r, repository, version, "overwritten"); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// checkDelete denies to delete any immutable version of versions.
+func (s *Registry) checkDelete(r *http.Request, repository string, versions ...string) error {
+	for _, version := range versions {
+		if !s.Immutability.IsImmutable(repository, version) {
+			continue
+		}
+		if err := s.denyImmutable(r, repository, version, "deleted"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// denyImmutable returns a denied error, unless an admin forces the request with "?force=true".
+func (s *Registry) denyImmutable(r *http.Request, repository, version string, action string) error {
+	if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force && s.isAdmin(r, repository) {
+		logr.FromContextOrDiscard(r.Context()).Info("immutable version forced",
+			"repository", repository, "version", version, "action", action, "username", UsernameFromContext(r.Context()))
+		return nil
+	}
+	return errors.NewDeniedError(fmt.Sprintf("version %s of %s is immutable and can not be %s", version, repository, action))
+}
@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func newTestImmutableRegistry(t *testing.T) *Registry {
+	t.Helper()
+	store, _ := newTestFSStore(t)
+	return &Registry{
+		Store:        store,
+		Authorizer:   newTestAuthorizer(t),
+		Immutability: &ImmutabilityPolicy{Rules: []ImmutabilityRule{{Repository: "team/*", Tags: []string{"v*"}}}},
+	}
+}
+
+// serveAs calls the api of s as user, returns the status and error code.
+func serveAs(t *testing.T, s *Registry, user testUser, method, target string, body []byte) (int, errors.ErrCode) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, bytes.NewReader(body)).WithContext(user.request().Context())
+	rec := httptest.NewRecorder()
+	s.route().ServeHTTP(rec, req)
+	info := errors.ErrorInfo{}
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	return rec.Code, info.Code
+}
+
+func testManifestContent(t *testing.T, s *Registry, repository, blob string) []byte {
+	t.Helper()
+	content, err := json.Marshal(testManifest(putTestBlob(t, s.Store, repository, blob)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestRegistryImmutableVersions(t *testing.T) {
+	admin := testUser{username: "alice"}
+	writer := testUser{username: "bob", groups: []string{"ml-team"}}
+	repository := "team/model"
+
+	tests := []struct {
+		name     string
+		user     testUser
+		method   string
+		target   string
+		blob     string
+		wantCode int
+		wantErr  errors.ErrCode
+	}{
+		{name: "overwrite", user: writer, method: http.MethodPut, target: "/manifests/v1", blob: "weights v2", wantCode: http.StatusForbidden, wantErr: errors.ErrCodeDenied},
+		{name: "identical re-push", user: writer, method: http.MethodPut, target: "/manifests/v1", blob: "weights v1", wantCode: http.StatusCreated},
+		{name: "mutable version", user: writer, method: http.MethodPut, target: "/manifests/dev", blob: "weights v2", wantCode: http.StatusCreated},
+		{name: "delete by tag", user: writer, method: http.MethodDelete, target: "/manifests/v1", wantCode: http.StatusForbidden, wantErr: errors.ErrCodeDenied},
+		{name: "delete by digest", user: writer, method: http.MethodDelete, target: "/manifests/{digest}", wantCode: http.StatusForbidden, wantErr: errors.ErrCodeDenied},
+		{name: "delete repository", user: admin, method: http.MethodDelete, target: "/index", wantCode: http.StatusForbidden, wantErr: errors.ErrCodeDenied},
+		{name: "force by writer", user: writer, method: http.MethodPut, target: "/manifests/v1?force=true", blob: "weights v2", wantCode: http.StatusForbidden, wantErr: errors.ErrCodeDenied},
+		{name: "delete forced by writer", user: writer, method: http.MethodDelete, target: "/manifests/v1?force=true", wantCode: http.StatusForbidden, wantErr: errors.ErrCodeDenied},
+		{name: "force by admin", user: admin, method: http.MethodPut, target: "/manifests/v1?force=true", blob: "weights v2", wantCode: http.StatusCreated},
+		{name: "delete forced by admin", user: admin, method: http.MethodDelete, target: "/manifests/v1?force=true", wantCode: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestImmutableRegistry(t)
+			manifest := testManifest(putTestBlob(t, s.Store, repository, "weights v1"))
+			putTestManifest(t, s.Store, repository, "v1", manifest)
+			dgst, _ := manifest.Digest()
+
+			var body []byte
+			if tt.blob != "" {
+				body = testManifestContent(t, s, repository, tt.blob)
+			}
+			target := "/" + repository + tt.target
+			if tt.target == "/manifests/{digest}" {
+				target = "/" + repository + "/manifests/" + dgst.String()
+			}
+			code, errcode := serveAs(t, s, tt.user, tt.method, target, body)
+			if code != tt.wantCode || errcode != tt.wantErr {
+				t.Fatalf("%s %s status = %d %q, want %d %q", tt.method, target, code, errcode, tt.wantCode, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				// unchanged after denied
+				existing, err := s.Store.GetManifest(context.Background(), repository, "v1")
+				if err != nil {
+					t.Fatalf("v1 removed after denied: %v", err)
+				}
+				if existingDigest, _ := existing.Digest(); existingDigest != dgst {
+					t.Errorf("v1 = %s after denied, want %s", existingDigest, dgst)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistryGetIndexMarksImmutable(t *testing.T) {
+	s := newTestImmutableRegistry(t)
+	repository := "team/model"
+	for _, version := range []string{"v1", "dev"} {
+		putTestManifest(t, s.Store, repository, version, testManifest(putTestBlob(t, s.Store, repository, "weights "+version)))
+	}
+	req := httptest.NewRequest(http.MethodGet, "/"+repository+"/index", nil).WithContext(testUser{username: "bob"}.request().Context())
+	rec := httptest.NewRecorder()
+	s.route().ServeHTTP(rec, req)
+	index := types.Index{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &index); err != nil {
+		t.Fatalf("GET index status = %d, body = %s", rec.Code, rec.Body)
+	}
+	got := map[string]bool{}
+	for _, version := range index.Manifests {
+		got[version.Name] = version.Immutable
+	}
+	if len(got) != 2 || !got["v1"] || got["dev"] {
+		t.Errorf("immutable of versions = %v, want v1 only", got)
+	}
+}
+
+// barrierStore holds the manifest reads of a version after read until n reads arrive or timeout,
+// so the checks of concurrent pushes all read before any put unless they are serialized.
+type barrierStore struct {
+	RegistryStore
+	version string
+	n       int
+	timeout time.Duration
+
+	mu      sync.Mutex
+	arrived int
+	ready   chan struct{}
+}
+
+func (b *barrierStore) GetManifest(ctx context.Context, repository string, reference string) (*types.Manifest, error) {
+	manifest, err := b.RegistryStore.GetManifest(ctx, repository, reference)
+	if reference == b.version {
+		b.mu.Lock()
+		if b.arrived++; b.arrived == b.n {
+			close(b.ready)
+		}
+		b.mu.Unlock()
+		select {
+		case <-b.ready:
+		case <-time.After(b.timeout):
+		}
+	}
+	return manifest, err
+}
+
+func TestRegistryImmutableConcurrentPush(t *testing.T) {
+	s := newTestImmutableRegistry(t)
+	repository := "team/model"
+	s.Store = &barrierStore{RegistryStore: s.Store, version: "v1", n: 2, timeout: 200 * time.Millisecond, ready: make(chan struct{})}
+	bodies := [][]byte{testManifestContent(t, s, repository, "weights a"), testManifestContent(t, s, repository, "weights b")}
+
+	codes := make([]int, len(bodies))
+	wg := sync.WaitGroup{}
+	for i, body := range bodies {
+		wg.Add(1)
+		go func(i int, body []byte) {
+			defer wg.Done()
+			codes[i], _ = serveAs(t, s, testUser{username: "bob", groups: []string{"ml-team"}}, http.MethodPut, "/"+repository+"/manifests/v1", body)
+		}(i, body)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		if code == http.StatusCreated {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("concurrent pushes of a new immutable version status = %v, want only one created", codes)
+	}
+}
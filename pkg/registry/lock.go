@@ -0,0 +1,41 @@
+package registry
+
+import "sync"
+
+// KeyedMutex provides a mutex for each key, the mutex of a key is dropped once no one holds or waits for it.
+// The zero value is ready to use.
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock locks key and returns the function to unlock it.
+func (k *KeyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
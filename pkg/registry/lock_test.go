@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	k := &KeyedMutex{}
+
+	// the same key is serialized
+	counter, running, overlapped := 0, 0, false
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := k.Lock("project/a")
+			defer unlock()
+			mu.Lock()
+			running++
+			overlapped = overlapped || running > 1
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			counter++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if overlapped || counter != 20 {
+		t.Errorf("holders overlapped %v, counter = %d, want serialized 20", overlapped, counter)
+	}
+
+	// other keys are not blocked
+	unlock := k.Lock("project/a")
+	locked := make(chan struct{})
+	go func() {
+		k.Lock("project/b")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("lock of another key blocked")
+	}
+	unlock()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.locks) != 0 {
+		t.Errorf("locks = %v, want dropped after unlocked", k.locks)
+	}
+}
@@ -0,0 +1,225 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// MetadataDBOpenTimeout is how long to wait for the lock of the database, it's locked by the running modelxd.
+const MetadataDBOpenTimeout = time.Second
+
+var (
+	repositoriesBucket = []byte("repositories")
+	metaBucket         = []byte("meta")
+	indexedKey         = []byte("indexed")
+)
+
+// MetadataDB keeps the versions of repositories in an embedded database, indexes are served from it
+// instead of the index files, and every change of versions is a transaction.
+//
+// The database is a file local to a modelxd, so modelxd must run as a single replica when it's used:
+// another replica serves its own database, which never sees the versions changed here until reindexed.
+// It's rebuilt from storage by Reindex.
+type MetadataDB struct {
+	db *bolt.DB
+}
+
+func OpenMetadataDB(path string) (*MetadataDB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: MetadataDBOpenTimeout})
+	if err != nil {
+		if err == bolt.ErrTimeout {
+			return nil, fmt.Errorf("metadata database %s is locked by another process", path)
+		}
+		return nil, fmt.Errorf("open metadata database %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(repositoriesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &MetadataDB{db: db}, nil
+}
+
+func (m *MetadataDB) Close() error {
+	return m.db.Close()
+}
+
+// Indexed reports whether the database has been built from storage.
+func (m *MetadataDB) Indexed() bool {
+	indexed := false
+	_ = m.db.View(func(tx *bolt.Tx) error {
+		indexed = tx.Bucket(metaBucket).Get(indexedKey) != nil
+		return nil
+	})
+	return indexed
+}
+
+// PutVersion adds or replaces the version desc.Name of repository.
+func (m *MetadataDB) PutVersion(repository string, desc types.Descriptor) error {
+	content, err := json.Marshal(desc)
+	if err != nil {
+		return err
+	}
+	return m.db.Update(func(tx *bolt.Tx) error {
+		versions, err := tx.Bucket(repositoriesBucket).CreateBucketIfNotExists([]byte(repository))
+		if err != nil {
+			return err
+		}
+		return versions.Put([]byte(desc.Name), content)
+	})
+}
+
+// RemoveVersions removes the versions of repository, the repository is removed if no versions left.
+func (m *MetadataDB) RemoveVersions(repository string, names ...string) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		repositories := tx.Bucket(repositoriesBucket)
+		versions := repositories.Bucket([]byte(repository))
+		if versions == nil {
+			return nil
+		}
+		for _, name := range names {
+			if err := versions.Delete([]byte(name)); err != nil {
+				return err
+			}
+		}
+		if k, _ := versions.Cursor().First(); k == nil {
+			return repositories.DeleteBucket([]byte(repository))
+		}
+		return nil
+	})
+}
+
+func (m *MetadataDB) RemoveRepository(repository string) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(repositoriesBucket).DeleteBucket([]byte(repository)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// GetIndex returns the index of repository, ErrRegistryStoreNotFound if the repository has no versions.
+func (m *MetadataDB) GetIndex(repository string) (types.Index, error) {
+	index := types.Index{}
+	err := m.db.View(func(tx *bolt.Tx) error {
+		versions := tx.Bucket(repositoriesBucket).Bucket([]byte(repository))
+		if versions == nil {
+			return ErrRegistryStoreNotFound
+		}
+		manifests, err := readVersions(versions)
+		if err != nil {
+			return err
+		}
+		index = newIndex(manifests)
+		return nil
+	})
+	return index, err
+}
+
+// GetGlobalIndex returns the index of all repositories.
+func (m *MetadataDB) GetGlobalIndex() (types.Index, error) {
+	globalindex := types.Index{Manifests: []types.Descriptor{}}
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(repositoriesBucket).ForEachBucket(func(repository []byte) error {
+			manifests, err := readVersions(tx.Bucket(repositoriesBucket).Bucket(repository))
+			if err != nil {
+				return err
+			}
+			globalindex.Manifests = append(globalindex.Manifests, repositoryDescriptor(string(repository), newIndex(manifests)))
+			return nil
+		})
+	})
+	return globalindex, err
+}
+
+// Replace replaces all repositories with indexes in a transaction, and marks the database indexed.
+func (m *MetadataDB) Replace(indexes map[string][]types.Descriptor) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(repositoriesBucket); err != nil {
+			return err
+		}
+		repositories, err := tx.CreateBucket(repositoriesBucket)
+		if err != nil {
+			return err
+		}
+		for repository, manifests := range indexes {
+			if len(manifests) == 0 {
+				continue
+			}
+			versions, err := repositories.CreateBucket([]byte(repository))
+			if err != nil {
+				return err
+			}
+			for _, desc := range manifests {
+				content, err := json.Marshal(desc)
+				if err != nil {
+					return err
+				}
+				if err := versions.Put([]byte(desc.Name), content); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Bucket(metaBucket).Put(indexedKey, []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+}
+
+func readVersions(versions *bolt.Bucket) ([]types.Descriptor, error) {
+	manifests := []types.Descriptor{}
+	err := versions.ForEach(func(_, v []byte) error {
+		desc := types.Descriptor{}
+		if err := json.Unmarshal(v, &desc); err != nil {
+			return err
+		}
+		manifests = append(manifests, desc)
+		return nil
+	})
+	return manifests, err
+}
+
+// newIndex returns the index of manifests sorted by name, the annotations of the first manifest has are the index annotations.
+func newIndex(manifests []types.Descriptor) types.Index {
+	slices.SortFunc(manifests, func(a, b types.Descriptor) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	index := types.Index{Manifests: manifests}
+	// use the annotations of the latest version has annotations
+	var modified time.Time
+	for _, manifest := range manifests {
+		if manifest.Annotations != nil && (index.Annotations == nil || manifest.Modified.After(modified)) {
+			index.Annotations, modified = manifest.Annotations, manifest.Modified
+		}
+	}
+	return index
+}
+
+// repositoryDescriptor describes repository in the global index by its latest version.
+func repositoryDescriptor(repository string, index types.Index) types.Descriptor {
+	desc := types.Descriptor{
+		Name:        repository,
+		MediaType:   MediaTypeModelIndexJson,
+		Annotations: index.Annotations,
+	}
+	for _, manifest := range index.Manifests {
+		if manifest.Modified.After(desc.Modified) {
+			desc.Modified, desc.Size = manifest.Modified, manifest.Size
+		}
+	}
+	return desc
+}
@@ -0,0 +1,214 @@
+package registry
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func openTestMetadataDB(t *testing.T, path string) *MetadataDB {
+	t.Helper()
+	db, err := OpenMetadataDB(path)
+	if err != nil {
+		t.Fatalf("OpenMetadataDB() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func indexNames(index types.Index) []string {
+	names := []string{}
+	for _, desc := range index.Manifests {
+		names = append(names, desc.Name)
+	}
+	return names
+}
+
+func TestMetadataDBVersions(t *testing.T) {
+	db := openTestMetadataDB(t, filepath.Join(t.TempDir(), "metadata.db"))
+	now := time.Now().UTC().Truncate(time.Second)
+
+	put := func(repository string, desc types.Descriptor) {
+		t.Helper()
+		if err := db.PutVersion(repository, desc); err != nil {
+			t.Fatalf("PutVersion() error = %v", err)
+		}
+	}
+	put("project/a", types.Descriptor{Name: "v2", Size: 2, Modified: now.Add(-time.Hour), Annotations: map[string]string{"framework": "old"}})
+	put("project/a", types.Descriptor{Name: "v1", Size: 1, Modified: now.Add(-2 * time.Hour)})
+	// replaces the version
+	put("project/a", types.Descriptor{Name: "v2", Size: 20, Modified: now, Annotations: map[string]string{"framework": "torch"}})
+	put("project/b", types.Descriptor{Name: "v1", Size: 3, Modified: now.Add(-time.Hour)})
+
+	index, err := db.GetIndex("project/a")
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+	if names := indexNames(index); !slices.Equal(names, []string{"v1", "v2"}) {
+		t.Errorf("GetIndex() versions = %v, want sorted v1, v2", names)
+	}
+	if index.Manifests[1].Size != 20 || index.Annotations["framework"] != "torch" {
+		t.Errorf("GetIndex() = %+v, want v2 replaced and its annotations", index)
+	}
+
+	global, err := db.GetGlobalIndex()
+	if err != nil {
+		t.Fatalf("GetGlobalIndex() error = %v", err)
+	}
+	if names := indexNames(global); !slices.Equal(names, []string{"project/a", "project/b"}) {
+		t.Fatalf("GetGlobalIndex() repositories = %v", names)
+	}
+	// a repository is described by its latest version
+	if repo := global.Manifests[0]; repo.Size != 20 || !repo.Modified.Equal(now) || repo.MediaType != MediaTypeModelIndexJson {
+		t.Errorf("GetGlobalIndex() project/a = %+v, want size and modified of v2", repo)
+	}
+
+	tests := []struct {
+		name         string
+		repository   string
+		remove       []string
+		wantVersions []string // nil if the repository is removed
+	}{
+		{name: "remove a version", repository: "project/a", remove: []string{"v1"}, wantVersions: []string{"v2"}},
+		{name: "remove unknown version", repository: "project/a", remove: []string{"v9"}, wantVersions: []string{"v2"}},
+		{name: "remove unknown repository", repository: "project/c", remove: []string{"v1"}},
+		{name: "remove the last version", repository: "project/a", remove: []string{"v2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.RemoveVersions(tt.repository, tt.remove...); err != nil {
+				t.Fatalf("RemoveVersions() error = %v", err)
+			}
+			index, err := db.GetIndex(tt.repository)
+			if tt.wantVersions == nil {
+				if err != ErrRegistryStoreNotFound {
+					t.Errorf("GetIndex() = %v, %v, want not found", index, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := indexNames(index); !slices.Equal(names, tt.wantVersions) {
+				t.Errorf("versions = %v, want %v", names, tt.wantVersions)
+			}
+		})
+	}
+
+	global, err = db.GetGlobalIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := indexNames(global); !slices.Equal(names, []string{"project/b"}) {
+		t.Errorf("GetGlobalIndex() repositories = %v, want the removed repository dropped", names)
+	}
+	if err := db.RemoveRepository("project/b"); err != nil {
+		t.Fatalf("RemoveRepository() error = %v", err)
+	}
+	if err := db.RemoveRepository("project/b"); err != nil {
+		t.Errorf("RemoveRepository() of removed repository error = %v", err)
+	}
+}
+
+func TestMetadataDBReplace(t *testing.T) {
+	db := openTestMetadataDB(t, filepath.Join(t.TempDir(), "metadata.db"))
+	if db.Indexed() {
+		t.Fatal("Indexed() of a new database expect false")
+	}
+	if err := db.PutVersion("project/stale", types.Descriptor{Name: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Replace(map[string][]types.Descriptor{
+		"project/a":     {{Name: "v1"}, {Name: "v2"}},
+		"project/empty": {},
+	})
+	if err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if !db.Indexed() {
+		t.Error("Indexed() after Replace() expect true")
+	}
+	global, err := db.GetGlobalIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := indexNames(global); !slices.Equal(names, []string{"project/a"}) {
+		t.Errorf("repositories = %v, want project/a only", names)
+	}
+}
+
+func TestFSRegistryStoreMetadataIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	options := &Options{
+		Local:      &LocalFSOptions{Basepath: filepath.Join(dir, "data")},
+		S3:         &S3Options{},
+		UploadDir:  filepath.Join(dir, "uploads"),
+		MetadataDB: filepath.Join(dir, "metadata.db"),
+	}
+	// pushed before the database is used
+	plainOptions := *options
+	plainOptions.MetadataDB = ""
+	plain, err := NewFSRegistryStore(ctx, &plainOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repository := range []string{"project/a", "project/b"} {
+		putTestManifest(t, plain, repository, "v1", testManifest(putTestBlob(t, plain, repository, repository)))
+	}
+
+	// built from storage on first start
+	store, err := NewFSRegistryStore(ctx, options)
+	if err != nil {
+		t.Fatalf("NewFSRegistryStore() error = %v", err)
+	}
+	putTestManifest(t, store, "project/a", "v2", testManifest(putTestBlob(t, store, "project/a", "v2")))
+	if err := store.DeleteManifest(ctx, "project/b", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	assertIndexes := func(store *FSRegistryStore, want map[string][]string) {
+		t.Helper()
+		global, err := store.GetGlobalIndex(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		repositories := []string{}
+		for repository, versions := range want {
+			repositories = append(repositories, repository)
+			index, err := store.GetIndex(ctx, repository, "")
+			if err != nil {
+				t.Fatalf("GetIndex(%s) error = %v", repository, err)
+			}
+			if names := indexNames(index); !slices.Equal(names, versions) {
+				t.Errorf("versions of %s = %v, want %v", repository, names, versions)
+			}
+		}
+		slices.Sort(repositories)
+		if names := indexNames(global); !slices.Equal(names, repositories) {
+			t.Errorf("repositories = %v, want %v", names, repositories)
+		}
+	}
+	assertIndexes(store, map[string][]string{"project/a": {"v1", "v2"}})
+	store.Metadata.Close()
+
+	// changed bypassing the database, as another replica does
+	putTestManifest(t, plain, "project/c", "v1", testManifest(putTestBlob(t, plain, "project/c", "c")))
+
+	// not rebuilt on restart
+	store, err = NewFSRegistryStore(ctx, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Metadata.Close()
+	assertIndexes(store, map[string][]string{"project/a": {"v1", "v2"}})
+
+	// until reindexed
+	if err := store.Reindex(ctx); err != nil {
+		t.Fatalf("Reindex() error = %v", err)
+	}
+	assertIndexes(store, map[string][]string{"project/a": {"v1", "v2"}, "project/c": {"v1"}})
+}
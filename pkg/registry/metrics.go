@@ -0,0 +1,247 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "modelx"
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of http requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests by route, method and status code.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"route", "method", "code"})
+	blobBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "blob_bytes_total",
+		Help:      "Total bytes of blobs transferred through the registry, direction is in for uploads and out for downloads.",
+	}, []string{"direction"})
+	blobLocationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "blob_locations_total",
+		Help:      "Total number of blob locations issued by purpose.",
+	}, []string{"purpose"})
+	storageOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of storage operations by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	storageOperationErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Total number of failed storage operations by method, not found errors are not counted.",
+	}, []string{"method"})
+	gcRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "gc_runs_total",
+		Help:      "Total number of garbage collect runs by result.",
+	}, []string{"result", "dry_run"})
+	gcReclaimedBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "gc_reclaimed_bytes_total",
+		Help:      "Total bytes of unused blobs removed by garbage collect.",
+	})
+	indexRefreshDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "index_refresh_duration_seconds",
+		Help:      "Latency of index refreshes, index is repository or global.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"index"})
+)
+
+// MetricsFilter records the metrics of requests served by next, requests are grouped by the routes of router.
+func MetricsFilter(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from := time.Now()
+		route := "none"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = routeName(template)
+			}
+		}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		recorder := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		code := strconv.Itoa(recorder.code)
+		httpRequestsTotal.WithLabelValues(route, r.Method, code).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(from).Seconds())
+		// both native and oci routes
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(route, "/blobs/{digest}"):
+			blobBytesTotal.WithLabelValues("out").Add(float64(recorder.written))
+		case r.Method == http.MethodPut && strings.HasSuffix(route, "/blobs/{digest}"),
+			r.Method != http.MethodGet && strings.HasSuffix(route, "/blobs/uploads/{uuid}"):
+			blobBytesTotal.WithLabelValues("in").Add(float64(body.read))
+		}
+	})
+}
+
+// MetricsHandler serves metrics on the api listener, they expose repository names and traffic of the registry,
+// so only admins of all repositories can read them when authentication is enabled.
+func (s *Registry) MetricsHandler() http.Handler {
+	metrics := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.checkRole(r, "*", RoleAdmin); err != nil {
+			ResponseError(w, err)
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// routeName removes the regexps of variables in the path template, e.g. "/{name:[a-z]+}/index" to "/{name}/index".
+func routeName(template string) string {
+	sb := strings.Builder{}
+	depth, skip := 0, false
+	for _, c := range template {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 && skip {
+				skip = false
+				sb.WriteRune(c)
+				continue
+			}
+		case c == ':' && depth == 1:
+			skip = true
+		}
+		if !skip {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	code        int
+	written     int64
+	wroteHeader bool
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses working, e.g. the event stream.
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MetricsFSProvider records the latency of each operation of FSProvider.
+type MetricsFSProvider struct {
+	FSProvider
+}
+
+var _ FSProvider = MetricsFSProvider{}
+
+func NewMetricsFSProvider(fs FSProvider) MetricsFSProvider {
+	return MetricsFSProvider{FSProvider: fs}
+}
+
+func observeStorageOperation(method string, from time.Time, err error) {
+	storageOperationDuration.WithLabelValues(method).Observe(time.Since(from).Seconds())
+	if err != nil && !IsStorageNotFound(err) && !IsPreconditionFailed(err) {
+		storageOperationErrorsTotal.WithLabelValues(method).Inc()
+	}
+}
+
+func (m MetricsFSProvider) Put(ctx context.Context, path string, content BlobContent) error {
+	from := time.Now()
+	err := m.FSProvider.Put(ctx, path, content)
+	observeStorageOperation("Put", from, err)
+	return err
+}
+
+func (m MetricsFSProvider) PutIfMatch(ctx context.Context, path string, content BlobContent, etag string) error {
+	from := time.Now()
+	err := m.FSProvider.PutIfMatch(ctx, path, content, etag)
+	observeStorageOperation("PutIfMatch", from, err)
+	return err
+}
+
+func (m MetricsFSProvider) Get(ctx context.Context, path string) (*BlobContent, error) {
+	from := time.Now()
+	content, err := m.FSProvider.Get(ctx, path)
+	observeStorageOperation("Get", from, err)
+	return content, err
+}
+
+func (m MetricsFSProvider) Stat(ctx context.Context, path string) (FsObjectMeta, error) {
+	from := time.Now()
+	meta, err := m.FSProvider.Stat(ctx, path)
+	observeStorageOperation("Stat", from, err)
+	return meta, err
+}
+
+func (m MetricsFSProvider) Remove(ctx context.Context, path string, recursive bool) error {
+	from := time.Now()
+	err := m.FSProvider.Remove(ctx, path, recursive)
+	observeStorageOperation("Remove", from, err)
+	return err
+}
+
+func (m MetricsFSProvider) Exists(ctx context.Context, path string) (bool, error) {
+	from := time.Now()
+	exists, err := m.FSProvider.Exists(ctx, path)
+	observeStorageOperation("Exists", from, err)
+	return exists, err
+}
+
+func (m MetricsFSProvider) List(ctx context.Context, path string, recursive bool) ([]FsObjectMeta, error) {
+	from := time.Now()
+	metas, err := m.FSProvider.List(ctx, path, recursive)
+	observeStorageOperation("List", from, err)
+	return metas, err
+}
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegistryMetricsHandler(t *testing.T) {
+	authorizer := newTestAuthorizer(t)
+	tests := []struct {
+		name     string
+		registry *Registry
+		user     testUser
+		wantCode int
+	}{
+		{name: "admin user", registry: &Registry{Authorizer: authorizer, Admins: []string{"carol"}}, user: testUser{username: "carol"}, wantCode: http.StatusOK},
+		{name: "admin of a project", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "alice"}, wantCode: http.StatusForbidden},
+		{name: "admin scoped token", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "robot$metrics", robot: true, scopes: []string{"*:admin"}}, wantCode: http.StatusOK},
+		{name: "anonymous", registry: &Registry{Authorizer: authorizer}, user: testUser{anonymous: true}, wantCode: http.StatusUnauthorized},
+		{name: "anonymous without authorizer", registry: &Registry{}, user: testUser{anonymous: true}, wantCode: http.StatusUnauthorized},
+		{name: "authentication disabled", registry: &Registry{}, user: testUser{}, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil).WithContext(tt.user.request().Context())
+			rec := httptest.NewRecorder()
+			tt.registry.MetricsHandler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("GET /metrics status = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRouteName(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{template: "/healthz", want: "/healthz"},
+		{template: "/{name:" + NameRegexp + "}/index", want: "/{name}/index"},
+		{template: "/{name:" + NameRegexp + "}/blobs/{digest:" + DigestRegexp + "}", want: "/{name}/blobs/{digest}"},
+		{template: "/{name:" + NameRegexp + "}/manifests/{reference:" + ReferenceRegexp + "|" + DigestRegexp + "}", want: "/{name}/manifests/{reference}"},
+	}
+	for _, tt := range tests {
+		if got := routeName(tt.template); got != tt.want {
+			t.Errorf("routeName(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsFilter(t *testing.T) {
+	store, _ := newTestFSStore(t)
+	s := &Registry{Store: store}
+	router := s.route()
+	handler := MetricsFilter(router, router)
+	repository := "project/a"
+	content := "weights"
+	blob := digest.FromString(content)
+
+	serve := func(method, target string, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body)).WithContext(testUser{username: "alice"}.request().Context())
+		req.Header.Set("Content-Type", "application/octet-stream")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		route     string
+		code      int
+		direction string
+	}{
+		{name: "put blob", method: http.MethodPut, target: "/" + repository + "/blobs/" + blob.String(), body: content, route: "/{name}/blobs/{digest}", code: http.StatusCreated, direction: "in"},
+		{name: "get blob", method: http.MethodGet, target: "/" + repository + "/blobs/" + blob.String(), route: "/{name}/blobs/{digest}", code: http.StatusOK, direction: "out"},
+		{name: "manifest unknown", method: http.MethodGet, target: "/" + repository + "/manifests/v1", route: "/{name}/manifests/{reference}", code: http.StatusNotFound},
+		{name: "oci blob", method: http.MethodGet, target: "/v2/" + repository + "/blobs/" + blob.String(), route: "/v2/{name}/blobs/{digest}", code: http.StatusOK, direction: "out"},
+		{name: "not routed", method: http.MethodGet, target: "/not/routed/path", route: "none", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := strconv.Itoa(tt.code)
+			requests := testutil.ToFloat64(httpRequestsTotal.WithLabelValues(tt.route, tt.method, code))
+			in, out := testutil.ToFloat64(blobBytesTotal.WithLabelValues("in")), testutil.ToFloat64(blobBytesTotal.WithLabelValues("out"))
+
+			if got := serve(tt.method, tt.target, tt.body); got != tt.code {
+				t.Fatalf("%s %s status = %d, want %d", tt.method, tt.target, got, tt.code)
+			}
+			if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues(tt.route, tt.method, code)) - requests; got != 1 {
+				t.Errorf("requests of route %s code %s increased by %v, want 1", tt.route, code, got)
+			}
+			wantIn, wantOut := 0.0, 0.0
+			switch tt.direction {
+			case "in":
+				wantIn = float64(len(content))
+			case "out":
+				wantOut = float64(len(content))
+			}
+			if got := testutil.ToFloat64(blobBytesTotal.WithLabelValues("in")) - in; got != wantIn {
+				t.Errorf("blob bytes in increased by %v, want %v", got, wantIn)
+			}
+			if got := testutil.ToFloat64(blobBytesTotal.WithLabelValues("out")) - out; got != wantOut {
+				t.Errorf("blob bytes out increased by %v, want %v", got, wantOut)
+			}
+		})
+	}
+}
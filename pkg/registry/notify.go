@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/notification"
+)
+
+// notifyEnabled reports whether the changes of versions are notified to endpoints or streamed to subscribers.
+func (s *Registry) notifyEnabled() bool {
+	return s.Notifier.Enabled() || s.Events != nil
+}
+
+// notify queues the event and publishes it to the event stream, the actor is the user of ctx,
+// it is empty for the changes of the registry itself, e.g. retention on schedule.
+func (s *Registry) notify(ctx context.Context, event notification.Event) {
+	if !s.notifyEnabled() {
+		return
+	}
+	event.ID = uuid.NewString()
+	event.Timestamp = time.Now().UTC()
+	event.Actor = UsernameFromContext(ctx)
+	s.Notifier.Notify(ctx, event)
+	s.Events.Publish(event)
+}
+
+// notifyPush queues the event of version reference pushed, it's a tag event if the manifest is in use by other versions.
+// nothing changed if the version is pushed with the same manifest.
+func (s *Registry) notifyPush(ctx context.Context, repository, reference, previous string, dgst digest.Digest) {
+	if !s.notifyEnabled() || previous == dgst.String() {
+		return
+	}
+	action := notification.ActionPush
+	if index, err := s.Store.GetIndex(ctx, repository, ""); err == nil {
+		for _, version := range index.Manifests {
+			if version.Name != reference && version.Digest == dgst {
+				action = notification.ActionTag
+				break
+			}
+		}
+	}
+	s.notify(ctx, notification.Event{
+		Action:         action,
+		Repository:     repository,
+		Reference:      reference,
+		Digest:         dgst.String(),
+		PreviousDigest: previous,
+	})
+}
+
+// notifyDelete queues the events of versions deleted, the versions pointed to the manifest dgst.
+func (s *Registry) notifyDelete(ctx context.Context, repository string, dgst string, versions ...string) {
+	for _, version := range versions {
+		s.notify(ctx, notification.Event{
+			Action:     notification.ActionDelete,
+			Repository: repository,
+			Reference:  version,
+			Digest:     dgst,
+		})
+	}
+}
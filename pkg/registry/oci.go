@@ -0,0 +1,275 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/types"
+)
+
+const (
+	MediaTypeOCIArtifactManifest = "application/vnd.oci.artifact.manifest.v1+json"
+	MediaTypeOCIImageManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIEmptyJSON        = "application/vnd.oci.empty.v1+json"
+
+	OCIAnnotationTitle   = "org.opencontainers.image.title"
+	ORASAnnotationUnpack = "io.deis.oras.content.unpack"
+
+	// AnnotationOCIManifest records the digest of the original oci manifest of a version pushed via oci api.
+	AnnotationOCIManifest = "modelx.oci.manifest"
+	// AnnotationOCIConfig records the config descriptor of an oci image manifest, in json.
+	AnnotationOCIConfig = "modelx.oci.config"
+	// AnnotationOCISubject records the subject descriptor of an oci manifest, in json.
+	AnnotationOCISubject = "modelx.oci.subject"
+)
+
+var (
+	OCIEmptyJSON       = []byte("{}")
+	OCIEmptyJSONDigest = digest.FromBytes(OCIEmptyJSON)
+	EmptyBlobDigest    = digest.FromBytes(nil)
+)
+
+type OCIDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       digest.Digest     `json:"digest"`
+	Size         int64             `json:"size"`
+	URLs         []string          `json:"urls,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+}
+
+// OCIManifest is the union of oci artifact manifest and oci image manifest.
+type OCIManifest struct {
+	SchemaVersion int               `json:"schemaVersion,omitempty"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *OCIDescriptor    `json:"config,omitempty"`
+	Layers        []OCIDescriptor   `json:"layers,omitempty"`
+	Blobs         []OCIDescriptor   `json:"blobs,omitempty"`
+	Subject       *OCIDescriptor    `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+func IsOCIManifestMediaType(mediaType string) bool {
+	return mediaType == MediaTypeOCIArtifactManifest || mediaType == MediaTypeOCIImageManifest
+}
+
+// ConvertToOCIManifest converts a modelx manifest to an oci manifest of mediaType.
+// the modelx config is placed as the first blob, all blobs are titled with their names,
+// so the files can be restored by oras.
+func ConvertToOCIManifest(manifest types.Manifest, mediaType string) OCIManifest {
+	descs := []types.Descriptor{}
+	if manifest.Config.Digest != "" {
+		descs = append(descs, manifest.Config)
+	}
+	descs = append(descs, manifest.Blobs...)
+
+	blobs := make([]OCIDescriptor, 0, len(descs))
+	for _, desc := range descs {
+		annotations := map[string]string{}
+		for k, v := range desc.Annotations {
+			annotations[k] = v
+		}
+		annotations[OCIAnnotationTitle] = desc.Name
+		if desc.Mode != 0 {
+			annotations[types.AnnotationFileMode] = strconv.FormatUint(uint64(desc.Mode), 8)
+		}
+		if desc.MediaType == MediaTypeModelDirectoryTarGz {
+			annotations[ORASAnnotationUnpack] = "true"
+		}
+		blobs = append(blobs, OCIDescriptor{
+			MediaType:   desc.MediaType,
+			Digest:      desc.Digest,
+			Size:        desc.Size,
+			URLs:        desc.URLs,
+			Annotations: annotations,
+		})
+	}
+	out := OCIManifest{
+		MediaType:    mediaType,
+		ArtifactType: MediaTypeModelManifestJson,
+	}
+	config, subject := OCIManifestReferences(manifest)
+	out.Subject = subject
+	for k, v := range manifest.Annotations {
+		if k == AnnotationOCIManifest || k == AnnotationOCIConfig || k == AnnotationOCISubject {
+			continue
+		}
+		if out.Annotations == nil {
+			out.Annotations = map[string]string{}
+		}
+		out.Annotations[k] = v
+	}
+	switch mediaType {
+	case MediaTypeOCIImageManifest:
+		out.SchemaVersion = 2
+		out.Config = config
+		if out.Config == nil {
+			out.Config = &OCIDescriptor{MediaType: MediaTypeOCIEmptyJSON, Digest: OCIEmptyJSONDigest, Size: int64(len(OCIEmptyJSON))}
+		}
+		out.Layers = blobs
+	default:
+		out.Blobs = blobs
+	}
+	return out
+}
+
+// ConvertFromOCIManifest converts an oci manifest to a modelx manifest.
+// blobs are named by their title annotation, the first yaml config named modelx.yaml is used as model config.
+// the config of an image manifest and the subject are kept in annotations, see OCIManifestReferences.
+func ConvertFromOCIManifest(manifest OCIManifest) (types.Manifest, error) {
+	out := types.Manifest{
+		SchemaVersion: manifest.SchemaVersion,
+		MediaType:     MediaTypeModelManifestJson,
+	}
+	for k, v := range manifest.Annotations {
+		if out.Annotations == nil {
+			out.Annotations = map[string]string{}
+		}
+		out.Annotations[k] = v
+	}
+	for key, desc := range map[string]*OCIDescriptor{AnnotationOCIConfig: manifest.Config, AnnotationOCISubject: manifest.Subject} {
+		if desc == nil {
+			continue
+		}
+		if err := desc.Digest.Validate(); err != nil {
+			return types.Manifest{}, fmt.Errorf("invalid digest %s: %w", desc.Digest, err)
+		}
+		raw, err := json.Marshal(desc)
+		if err != nil {
+			return types.Manifest{}, err
+		}
+		if out.Annotations == nil {
+			out.Annotations = map[string]string{}
+		}
+		out.Annotations[key] = string(raw)
+	}
+	blobs := manifest.Blobs
+	if manifest.MediaType == MediaTypeOCIImageManifest {
+		blobs = manifest.Layers
+	}
+	for _, blob := range blobs {
+		desc := types.Descriptor{
+			Name:      blob.Annotations[OCIAnnotationTitle],
+			MediaType: blob.MediaType,
+			Digest:    blob.Digest,
+			Size:      blob.Size,
+			URLs:      blob.URLs,
+		}
+		if desc.Name == "" {
+			desc.Name = blob.Digest.Encoded()
+		}
+		if mode, err := strconv.ParseUint(blob.Annotations[types.AnnotationFileMode], 8, 32); err == nil {
+			desc.Mode = os.FileMode(mode)
+		}
+		for k, v := range blob.Annotations {
+			if k == OCIAnnotationTitle || k == ORASAnnotationUnpack || k == types.AnnotationFileMode {
+				continue
+			}
+			if desc.Annotations == nil {
+				desc.Annotations = types.Annotations{}
+			}
+			desc.Annotations[k] = v
+		}
+		switch {
+		case blob.MediaType == MediaTypeModelConfigYaml,
+			out.Config.Digest == "" && desc.Name == "modelx.yaml":
+			desc.MediaType = MediaTypeModelConfigYaml
+			out.Config = desc
+			continue
+		case blob.MediaType == MediaTypeModelFile, blob.MediaType == MediaTypeModelDirectoryTarGz:
+		case blob.Annotations[ORASAnnotationUnpack] == "true":
+			desc.MediaType = MediaTypeModelDirectoryTarGz
+		default:
+			desc.MediaType = MediaTypeModelFile
+		}
+		if strings.Contains(desc.Name, "/") {
+			return types.Manifest{}, fmt.Errorf("invalid blob name %s", desc.Name)
+		}
+		out.Blobs = append(out.Blobs, desc)
+	}
+	return out, nil
+}
+
+// OCIManifestReferences returns the config and the subject descriptors of the oci manifest the modelx manifest converted from,
+// nil if none.
+func OCIManifestReferences(manifest types.Manifest) (config *OCIDescriptor, subject *OCIDescriptor) {
+	parse := func(key string) *OCIDescriptor {
+		raw, ok := manifest.Annotations[key]
+		if !ok {
+			return nil
+		}
+		desc := &OCIDescriptor{}
+		if err := json.Unmarshal([]byte(raw), desc); err != nil || desc.Digest.Validate() != nil {
+			return nil
+		}
+		return desc
+	}
+	return parse(AnnotationOCIConfig), parse(AnnotationOCISubject)
+}
+
+// OCIManifestDigests returns the digests the modelx manifest is also addressed by in oci api,
+// they are the original oci manifest the modelx manifest converted from, and the oci manifests it is converted to.
+func OCIManifestDigests(manifest types.Manifest) []digest.Digest {
+	digests := []digest.Digest{}
+	if original := digest.Digest(manifest.Annotations[AnnotationOCIManifest]); original.Validate() == nil {
+		digests = append(digests, original)
+	}
+	for _, mediaType := range []string{MediaTypeOCIArtifactManifest, MediaTypeOCIImageManifest} {
+		if _, converted, err := MarshalOCIManifest(ConvertToOCIManifest(manifest, mediaType)); err == nil && !slices.Contains(digests, converted) {
+			digests = append(digests, converted)
+		}
+	}
+	return digests
+}
+
+// MarshalOCIManifest returns the content and the digest of the oci manifest.
+func MarshalOCIManifest(manifest OCIManifest) ([]byte, digest.Digest, error) {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, digest.FromBytes(content), nil
+}
+
+// NegotiateOCIManifestMediaType chooses the oci manifest media type from Accept headers.
+// artifact manifest is preferred, image manifest is used only if the client does not accept artifact manifest.
+func NegotiateOCIManifestMediaType(accepts []string) string {
+	acceptImage := false
+	for _, accept := range accepts {
+		for _, item := range strings.Split(accept, ",") {
+			mediaType, _, _ := strings.Cut(strings.TrimSpace(item), ";")
+			switch mediaType {
+			case MediaTypeOCIArtifactManifest, "*/*":
+				return MediaTypeOCIArtifactManifest
+			case MediaTypeOCIImageManifest:
+				acceptImage = true
+			}
+		}
+	}
+	if acceptImage {
+		return MediaTypeOCIImageManifest
+	}
+	return MediaTypeOCIArtifactManifest
+}
+
+// IsAcceptedMediaType reports whether mediaType is acceptable by Accept headers.
+func IsAcceptedMediaType(accepts []string, mediaType string) bool {
+	if len(accepts) == 0 {
+		return true
+	}
+	for _, accept := range accepts {
+		for _, item := range strings.Split(accept, ",") {
+			accepted, _, _ := strings.Cut(strings.TrimSpace(item), ";")
+			if accepted == mediaType || accepted == "*/*" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestConvertFromOCIManifestKeepsReferences(t *testing.T) {
+	config := &OCIDescriptor{MediaType: "application/vnd.example.config+json", Digest: digest.FromString("config"), Size: 6}
+	subject := &OCIDescriptor{MediaType: MediaTypeOCIImageManifest, Digest: digest.FromString("subject"), Size: 7}
+	layer := OCIDescriptor{
+		MediaType:   "application/octet-stream",
+		Digest:      digest.FromString("weights"),
+		Size:        7,
+		Annotations: map[string]string{OCIAnnotationTitle: "model.bin"},
+	}
+
+	tests := []struct {
+		name        string
+		manifest    OCIManifest
+		wantConfig  *OCIDescriptor
+		wantSubject *OCIDescriptor
+	}{
+		{
+			name:     "artifact manifest without references",
+			manifest: OCIManifest{MediaType: MediaTypeOCIArtifactManifest, Blobs: []OCIDescriptor{layer}},
+		},
+		{
+			name:       "image manifest with config",
+			manifest:   OCIManifest{SchemaVersion: 2, MediaType: MediaTypeOCIImageManifest, Config: config, Layers: []OCIDescriptor{layer}},
+			wantConfig: config,
+		},
+		{
+			name:        "image manifest with config and subject",
+			manifest:    OCIManifest{SchemaVersion: 2, MediaType: MediaTypeOCIImageManifest, Config: config, Layers: []OCIDescriptor{layer}, Subject: subject},
+			wantConfig:  config,
+			wantSubject: subject,
+		},
+		{
+			name:        "artifact manifest with subject",
+			manifest:    OCIManifest{MediaType: MediaTypeOCIArtifactManifest, Blobs: []OCIDescriptor{layer}, Subject: subject},
+			wantSubject: subject,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := ConvertFromOCIManifest(tt.manifest)
+			if err != nil {
+				t.Fatalf("ConvertFromOCIManifest() error = %v", err)
+			}
+			if len(manifest.Blobs) != 1 || manifest.Blobs[0].Name != "model.bin" {
+				t.Fatalf("blobs = %v, want model.bin", manifest.Blobs)
+			}
+			gotConfig, gotSubject := OCIManifestReferences(manifest)
+			if !sameOCIDescriptor(gotConfig, tt.wantConfig) {
+				t.Errorf("config = %v, want %v", gotConfig, tt.wantConfig)
+			}
+			if !sameOCIDescriptor(gotSubject, tt.wantSubject) {
+				t.Errorf("subject = %v, want %v", gotSubject, tt.wantSubject)
+			}
+
+			// converted back, the original config and subject are restored
+			out := ConvertToOCIManifest(manifest, tt.manifest.MediaType)
+			if !sameOCIDescriptor(out.Subject, tt.wantSubject) {
+				t.Errorf("converted subject = %v, want %v", out.Subject, tt.wantSubject)
+			}
+			if tt.wantConfig != nil && !sameOCIDescriptor(out.Config, tt.wantConfig) {
+				t.Errorf("converted config = %v, want %v", out.Config, tt.wantConfig)
+			}
+			for k := range out.Annotations {
+				if k == AnnotationOCIConfig || k == AnnotationOCISubject || k == AnnotationOCIManifest {
+					t.Errorf("converted annotations contain %s", k)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertFromOCIManifestInvalidReference(t *testing.T) {
+	manifest := OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIImageManifest,
+		Config:        &OCIDescriptor{MediaType: MediaTypeOCIEmptyJSON, Digest: "sha256:invalid"},
+	}
+	if _, err := ConvertFromOCIManifest(manifest); err == nil {
+		t.Fatal("ConvertFromOCIManifest() expect error of invalid config digest")
+	}
+}
+
+func sameOCIDescriptor(a, b *OCIDescriptor) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.MediaType == b.MediaType && a.Digest == b.Digest && a.Size == b.Size
+}
@@ -1,5 +1,15 @@
 package registry
 
+import (
+	"time"
+
+	"kubegems.io/modelx/pkg/audit"
+	"kubegems.io/modelx/pkg/auth"
+	"kubegems.io/modelx/pkg/notification"
+)
+
+const DefaultNotificationQueueDir = "data/notifications"
+
 type Options struct {
 	Listen         string
 	TLS            *TLSOptions
@@ -7,20 +17,105 @@ type Options struct {
 	Local          *LocalFSOptions
 	EnableRedirect bool
 	OIDC           *OIDCOptions
+	AuthWebhook    *AuthWebhookOptions
+	Auth           *AuthOptions
+	UploadDir      string
+	GC             *GCScheduleOptions
+	Retention      *RetentionOptions
+	// UploadTTL is how long an upload is kept since its data last received, 0 keeps uploads forever.
+	UploadTTL time.Duration
+	// ImmutabilityConfig is the file of immutability rules.
+	ImmutabilityConfig string
+	// AdminUsers are admins of all repositories, e.g. they can force to overwrite or delete immutable versions.
+	AdminUsers []string
+	// AuthorizationConfig is the file of roles granted to users, all requests are allowed if empty.
+	AuthorizationConfig string
+	Audit               *AuditOptions
+	Notification        *NotificationOptions
+	// MetadataDB is the file of the metadata database serves indexes, the index files in storage are used if empty.
+	// It's local to the process, modelxd must run as a single replica if it's set.
+	MetadataDB string
+	// MetricsListen is the address to serve metrics apart from the api without authentication,
+	// metrics are served on the api listener to admins only if empty.
+	MetricsListen string
+	// EventsBufferSize is the number of recent events kept to resume event streams, 0 disables event streams.
+	EventsBufferSize int
+}
+
+type NotificationOptions struct {
+	// Config is the file of notification endpoints, notification is disabled if empty.
+	Config string
+	// QueueDir keeps the events not delivered yet.
+	QueueDir string
+}
+
+type AuditOptions struct {
+	// File appends audit events as json lines, disabled if empty.
+	File string
+	// Stdout writes audit events to stdout as json lines.
+	Stdout bool
+	// WebhookURL receives audit events posted one by one, disabled if empty.
+	WebhookURL     string
+	WebhookTimeout time.Duration
+}
+
+type GCScheduleOptions struct {
+	// Interval of periodic garbage collect, 0 disables it.
+	Interval    time.Duration
+	DryRun      bool
+	GracePeriod time.Duration
+}
+
+type RetentionOptions struct {
+	// Config is the file of retention rules, retention is disabled if empty.
+	Config string
+	// Interval of periodic retention, 0 disables it.
+	Interval time.Duration
+	DryRun   bool
 }
 
 type OIDCOptions struct {
 	Issuer string
+	// GroupsClaim is the claim of oidc tokens contains the groups of user.
+	GroupsClaim string
+}
+
+type AuthOptions struct {
+	// TokenFile is the file of static tokens.
+	TokenFile string
+	// HtpasswdFile is the htpasswd file of basic auth users.
+	HtpasswdFile string
+}
+
+type AuthWebhookOptions struct {
+	// URL of the token review webhook, disabled if empty.
+	URL              string
+	Timeout          time.Duration
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
 }
 
 func DefaultOptions() *Options {
 	return &Options{
-		Listen:         ":8080",
-		TLS:            &TLSOptions{},
-		S3:             NewDefaultS3Options(),
-		OIDC:           &OIDCOptions{},
-		Local:          NewDefaultLocalFSOptions(),
-		EnableRedirect: false, // default to false
+		Listen: ":8080",
+		TLS:    &TLSOptions{},
+		S3:     NewDefaultS3Options(),
+		OIDC:   &OIDCOptions{GroupsClaim: "groups"},
+		Auth:   &AuthOptions{},
+		AuthWebhook: &AuthWebhookOptions{
+			Timeout:          auth.DefaultWebhookTimeout,
+			CacheTTL:         auth.DefaultWebhookCacheTTL,
+			NegativeCacheTTL: auth.DefaultWebhookNegativeCacheTTL,
+		},
+		Local:            NewDefaultLocalFSOptions(),
+		EnableRedirect:   false, // default to false
+		UploadDir:        DefaultUploadDir,
+		UploadTTL:        DefaultUploadTTL,
+		GC:               &GCScheduleOptions{GracePeriod: DefaultGCGracePeriod},
+		Retention:        &RetentionOptions{},
+		Audit:            &AuditOptions{WebhookTimeout: audit.DefaultWebhookTimeout},
+		Notification:     &NotificationOptions{QueueDir: DefaultNotificationQueueDir},
+		EventsBufferSize: notification.DefaultBrokerLogSize,
 	}
 }
 
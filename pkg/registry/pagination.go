@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// indexCursor is the position of the last manifest of a page, encoded as the continue token.
+// the next page starts after the position, so it is stable while manifests are added or removed.
+type indexCursor struct {
+	Sort     string    `json:"sort,omitempty"`
+	Name     string    `json:"name"`
+	Modified time.Time `json:"modified,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+}
+
+func IndexListOptionsFromQuery(query url.Values) (types.IndexListOptions, error) {
+	options := types.IndexListOptions{
+		Search:   query.Get("search"),
+		Query:    query.Get("query"),
+		Sort:     query.Get("sort"),
+		Continue: query.Get("continue"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return options, errors.NewParameterInvalidError("limit " + limit + " is not a non-negative integer")
+		}
+		options.Limit = n
+	}
+	if _, ok := types.DescriptorCompareFunc(options.Sort); !ok {
+		return options, errors.NewParameterInvalidError("unknown sort " + options.Sort)
+	}
+	if _, err := ParseIndexQuery(options.Query); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// PageIndex filters the manifests of index by options.Query, sorts them and keeps the page selected by options,
+// index.Continue is set to the token of the next page if more manifests remain.
+func PageIndex(index *types.Index, options types.IndexListOptions) error {
+	cmp, ok := types.DescriptorCompareFunc(options.Sort)
+	if !ok {
+		return errors.NewParameterInvalidError("unknown sort " + options.Sort)
+	}
+	query, err := ParseIndexQuery(options.Query)
+	if err != nil {
+		return err
+	}
+	manifests := slices.Clone(query.Filter(index.Manifests))
+	slices.SortFunc(manifests, cmp)
+
+	if options.Continue != "" {
+		cursor, err := decodeIndexCursor(options.Continue)
+		if err != nil || cursor.Sort != options.Sort {
+			return errors.NewParameterInvalidError("invalid continue token, it must be from a previous page of the same sort")
+		}
+		last := types.Descriptor{Name: cursor.Name, Modified: cursor.Modified, Size: cursor.Size}
+		i := sort.Search(len(manifests), func(i int) bool { return cmp(manifests[i], last) > 0 })
+		manifests = manifests[i:]
+	}
+	index.Continue = ""
+	if options.Limit > 0 && len(manifests) > options.Limit {
+		manifests = manifests[:options.Limit]
+		last := manifests[len(manifests)-1]
+		index.Continue = encodeIndexCursor(indexCursor{Sort: options.Sort, Name: last.Name, Modified: last.Modified, Size: last.Size})
+	}
+	index.Manifests = manifests
+	return nil
+}
+
+func encodeIndexCursor(cursor indexCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeIndexCursor(token string) (indexCursor, error) {
+	cursor := indexCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(raw, &cursor)
+	return cursor, err
+}
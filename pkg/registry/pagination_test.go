@@ -0,0 +1,152 @@
+package registry
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func TestIndexListOptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    types.IndexListOptions
+		wantErr bool
+	}{
+		{query: "", want: types.IndexListOptions{}},
+		{
+			query: "search=llama&query=framework%3Dpytorch&sort=-modified&limit=10&continue=abc",
+			want:  types.IndexListOptions{Search: "llama", Query: "framework=pytorch", Sort: "-modified", Limit: 10, Continue: "abc"},
+		},
+		{query: "limit=-1", wantErr: true},
+		{query: "limit=ten", wantErr: true},
+		{query: "sort=popularity", wantErr: true},
+		{query: "query=framework", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			got, err := IndexListOptionsFromQuery(values)
+			if tt.wantErr {
+				if !errors.IsErrCode(err, errors.ErrCodeInvalidParameter) {
+					t.Errorf("IndexListOptionsFromQuery() error = %v, want invalid parameter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IndexListOptionsFromQuery() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IndexListOptionsFromQuery() = %+v, want %+v", got, tt.want)
+			}
+			// round trip
+			if again, _ := IndexListOptionsFromQuery(got.Values()); again != got {
+				t.Errorf("IndexListOptionsFromQuery(Values()) = %+v, want %+v", again, got)
+			}
+		})
+	}
+}
+
+func testPagedManifests() []types.Descriptor {
+	base := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []types.Descriptor{
+		{Name: "v1.10.0", Size: 30, Modified: base.Add(4 * time.Hour), Annotations: map[string]string{types.AnnotationFramework: "pytorch"}},
+		{Name: "v1.2.0", Size: 10, Modified: base.Add(2 * time.Hour), Annotations: map[string]string{types.AnnotationFramework: "pytorch"}},
+		{Name: "v1.9.0", Size: 10, Modified: base.Add(3 * time.Hour)},
+		{Name: "latest", Size: 30, Modified: base.Add(4 * time.Hour), Annotations: map[string]string{types.AnnotationFramework: "pytorch"}},
+		{Name: "v0.1.0", Size: 20, Modified: base.Add(time.Hour)},
+	}
+}
+
+// pageAll walks all pages of options.Limit, the index is changed by modify before each next page.
+func pageAll(t *testing.T, options types.IndexListOptions, modify func(page int, manifests []types.Descriptor) []types.Descriptor) []string {
+	t.Helper()
+	manifests := testPagedManifests()
+	names := []string{}
+	for page := 0; ; page++ {
+		if modify != nil {
+			manifests = modify(page, manifests)
+		}
+		index := &types.Index{Manifests: slices.Clone(manifests)}
+		if err := PageIndex(index, options); err != nil {
+			t.Fatalf("PageIndex() page %d error = %v", page, err)
+		}
+		if options.Limit > 0 && len(index.Manifests) > options.Limit {
+			t.Fatalf("PageIndex() page %d has %d manifests, limit %d", page, len(index.Manifests), options.Limit)
+		}
+		for _, desc := range index.Manifests {
+			names = append(names, desc.Name)
+		}
+		if index.Continue == "" {
+			return names
+		}
+		options.Continue = index.Continue
+	}
+}
+
+func TestPageIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		options types.IndexListOptions
+		want    []string
+	}{
+		{name: "name", options: types.IndexListOptions{Limit: 2}, want: []string{"latest", "v0.1.0", "v1.10.0", "v1.2.0", "v1.9.0"}},
+		{name: "no limit", options: types.IndexListOptions{}, want: []string{"latest", "v0.1.0", "v1.10.0", "v1.2.0", "v1.9.0"}},
+		{name: "name descending", options: types.IndexListOptions{Sort: "-name", Limit: 2}, want: []string{"v1.9.0", "v1.2.0", "v1.10.0", "v0.1.0", "latest"}},
+		{name: "modified, ties by name", options: types.IndexListOptions{Sort: "modified", Limit: 2}, want: []string{"v0.1.0", "v1.2.0", "v1.9.0", "latest", "v1.10.0"}},
+		{name: "latest first", options: types.IndexListOptions{Sort: "-modified", Limit: 3}, want: []string{"v1.10.0", "latest", "v1.9.0", "v1.2.0", "v0.1.0"}},
+		{name: "size", options: types.IndexListOptions{Sort: "size", Limit: 1}, want: []string{"v1.2.0", "v1.9.0", "v0.1.0", "latest", "v1.10.0"}},
+		{name: "semver", options: types.IndexListOptions{Sort: "semver", Limit: 2}, want: []string{"latest", "v0.1.0", "v1.2.0", "v1.9.0", "v1.10.0"}},
+		{name: "query", options: types.IndexListOptions{Query: "framework=pytorch", Sort: "-semver", Limit: 2}, want: []string{"v1.10.0", "v1.2.0", "latest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageAll(t, tt.options, nil); !slices.Equal(got, tt.want) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageIndexStableWhileChanged(t *testing.T) {
+	options := types.IndexListOptions{Sort: "semver", Limit: 2}
+	// after the first page of latest and v0.1.0, the last one of the page is removed and versions are added before and after it
+	got := pageAll(t, options, func(page int, manifests []types.Descriptor) []types.Descriptor {
+		if page != 1 {
+			return manifests
+		}
+		manifests = slices.DeleteFunc(manifests, func(desc types.Descriptor) bool { return desc.Name == "v0.1.0" })
+		return append(manifests, types.Descriptor{Name: "v0.0.1"}, types.Descriptor{Name: "v2.0.0"})
+	})
+	want := []string{"latest", "v0.1.0", "v1.2.0", "v1.9.0", "v1.10.0", "v2.0.0"}
+	if !slices.Equal(got, want) {
+		t.Errorf("pages = %v, want %v without repeated or skipped versions", got, want)
+	}
+}
+
+func TestPageIndexInvalidContinue(t *testing.T) {
+	index := &types.Index{Manifests: testPagedManifests()}
+	if err := PageIndex(index, types.IndexListOptions{Sort: "size", Limit: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		options types.IndexListOptions
+	}{
+		{name: "token of another sort", options: types.IndexListOptions{Sort: "name", Continue: index.Continue}},
+		{name: "malformed token", options: types.IndexListOptions{Continue: "!!"}},
+		{name: "unknown sort", options: types.IndexListOptions{Sort: "popularity"}},
+		{name: "invalid query", options: types.IndexListOptions{Query: "size>large"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PageIndex(&types.Index{Manifests: testPagedManifests()}, tt.options)
+			if !errors.IsErrCode(err, errors.ErrCodeInvalidParameter) {
+				t.Errorf("PageIndex() error = %v, want invalid parameter", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+const (
+	ProjectRegexp = `[a-zA-Z0-9]+(?:[._-][a-zA-Z0-9]+)*`
+
+	// ProjectCacheTTL is how long the metadata of a project is cached, changes by another replica take effect after it.
+	ProjectCacheTTL = time.Minute
+
+	projectsDir = "_projects"
+)
+
+// ProjectPath returns the path of the project metadata, projects are stored apart from repositories.
+func ProjectPath(project string) string {
+	return path.Join(projectsDir, project+".json")
+}
+
+// Projects keeps the metadata of projects in FS, projects without metadata are private.
+type Projects struct {
+	FS FSProvider
+
+	mu    sync.Mutex
+	cache map[string]projectCacheEntry
+}
+
+type projectCacheEntry struct {
+	project types.Project
+	expires time.Time
+}
+
+func NewProjects(fs FSProvider) *Projects {
+	return &Projects{FS: fs, cache: map[string]projectCacheEntry{}}
+}
+
+// Get returns the metadata of project, a private project is returned if no metadata saved.
+func (p *Projects) Get(ctx context.Context, project string) (types.Project, error) {
+	p.mu.Lock()
+	entry, ok := p.cache[project]
+	p.mu.Unlock()
+	now := time.Now()
+	if ok && now.Before(entry.expires) {
+		return entry.project, nil
+	}
+	meta := types.Project{Name: project, Visibility: types.ProjectVisibilityPrivate}
+	body, err := p.FS.Get(ctx, ProjectPath(project))
+	if err != nil {
+		if !IsStorageNotFound(err) {
+			return types.Project{}, errors.NewInternalError(err)
+		}
+	} else {
+		defer body.Close()
+		if err := json.NewDecoder(body).Decode(&meta); err != nil {
+			return types.Project{}, errors.NewInternalError(err)
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, entry := range p.cache {
+		if now.After(entry.expires) {
+			delete(p.cache, k)
+		}
+	}
+	p.cache[project] = projectCacheEntry{project: meta, expires: now.Add(ProjectCacheTTL)}
+	return meta, nil
+}
+
+func (p *Projects) Put(ctx context.Context, meta types.Project) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+	if err := p.FS.Put(ctx, ProjectPath(meta.Name), BlobContent{
+		Content:       io.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		ContentType:   "application/json",
+	}); err != nil {
+		return errors.NewInternalError(err)
+	}
+	p.mu.Lock()
+	delete(p.cache, meta.Name)
+	p.mu.Unlock()
+	return nil
+}
+
+// IsPublic reports whether the project of repository is public, projects are private on errors.
+func (p *Projects) IsPublic(ctx context.Context, repository string) bool {
+	if p == nil {
+		return false
+	}
+	project, _, _ := strings.Cut(repository, "/")
+	meta, err := p.Get(ctx, project)
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "get project", "project", project)
+		return false
+	}
+	return meta.Visibility == types.ProjectVisibilityPublic
+}
+
+func (s *Registry) GetProject(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+	if err := s.checkRole(r, project, RoleReader); err != nil {
+		ResponseError(w, err)
+		return
+	}
+	meta, err := s.Projects.Get(r.Context(), project)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	ResponseOK(w, meta)
+}
+
+// PutProject updates the metadata of project, requires admin role on the project.
+func (s *Registry) PutProject(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+	if err := s.checkRole(r, project, RoleAdmin); err != nil {
+		ResponseError(w, err)
+		return
+	}
+	var meta types.Project
+	if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		ResponseError(w, errors.NewParameterInvalidError(err.Error()))
+		return
+	}
+	switch meta.Visibility {
+	case types.ProjectVisibilityPublic, types.ProjectVisibilityPrivate:
+	default:
+		ResponseError(w, errors.NewParameterInvalidError(fmt.Sprintf("unknown visibility %q, must be public or private", meta.Visibility)))
+		return
+	}
+	meta.Name = project
+	if err := s.Projects.Put(r.Context(), meta); err != nil {
+		ResponseError(w, err)
+		return
+	}
+	ResponseOK(w, meta)
+}
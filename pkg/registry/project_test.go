@@ -0,0 +1,212 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"kubegems.io/modelx/pkg/auth"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func TestProjectsVisibility(t *testing.T) {
+	ctx := context.Background()
+	projects := newTestProjects(t)
+	// another replica on the same storage
+	replica := NewProjects(projects.FS)
+
+	if projects.IsPublic(ctx, "team/demo") || replica.IsPublic(ctx, "team/demo") {
+		t.Fatal("IsPublic() of a project without metadata expect false")
+	}
+	if err := projects.Put(ctx, types.Project{Name: "team", Visibility: types.ProjectVisibilityPublic}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		projects   *Projects
+		repository string
+		want       bool
+	}{
+		{name: "repository of public project", projects: projects, repository: "team/demo", want: true},
+		{name: "project itself", projects: projects, repository: "team", want: true},
+		{name: "other project", projects: projects, repository: "other/demo", want: false},
+		{name: "cached by another replica", projects: replica, repository: "team/demo", want: false},
+		{name: "nil projects", projects: nil, repository: "team/demo", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.projects.IsPublic(ctx, tt.repository); got != tt.want {
+				t.Errorf("IsPublic() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryPutProject(t *testing.T) {
+	s := &Registry{Authorizer: newTestAuthorizer(t), Projects: newTestProjects(t)}
+	tests := []struct {
+		name       string
+		user       testUser
+		body       string
+		wantCode   errors.ErrCode
+		wantPublic bool
+	}{
+		{name: "admin", user: testUser{username: "alice"}, body: `{"name":"ignored","visibility":"public"}`, wantPublic: true},
+		{name: "writer", user: testUser{username: "bob", groups: []string{"ml-team"}}, body: `{"visibility":"private"}`, wantCode: errors.ErrCodeDenied, wantPublic: true},
+		{name: "admin scoped token", user: testUser{username: "alice", scopes: []string{"team/*:reader"}}, body: `{"visibility":"private"}`, wantCode: errors.ErrCodeDenied, wantPublic: true},
+		{name: "unknown visibility", user: testUser{username: "alice"}, body: `{"visibility":"internal"}`, wantCode: errors.ErrCodeInvalidParameter, wantPublic: true},
+		{name: "anonymous", user: testUser{anonymous: true}, body: `{"visibility":"private"}`, wantCode: errors.ErrCodeUnauthorized, wantPublic: true},
+		{name: "admin sets private", user: testUser{username: "alice"}, body: `{"visibility":"private"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/_projects/team", strings.NewReader(tt.body)).WithContext(tt.user.request().Context())
+			req = mux.SetURLVars(req, map[string]string{"project": "team"})
+			rec := httptest.NewRecorder()
+			s.PutProject(rec, req)
+			if tt.wantCode != "" {
+				info := errors.ErrorInfo{}
+				_ = json.NewDecoder(rec.Body).Decode(&info)
+				if info.Code != tt.wantCode {
+					t.Fatalf("PutProject() code = %q, want %q", info.Code, tt.wantCode)
+				}
+			} else if rec.Code != http.StatusOK {
+				t.Fatalf("PutProject() status = %d, body = %s", rec.Code, rec.Body)
+			}
+			if got := s.Projects.IsPublic(context.Background(), "team/demo"); got != tt.wantPublic {
+				t.Errorf("IsPublic() = %v, want %v", got, tt.wantPublic)
+			}
+		})
+	}
+}
+
+type tokenAuthenticatorFunc func(ctx context.Context, token string) (*auth.UserInfo, error)
+
+func (f tokenAuthenticatorFunc) Authenticate(ctx context.Context, token string) (*auth.UserInfo, error) {
+	return f(ctx, token)
+}
+
+func TestAuthFilter(t *testing.T) {
+	tokens := tokenAuthenticatorFunc(func(ctx context.Context, token string) (*auth.UserInfo, error) {
+		switch token {
+		case "alice-token":
+			return &auth.UserInfo{Username: "alice", Scopes: []string{"team/*:reader"}}, nil
+		case "robot-token":
+			return &auth.UserInfo{Username: "robot$ci", Scopes: []string{"team/*:writer"}, Robot: true}, nil
+		}
+		return nil, auth.ErrUnauthenticated
+	})
+	var seen testUser
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		seen = testUser{
+			username:  UsernameFromContext(ctx),
+			scopes:    ScopesFromContext(ctx),
+			robot:     IsRobotFromContext(ctx),
+			anonymous: IsAnonymousFromContext(ctx),
+		}
+	})
+	filter := NewAuthFilter(tokens, nil, next)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		header   map[string]string
+		wantCode int
+		want     testUser
+	}{
+		{name: "bearer token", method: http.MethodPost, url: "/", header: map[string]string{"Authorization": "Bearer alice-token"}, want: testUser{username: "alice", scopes: []string{"team/*:reader"}}},
+		{name: "query token", method: http.MethodGet, url: "/?access_token=alice-token", want: testUser{username: "alice", scopes: []string{"team/*:reader"}}},
+		{name: "robot", method: http.MethodGet, url: "/", header: map[string]string{"Authorization": "Bearer robot-token"}, want: testUser{username: "robot$ci", scopes: []string{"team/*:writer"}, robot: true}},
+		{name: "anonymous get", method: http.MethodGet, url: "/", want: testUser{anonymous: true}},
+		{name: "anonymous head", method: http.MethodHead, url: "/", want: testUser{anonymous: true}},
+		{name: "anonymous put", method: http.MethodPut, url: "/", wantCode: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodGet, url: "/", header: map[string]string{"Authorization": "Bearer invalid"}, wantCode: http.StatusUnauthorized},
+		{name: "basic auth not supported", method: http.MethodGet, url: "/", header: map[string]string{"Authorization": "Basic YWxpY2U6c2VjcmV0"}, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = testUser{username: "not called"}
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			filter.ServeHTTP(rec, req)
+			if tt.wantCode != 0 {
+				if rec.Code != tt.wantCode || seen.username != "not called" {
+					t.Fatalf("status = %d, handler called %v, want %d and not called", rec.Code, seen.username != "not called", tt.wantCode)
+				}
+				return
+			}
+			if seen.username != tt.want.username || seen.robot != tt.want.robot || seen.anonymous != tt.want.anonymous ||
+				strings.Join(seen.scopes, ",") != strings.Join(tt.want.scopes, ",") {
+				t.Errorf("user = %+v, want %+v", seen, tt.want)
+			}
+		})
+	}
+}
+
+type passwordAuthenticatorFunc func(ctx context.Context, username, password string) (*auth.UserInfo, error)
+
+func (f passwordAuthenticatorFunc) AuthenticatePassword(ctx context.Context, username, password string) (*auth.UserInfo, error) {
+	return f(ctx, username, password)
+}
+
+func TestAuthFilterOCIBaseChallenge(t *testing.T) {
+	tokens := tokenAuthenticatorFunc(func(ctx context.Context, token string) (*auth.UserInfo, error) {
+		if token == "alice-token" {
+			return &auth.UserInfo{Username: "alice"}, nil
+		}
+		return nil, auth.ErrUnauthenticated
+	})
+	passwords := passwordAuthenticatorFunc(func(ctx context.Context, username, password string) (*auth.UserInfo, error) {
+		if username == "alice" && password == "secret" {
+			return &auth.UserInfo{Username: "alice"}, nil
+		}
+		return nil, auth.ErrUnauthenticated
+	})
+	router := mux.NewRouter()
+	(&Registry{}).ociRoute(router)
+
+	basic, bearer := `Basic realm="modelx"`, `Bearer realm="modelx"`
+	tests := []struct {
+		name          string
+		tokens        auth.TokenAuthenticator
+		passwords     auth.PasswordAuthenticator
+		header        map[string]string
+		wantCode      int
+		wantChallenge []string
+	}{
+		{name: "anonymous with tokens", tokens: tokens, wantCode: http.StatusUnauthorized, wantChallenge: []string{bearer}},
+		{name: "anonymous with htpasswd", passwords: passwords, wantCode: http.StatusUnauthorized, wantChallenge: []string{basic}},
+		{name: "anonymous with both", tokens: tokens, passwords: passwords, wantCode: http.StatusUnauthorized, wantChallenge: []string{basic, bearer}},
+		{name: "invalid token", tokens: tokens, header: map[string]string{"Authorization": "Bearer invalid"}, wantCode: http.StatusUnauthorized, wantChallenge: []string{bearer}},
+		{name: "invalid password", tokens: tokens, passwords: passwords, header: map[string]string{"Authorization": "Basic YWxpY2U6d3Jvbmc="}, wantCode: http.StatusUnauthorized, wantChallenge: []string{basic, bearer}},
+		{name: "token", tokens: tokens, header: map[string]string{"Authorization": "Bearer alice-token"}, wantCode: http.StatusOK},
+		{name: "password", tokens: tokens, passwords: passwords, header: map[string]string{"Authorization": "Basic YWxpY2U6c2VjcmV0"}, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v2/", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			NewAuthFilter(tt.tokens, tt.passwords, router).ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET /v2/ status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Values("WWW-Authenticate"); strings.Join(got, ",") != strings.Join(tt.wantChallenge, ",") {
+				t.Errorf("WWW-Authenticate = %v, want %v", got, tt.wantChallenge)
+			}
+		})
+	}
+}
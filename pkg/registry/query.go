@@ -0,0 +1,197 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kubegems.io/modelx/pkg/client/units"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// IndexQuery matches the descriptors of an index by their metadata, all terms must match.
+//
+// A query is comma separated terms of key, operator and value, e.g. framework=pytorch,tag=llm|nlp,size<10GB:
+//   - "=" and "!=" test equality, "|" separated values is a set matches any of them.
+//     tag and maintainer match if any of the tags or maintainers is in the set, name matches globs like team/*.
+//   - ">", ">=", "<" and "<=" compare the size (like 500MB) or modified (RFC3339 or 2006-01-02) in range.
+//   - keys other than name, framework, task, tag, maintainer, size and modified are annotations.
+type IndexQuery []queryTerm
+
+type queryTerm struct {
+	Key    string
+	Op     string
+	Values []string
+
+	size int64
+	time time.Time
+}
+
+// queryOperators are ordered so the two characters operators are found first.
+var queryOperators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+func ParseIndexQuery(query string) (IndexQuery, error) {
+	q := IndexQuery{}
+	for _, expr := range strings.Split(query, ",") {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		term, err := parseQueryTerm(expr)
+		if err != nil {
+			return nil, errors.NewParameterInvalidError(fmt.Sprintf("query %s: %v", expr, err))
+		}
+		q = append(q, term)
+	}
+	return q, nil
+}
+
+func parseQueryTerm(expr string) (queryTerm, error) {
+	i := strings.IndexAny(expr, "!=<>")
+	if i <= 0 {
+		return queryTerm{}, fmt.Errorf("expect key, operator and value")
+	}
+	term := queryTerm{Key: strings.ToLower(strings.TrimSpace(expr[:i]))}
+	for _, op := range queryOperators {
+		if strings.HasPrefix(expr[i:], op) {
+			term.Op = op
+			break
+		}
+	}
+	if term.Op == "" {
+		return queryTerm{}, fmt.Errorf("unknown operator")
+	}
+	value := strings.TrimSpace(expr[i+len(term.Op):])
+	for _, v := range strings.Split(value, "|") {
+		term.Values = append(term.Values, strings.TrimSpace(v))
+	}
+
+	switch term.Key {
+	case "size":
+		size, err := units.FromHumanSize(value)
+		if err != nil {
+			return queryTerm{}, err
+		}
+		term.size = size
+	case "modified":
+		t, err := parseQueryTime(value)
+		if err != nil {
+			return queryTerm{}, err
+		}
+		term.time = t
+	default:
+		if term.Op != "=" && term.Op != "!=" {
+			return queryTerm{}, fmt.Errorf("operator %s is only for size and modified", term.Op)
+		}
+	}
+	return term, nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func (q IndexQuery) Match(desc types.Descriptor) bool {
+	for _, term := range q {
+		if !term.match(desc) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the descriptors match the query.
+func (q IndexQuery) Filter(descs []types.Descriptor) []types.Descriptor {
+	if len(q) == 0 {
+		return descs
+	}
+	matched := []types.Descriptor{}
+	for _, desc := range descs {
+		if q.Match(desc) {
+			matched = append(matched, desc)
+		}
+	}
+	return matched
+}
+
+func (t queryTerm) match(desc types.Descriptor) bool {
+	switch t.Key {
+	case "size":
+		return compareMatch(t.Op, compareInt(desc.Size, t.size))
+	case "modified":
+		return compareMatch(t.Op, desc.Modified.Compare(t.time))
+	case "name":
+		return t.in(func(value string) bool { return MatchRepository(value, desc.Name) })
+	case "framework":
+		return t.in(equalValue(desc.Annotations[types.AnnotationFramework]))
+	case "task":
+		return t.in(equalValue(desc.Annotations[types.AnnotationTask]))
+	case "tag", "tags":
+		return t.in(containsValue(desc.Annotations[types.AnnotationTags]))
+	case "maintainer", "maintainers":
+		return t.in(containsValue(desc.Annotations[types.AnnotationMaintainers]))
+	default:
+		value, ok := desc.Annotations[t.Key]
+		if !ok {
+			return t.Op == "!="
+		}
+		return t.in(equalValue(value))
+	}
+}
+
+// in reports whether any value of the term matches, negated by "!=".
+func (t queryTerm) in(match func(value string) bool) bool {
+	for _, value := range t.Values {
+		if match(value) {
+			return t.Op == "="
+		}
+	}
+	return t.Op == "!="
+}
+
+func equalValue(actual string) func(string) bool {
+	return func(value string) bool { return strings.EqualFold(actual, value) }
+}
+
+// containsValue matches if value is one of the comma separated actual.
+func containsValue(actual string) func(string) bool {
+	return func(value string) bool {
+		for _, item := range strings.Split(actual, ",") {
+			if item != "" && strings.EqualFold(strings.TrimSpace(item), value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareMatch(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
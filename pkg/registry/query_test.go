@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func TestParseIndexQuery(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantTerms int
+		wantErr   bool
+	}{
+		{query: "", wantTerms: 0},
+		{query: "framework=pytorch, tag=llm|nlp ,size<10GB", wantTerms: 3},
+		{query: "modified>=2023-06-01,modified<2023-06-02T08:00:00Z", wantTerms: 2},
+		{query: "framework=pytorch,,", wantTerms: 1},
+		{query: "=pytorch", wantErr: true},
+		{query: "framework", wantErr: true},
+		{query: "framework>pytorch", wantErr: true},
+		{query: "size>large", wantErr: true},
+		{query: "modified<yesterday", wantErr: true},
+		{query: "framework!pytorch", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseIndexQuery(tt.query)
+			if tt.wantErr {
+				if !errors.IsErrCode(err, errors.ErrCodeInvalidParameter) {
+					t.Errorf("ParseIndexQuery() error = %v, want invalid parameter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseIndexQuery() error = %v", err)
+			}
+			if len(q) != tt.wantTerms {
+				t.Errorf("ParseIndexQuery() terms = %d, want %d", len(q), tt.wantTerms)
+			}
+		})
+	}
+}
+
+func TestIndexQueryMatch(t *testing.T) {
+	desc := types.Descriptor{
+		Name:     "team/llama",
+		Size:     5_000_000_000,
+		Modified: time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC),
+		Annotations: map[string]string{
+			types.AnnotationFramework:   "PyTorch",
+			types.AnnotationTask:        "text-generation",
+			types.AnnotationTags:        "llm, nlp",
+			types.AnnotationMaintainers: "alice,bob",
+			"license":                   "apache-2.0",
+		},
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "", want: true},
+		{query: "framework=pytorch", want: true},
+		{query: "framework=tensorflow|pytorch", want: true},
+		{query: "framework!=pytorch", want: false},
+		{query: "framework=tensorflow", want: false},
+		{query: "task=text-generation", want: true},
+		{query: "tag=nlp", want: true},
+		{query: "tags=cv|llm", want: true},
+		{query: "tag=cv", want: false},
+		{query: "tag!=cv", want: true},
+		{query: "maintainer=bob", want: true},
+		{query: "name=team/*", want: true},
+		{query: "name=other/*", want: false},
+		{query: "size<10GB", want: true},
+		{query: "size>=5GB", want: true},
+		{query: "size>5GB", want: false},
+		{query: "modified>=2023-06-01", want: true},
+		{query: "modified<2023-06-01T08:00:00Z", want: false},
+		{query: "license=Apache-2.0", want: true},
+		{query: "license!=mit", want: true},
+		{query: "dataset=wiki", want: false},
+		{query: "dataset!=wiki", want: true},
+		{query: "framework=pytorch,size>10GB", want: false},
+		{query: "framework=pytorch,tag=llm,size<10GB", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseIndexQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.Match(desc); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexQueryFilter(t *testing.T) {
+	descs := []types.Descriptor{
+		{Name: "a", Annotations: map[string]string{types.AnnotationFramework: "pytorch"}},
+		{Name: "b", Annotations: map[string]string{types.AnnotationFramework: "onnx"}},
+		{Name: "c"},
+	}
+	q, err := ParseIndexQuery("framework=pytorch|onnx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Filter(descs); len(got) != 2 || got[0].Name != "a" || got[1].Name != "b" {
+		t.Errorf("Filter() = %v, want a and b", got)
+	}
+	if got := (IndexQuery{}).Filter(descs); len(got) != len(descs) {
+		t.Errorf("Filter() of empty query = %v, want all", got)
+	}
+}
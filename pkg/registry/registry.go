@@ -7,16 +7,52 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
 	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/audit"
 	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/notification"
 	"kubegems.io/modelx/pkg/types"
 )
 
 type Registry struct {
-	Store RegistryStore
+	Store     RegistryStore
+	Uploads   *BlobUploads
+	Retention *RetentionPolicy
+	// Immutability protects versions from overwritten or deleted.
+	Immutability *ImmutabilityPolicy
+	// Authorizer checks the roles of users, all requests are allowed if nil.
+	Authorizer *Authorizer
+	// Projects keeps the visibility of projects.
+	Projects *Projects
+	// Tokens are the api tokens issued by the registry.
+	Tokens *APITokens
+	// Audit records the mutations, disabled if nil.
+	Audit *audit.Auditor
+	// Notifier notifies the changes of versions, disabled if nil.
+	Notifier *notification.Notifier
+	// Events streams the changes of versions to subscribers, disabled if nil.
+	Events *notification.Broker
+	// Admins are the users admin of all repositories, in addition to the admin roles granted by Authorizer.
+	Admins []string
+	// GCGracePeriod is the default grace period of garbage collect.
+	GCGracePeriod time.Duration
+
+	// gcmu excludes manifest puts and blob mounts while garbage collect is running,
+	// so a blob is never removed under a manifest referencing it.
+	// It's local to the process, garbage collect is not safe with puts on other replicas.
+	gcmu sync.RWMutex
+	// immutableLocks serializes the overwrite checks and puts of immutable versions by repository in this process.
+	immutableLocks KeyedMutex
+}
+
+// GCOptions returns the default options of garbage collect.
+func (s *Registry) GCOptions() GCOptions {
+	return GCOptions{GracePeriod: s.GCGracePeriod}
 }
 
 func (s *Registry) HeadManifest(w http.ResponseWriter, r *http.Request) {
@@ -38,7 +74,12 @@ func (s *Registry) HeadManifest(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Registry) GetGlobalIndex(w http.ResponseWriter, r *http.Request) {
-	index, err := s.Store.GetGlobalIndex(r.Context(), r.URL.Query().Get("search"))
+	options, err := IndexListOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	index, err := s.Store.GetGlobalIndex(r.Context(), options.Search)
 	if err != nil {
 		if IsRegistryStoreNotNotFound(err) {
 			ResponseOK(w, types.Index{})
@@ -47,12 +88,29 @@ func (s *Registry) GetGlobalIndex(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// only the repositories the user can read are listed
+	readable := make([]types.Descriptor, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		if s.canRead(r, desc.Name) {
+			readable = append(readable, desc)
+		}
+	}
+	index.Manifests = readable
+	if err := PageIndex(&index, options); err != nil {
+		ResponseError(w, err)
+		return
+	}
 	ResponseOK(w, index)
 }
 
 func (s *Registry) GetIndex(w http.ResponseWriter, r *http.Request) {
 	name, _ := GetRepositoryReference(r)
-	index, err := s.Store.GetIndex(r.Context(), name, r.URL.Query().Get("search"))
+	options, err := IndexListOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	index, err := s.Store.GetIndex(r.Context(), name, options.Search)
 	if err != nil {
 		if IsRegistryStoreNotNotFound(err) {
 			ResponseError(w, errors.NewIndexUnknownError(name))
@@ -61,11 +119,29 @@ func (s *Registry) GetIndex(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if err := PageIndex(&index, options); err != nil {
+		ResponseError(w, err)
+		return
+	}
+	s.Immutability.MarkImmutable(name, &index)
 	ResponseOK(w, index)
 }
 
 func (s *Registry) DeleteIndex(w http.ResponseWriter, r *http.Request) {
 	name, _ := GetRepositoryReference(r)
+	index, err := s.Store.GetIndex(r.Context(), name, "")
+	if err != nil && !IsRegistryStoreNotNotFound(err) {
+		ResponseError(w, err)
+		return
+	}
+	versions := make([]string, 0, len(index.Manifests))
+	for _, version := range index.Manifests {
+		versions = append(versions, version.Name)
+	}
+	if err := s.checkDelete(r, name, versions...); err != nil {
+		ResponseError(w, err)
+		return
+	}
 	if err := s.Store.RemoveIndex(r.Context(), name); err != nil {
 		if IsRegistryStoreNotNotFound(err) {
 			ResponseError(w, errors.NewIndexUnknownError(name))
@@ -74,6 +150,14 @@ func (s *Registry) DeleteIndex(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	s.audit(r, audit.Event{
+		Action:     audit.ActionDeleteIndex,
+		Repository: name,
+		Details:    map[string]any{"versions": versions},
+	})
+	for _, version := range index.Manifests {
+		s.notifyDelete(r.Context(), name, version.Digest.String(), version.Name)
+	}
 	ResponseOK(w, "ok")
 }
 
@@ -88,6 +172,9 @@ func (s *Registry) GetManifest(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if contentDigest, err := manifest.Digest(); err == nil {
+		w.Header().Set(types.HeaderContentDigest, contentDigest.String())
+	}
 	ResponseOK(w, manifest)
 }
 
@@ -98,16 +185,50 @@ func (s *Registry) PutManifest(w http.ResponseWriter, r *http.Request) {
 		ResponseError(w, errors.NewManifestInvalidError(err))
 		return
 	}
+	contentDigest, err := manifest.Digest()
+	if err != nil {
+		ResponseError(w, errors.NewManifestInvalidError(err))
+		return
+	}
+	unlock, err := s.checkOverwrite(r, name, reference, func(existing *types.Manifest) bool {
+		existingDigest, err := existing.Digest()
+		return err == nil && existingDigest == contentDigest
+	})
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	defer unlock()
+	oldDigest := s.previousManifestDigest(r.Context(), name, reference)
 	contenttype := r.Header.Get("Content-Type")
-	if err := s.Store.PutManifest(r.Context(), name, reference, contenttype, manifest); err != nil {
+	if err := s.putManifest(r.Context(), name, reference, contenttype, manifest); err != nil {
 		ResponseError(w, err)
 		return
 	}
+	s.audit(r, audit.Event{
+		Action:     audit.ActionPutManifest,
+		Repository: name,
+		Reference:  reference,
+		OldDigest:  oldDigest,
+		NewDigest:  contentDigest.String(),
+	})
+	s.notifyPush(r.Context(), name, reference, oldDigest, contentDigest)
+	w.Header().Set(types.HeaderContentDigest, contentDigest.String())
 	w.WriteHeader(http.StatusCreated)
 }
 
 func (s *Registry) DeleteManifest(w http.ResponseWriter, r *http.Request) {
 	name, reference := GetRepositoryReference(r)
+	versions, err := s.versionsOfReference(r.Context(), name, reference)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	if err := s.checkDelete(r, name, versions...); err != nil {
+		ResponseError(w, err)
+		return
+	}
+	oldDigest := s.previousManifestDigest(r.Context(), name, reference)
 	if err := s.Store.DeleteManifest(r.Context(), name, reference); err != nil {
 		if IsRegistryStoreNotNotFound(err) {
 			ResponseError(w, errors.NewManifestUnknownError(reference))
@@ -116,9 +237,39 @@ func (s *Registry) DeleteManifest(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	s.audit(r, audit.Event{
+		Action:     audit.ActionDeleteManifest,
+		Repository: name,
+		Reference:  reference,
+		OldDigest:  oldDigest,
+		Details:    map[string]any{"versions": versions},
+	})
+	s.notifyDelete(r.Context(), name, oldDigest, versions...)
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// versionsOfReference returns the versions deleted along with reference, a digest reference deletes all versions point to it.
+func (s *Registry) versionsOfReference(ctx context.Context, repository, reference string) ([]string, error) {
+	dgst, ok := ParseDigestReference(reference)
+	if !ok {
+		return []string{reference}, nil
+	}
+	index, err := s.Store.GetIndex(ctx, repository, "")
+	if err != nil {
+		if IsRegistryStoreNotNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	versions := []string{}
+	for _, version := range index.Manifests {
+		if version.Digest == dgst {
+			versions = append(versions, version.Name)
+		}
+	}
+	return versions, nil
+}
+
 func GetRepositoryReference(r *http.Request) (string, string) {
 	vars := mux.Vars(r)
 	return vars["name"], vars["reference"]
@@ -131,11 +282,19 @@ func (s *Registry) HeadBlob(w http.ResponseWriter, r *http.Request) {
 			ResponseError(w, err)
 			return
 		}
-		if ok {
-			w.WriteHeader(http.StatusOK)
-		} else {
+		if !ok {
 			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		meta, err := s.Store.GetBlobMeta(r.Context(), repository, digest)
+		if err != nil {
+			ResponseError(w, err)
+			return
 		}
+		w.Header().Set("Content-Length", strconv.FormatInt(meta.ContentLength, 10))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", BlobETag(digest))
+		w.WriteHeader(http.StatusOK)
 	})
 }
 
@@ -144,6 +303,25 @@ func (s *Registry) HeadBlob(w http.ResponseWriter, r *http.Request) {
 func (s *Registry) PutBlob(w http.ResponseWriter, r *http.Request) {
 	BlobDigestFun(w, r, func(ctx context.Context, repository string, digest digest.Digest) {
 		log := logr.FromContextOrDiscard(ctx).WithValues("action", "put-blob", "repository", repository, "digest", digest.String())
+		if from := r.URL.Query().Get("from"); from != "" {
+			if err := s.checkRole(r, from, RoleReader); err != nil {
+				ResponseError(w, err)
+				return
+			}
+			if err := s.mountBlob(r.Context(), repository, from, digest); err != nil {
+				log.Error(err, "store mount blob", "from", from)
+				ResponseError(w, err)
+				return
+			}
+			s.audit(r, audit.Event{
+				Action:     audit.ActionPutBlob,
+				Repository: repository,
+				NewDigest:  digest.String(),
+				Details:    map[string]any{"from": from},
+			})
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
 		contentType := r.Header.Get("Content-Type")
 		if contentType == "" {
 			ResponseError(w, errors.NewContentTypeInvalidError("empty"))
@@ -159,10 +337,129 @@ func (s *Registry) PutBlob(w http.ResponseWriter, r *http.Request) {
 			ResponseError(w, err)
 			return
 		}
+		s.audit(r, audit.Event{
+			Action:     audit.ActionPutBlob,
+			Repository: repository,
+			NewDigest:  digest.String(),
+			Details:    map[string]any{"size": r.ContentLength},
+		})
 		w.WriteHeader(http.StatusCreated)
 	})
 }
 
+// StartBlobUpload starts a resumable upload, an existing upload is returned if query digest matches.
+func (s *Registry) StartBlobUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	var expected digest.Digest
+	if digeststr := r.URL.Query().Get("digest"); digeststr != "" {
+		d, err := digest.Parse(digeststr)
+		if err != nil {
+			ResponseError(w, errors.NewDigestInvalidError(digeststr))
+			return
+		}
+		expected = d
+	}
+	// mount the blob from another repository instead of uploading if possible
+	// mount only from the repositories the user can read
+	if from := r.URL.Query().Get("from"); from != "" && expected != "" && s.canRead(r, from) {
+		if err := s.mountBlob(r.Context(), name, from, expected); err == nil {
+			s.audit(r, audit.Event{
+				Action:     audit.ActionPutBlob,
+				Repository: name,
+				NewDigest:  expected.String(),
+				Details:    map[string]any{"from": from},
+			})
+			w.Header().Set("Location", "/"+name+"/blobs/"+expected.String())
+			w.WriteHeader(http.StatusCreated)
+			return
+		} else if !errors.IsErrCode(err, errors.ErrCodeBlobUnknown) {
+			ResponseError(w, err)
+			return
+		}
+	}
+	upload, err := s.Uploads.Create(name, UsernameFromContext(r.Context()), expected)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/"+name+"/blobs/uploads/"+upload.ID)
+	ResponseOK(w, upload.Status())
+}
+
+func (s *Registry) GetBlobUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	ResponseOK(w, upload.Status())
+}
+
+// PatchBlobUpload appends a chunk to the upload, the chunk must start at the committed offset.
+func (s *Registry) PatchBlobUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	start, end, err := ParseUploadRange(r)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	var content io.Reader = r.Body
+	if start >= 0 {
+		content = io.LimitReader(r.Body, end-start+1)
+	}
+	if _, err := s.Uploads.Append(r.Context(), upload, start, content); err != nil {
+		ResponseError(w, err)
+		return
+	}
+	ResponseOK(w, upload.Status())
+}
+
+// PutBlobUpload commits the upload, the content is verified by query digest.
+func (s *Registry) PutBlobUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	log := logr.FromContextOrDiscard(r.Context()).WithValues("action", "commit-blob-upload", "repository", name)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	digeststr := r.URL.Query().Get("digest")
+	expected, err := digest.Parse(digeststr)
+	if err != nil {
+		ResponseError(w, errors.NewDigestInvalidError(digeststr))
+		return
+	}
+	if err := s.Uploads.Commit(r.Context(), s.Store, upload, expected, "application/octet-stream"); err != nil {
+		log.Error(err, "commit upload")
+		ResponseError(w, err)
+		return
+	}
+	s.audit(r, audit.Event{
+		Action:     audit.ActionPutBlob,
+		Repository: name,
+		NewDigest:  expected.String(),
+		Details:    map[string]any{"size": upload.Offset()},
+	})
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Registry) DeleteBlobUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	s.Uploads.Cancel(upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Registry) GetBlob(w http.ResponseWriter, r *http.Request) {
 	BlobDigestFun(w, r, func(ctx context.Context, repository string, digest digest.Digest) {
 		log := logr.FromContextOrDiscard(ctx).WithValues("action", "get-blob", "repository", repository, "digest", digest.String())
@@ -171,27 +468,99 @@ func (s *Registry) GetBlob(w http.ResponseWriter, r *http.Request) {
 			log.Error(err, "store get blob")
 			if IsRegistryStoreNotNotFound(err) {
 				ResponseError(w, errors.NewBlobUnknownError(digest))
+			} else {
+				ResponseError(w, err)
 			}
-			ResponseError(w, err)
 			return
 		}
 		defer result.Close()
+		ServeBlobContent(w, r, digest, result)
+	})
+}
 
-		w.Header().Set("Content-Length", strconv.Itoa(int(result.ContentLength)))
-		w.Header().Set("Content-Type", result.ContentType)
-		w.WriteHeader(http.StatusOK)
-		io.Copy(w, result.Content)
+// ServeBlobContent writes the blob content, Range and If-Range requests are served if the content is seekable.
+// the ETag of a blob is its digest.
+func ServeBlobContent(w http.ResponseWriter, r *http.Request, digest digest.Digest, content *BlobContent) {
+	w.Header().Set("ETag", BlobETag(digest))
+	if content.ContentType != "" {
+		w.Header().Set("Content-Type", content.ContentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if seeker, ok := content.Content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, seeker)
 		return
-	})
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(content.ContentLength, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content.Content)
+}
+
+func BlobETag(digest digest.Digest) string {
+	return `"` + digest.String() + `"`
 }
 
 func (s *Registry) GarbageCollect(w http.ResponseWriter, r *http.Request) {
 	name, _ := GetRepositoryReference(r)
-	result, err := GCBlobs(r.Context(), s.Store, name)
+	opts := s.GCOptions()
+	query := r.URL.Query()
+	if dryrun := query.Get("dry-run"); dryrun != "" {
+		val, err := strconv.ParseBool(dryrun)
+		if err != nil {
+			ResponseError(w, errors.NewParameterInvalidError("dry-run: "+err.Error()))
+			return
+		}
+		opts.DryRun = val
+	}
+	if graceperiod := query.Get("grace-period"); graceperiod != "" {
+		val, err := time.ParseDuration(graceperiod)
+		if err != nil || val < 0 {
+			ResponseError(w, errors.NewParameterInvalidError("grace-period: "+graceperiod))
+			return
+		}
+		opts.GracePeriod = val
+	}
+	unlock := s.lockGC()
+	result, err := GCBlobs(r.Context(), s.Store, name, opts)
+	unlock()
 	if err != nil {
 		ResponseError(w, errors.NewInternalError(err))
 		return
 	}
+	s.audit(r, audit.Event{
+		Action:     audit.ActionGarbageCollect,
+		Repository: name,
+		Details: map[string]any{
+			"dryRun":           result.DryRun,
+			"blobs":            len(result.Blobs),
+			"reclaimableBytes": result.ReclaimableBytes,
+		},
+	})
+	ResponseOK(w, result)
+}
+
+func (s *Registry) ApplyRetention(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	dryrun := false
+	if val := r.URL.Query().Get("dry-run"); val != "" {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			ResponseError(w, errors.NewParameterInvalidError("dry-run: "+err.Error()))
+			return
+		}
+		dryrun = b
+	}
+	if s.Retention.RuleOf(name) == nil {
+		ResponseError(w, errors.NewParameterInvalidError("no retention rule for repository "+name))
+		return
+	}
+	unlock := s.lockGC()
+	result, err := s.applyRetention(r.Context(), name, dryrun)
+	unlock()
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
 	ResponseOK(w, result)
 }
 
@@ -211,6 +580,7 @@ func (s *Registry) GetBlobLocation(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+		blobLocationsTotal.WithLabelValues(purpose).Inc()
 		ResponseOK(w, result)
 	})
 }
@@ -0,0 +1,647 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/audit"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// OCI distribution spec compatible api.
+// see: https://github.com/opencontainers/distribution-spec/blob/main/spec.md
+
+const OCIDefaultCatalogLimit = 1000
+
+func (s *Registry) ociRoute(router *mux.Router) {
+	v2 := router.PathPrefix("/v2").Subrouter()
+	v2.Methods("GET").Path("/").HandlerFunc(s.OCIBase)
+	v2.Methods("GET").Path("/_catalog").HandlerFunc(s.OCICatalog)
+
+	repository := v2.PathPrefix("/{name:" + NameRegexp + "}").Subrouter()
+	repository.Methods("GET").Path("/tags/list").HandlerFunc(s.ociAuthorize(RoleReader, s.OCITagsList))
+
+	// manifests
+	manifestPath := "/manifests/{reference:" + ReferenceRegexp + "|" + DigestRegexp + "}"
+	repository.Methods("HEAD").Path(manifestPath).HandlerFunc(s.ociAuthorize(RoleReader, s.OCIHeadManifest))
+	repository.Methods("GET").Path(manifestPath).HandlerFunc(s.ociAuthorize(RoleReader, s.OCIGetManifest))
+	repository.Methods("PUT").Path(manifestPath).HandlerFunc(s.ociAuthorize(RoleWriter, MaxBytesReadHandler(s.OCIPutManifest, MaxBytesRead)))
+	repository.Methods("DELETE").Path(manifestPath).HandlerFunc(s.ociAuthorize(RoleWriter, s.OCIDeleteManifest))
+
+	// blobs
+	blobPath := "/blobs/{digest:" + DigestRegexp + "}"
+	repository.Methods("HEAD").Path(blobPath).HandlerFunc(s.ociAuthorize(RoleReader, s.OCIHeadBlob))
+	repository.Methods("GET").Path(blobPath).HandlerFunc(s.ociAuthorize(RoleReader, s.OCIGetBlob))
+
+	// blob uploads
+	repository.Methods("POST").Path("/blobs/uploads/").HandlerFunc(s.ociAuthorize(RoleWriter, s.OCIStartUpload))
+	uploadPath := "/blobs/uploads/{uuid}"
+	repository.Methods("GET").Path(uploadPath).HandlerFunc(s.ociAuthorize(RoleWriter, s.OCIGetUpload))
+	repository.Methods("PATCH").Path(uploadPath).HandlerFunc(s.ociAuthorize(RoleWriter, s.OCIPatchUpload))
+	repository.Methods("PUT").Path(uploadPath).HandlerFunc(s.ociAuthorize(RoleWriter, s.OCIPutUpload))
+	repository.Methods("DELETE").Path(uploadPath).HandlerFunc(s.ociAuthorize(RoleWriter, s.OCIDeleteUpload))
+}
+
+// OCIBase checks the api version, anonymous requests are challenged when authentication is enabled,
+// clients check their credentials by it on login.
+func (s *Registry) OCIBase(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if IsAnonymousFromContext(r.Context()) {
+		ResponseOCIError(w, errors.NewUnauthorizedError("authentication required"))
+		return
+	}
+	ResponseOK(w, map[string]any{})
+}
+
+func (s *Registry) OCICatalog(w http.ResponseWriter, r *http.Request) {
+	index, err := s.Store.GetGlobalIndex(r.Context(), "")
+	if err != nil && !IsRegistryStoreNotNotFound(err) {
+		ResponseOCIError(w, err)
+		return
+	}
+	repositories := []string{}
+	for _, desc := range index.Manifests {
+		if s.canRead(r, desc.Name) {
+			repositories = append(repositories, desc.Name)
+		}
+	}
+	sort.Strings(repositories)
+
+	repositories, next := paginateNames(repositories, r.URL.Query())
+	if next != "" {
+		query := url.Values{"n": {strconv.Itoa(len(repositories))}, "last": {next}}
+		w.Header().Set("Link", `</v2/_catalog?`+query.Encode()+`>; rel="next"`)
+	}
+	ResponseOK(w, map[string]any{"repositories": repositories})
+}
+
+func (s *Registry) OCITagsList(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	index, err := s.Store.GetIndex(r.Context(), name, "")
+	if err != nil {
+		if IsRegistryStoreNotNotFound(err) {
+			ResponseOCIError(w, errors.ErrorInfo{HttpStatus: http.StatusNotFound, Code: errors.ErrCodeNameUnknown, Message: "repository: " + name + " not found"})
+		} else {
+			ResponseOCIError(w, err)
+		}
+		return
+	}
+	tags := []string{}
+	for _, desc := range index.Manifests {
+		tags = append(tags, desc.Name)
+	}
+	sort.Strings(tags)
+
+	tags, next := paginateNames(tags, r.URL.Query())
+	if next != "" {
+		query := url.Values{"n": {strconv.Itoa(len(tags))}, "last": {next}}
+		w.Header().Set("Link", `</v2/`+name+`/tags/list?`+query.Encode()+`>; rel="next"`)
+	}
+	ResponseOK(w, map[string]any{"name": name, "tags": tags})
+}
+
+// paginateNames applies the "n" and "last" query of oci api on sorted names.
+// it returns the names of current page and the last name if more names remain.
+func paginateNames(names []string, query url.Values) ([]string, string) {
+	if last := query.Get("last"); last != "" {
+		i := sort.SearchStrings(names, last)
+		if i < len(names) && names[i] == last {
+			i++
+		}
+		names = names[i:]
+	}
+	n, err := strconv.Atoi(query.Get("n"))
+	if err != nil || n <= 0 {
+		n = OCIDefaultCatalogLimit
+	}
+	if len(names) > n {
+		return names[:n], names[n-1]
+	}
+	return names, ""
+}
+
+func (s *Registry) OCIHeadManifest(w http.ResponseWriter, r *http.Request) {
+	name, reference := GetRepositoryReference(r)
+	content, mediaType, err := s.getOCIManifest(r.Context(), name, reference, r.Header.Values("Accept"))
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(content).String())
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Registry) OCIGetManifest(w http.ResponseWriter, r *http.Request) {
+	name, reference := GetRepositoryReference(r)
+	content, mediaType, err := s.getOCIManifest(r.Context(), name, reference, r.Header.Values("Accept"))
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(content).String())
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+// getOCIManifest returns the oci manifest of a tag or a digest.
+// manifests pushed via oci api are returned as is, others are converted from modelx manifest.
+func (s *Registry) getOCIManifest(ctx context.Context, repository, reference string, accepts []string) ([]byte, string, error) {
+	mediaType := NegotiateOCIManifestMediaType(accepts)
+	if dgst, err := digest.Parse(reference); err == nil {
+		if content, originalMediaType, err := s.getOriginalOCIManifest(ctx, repository, dgst); err == nil {
+			return content, originalMediaType, nil
+		}
+		// manifests are also stored by the digests of the oci manifests they are converted to
+		manifest, err := s.Store.GetManifest(ctx, repository, dgst.String())
+		if err != nil {
+			if IsNotFoundOrUnknown(err) {
+				return nil, "", errors.NewManifestUnknownError(reference)
+			}
+			return nil, "", err
+		}
+		for _, candidate := range []string{MediaTypeOCIArtifactManifest, MediaTypeOCIImageManifest} {
+			content, contentDigest, err := MarshalOCIManifest(ConvertToOCIManifest(*manifest, candidate))
+			if err != nil {
+				return nil, "", errors.NewInternalError(err)
+			}
+			if contentDigest == dgst {
+				return content, candidate, nil
+			}
+		}
+		return nil, "", errors.NewManifestUnknownError(reference)
+	}
+
+	manifest, err := s.Store.GetManifest(ctx, repository, reference)
+	if err != nil {
+		if IsRegistryStoreNotNotFound(err) {
+			return nil, "", errors.NewManifestUnknownError(reference)
+		}
+		return nil, "", err
+	}
+	if original, ok := manifest.Annotations[AnnotationOCIManifest]; ok {
+		if content, originalMediaType, err := s.getOriginalOCIManifest(ctx, repository, digest.Digest(original)); err == nil &&
+			IsAcceptedMediaType(accepts, originalMediaType) {
+			return content, originalMediaType, nil
+		}
+	}
+	content, _, err := MarshalOCIManifest(ConvertToOCIManifest(*manifest, mediaType))
+	if err != nil {
+		return nil, "", errors.NewInternalError(err)
+	}
+	return content, mediaType, nil
+}
+
+// getOriginalOCIManifest returns the manifest pushed via oci api, it is saved as a blob.
+func (s *Registry) getOriginalOCIManifest(ctx context.Context, repository string, dgst digest.Digest) ([]byte, string, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, "", errors.NewDigestInvalidError(dgst.String())
+	}
+	exists, err := s.Store.ExistsBlob(ctx, repository, dgst)
+	if err != nil {
+		return nil, "", err
+	}
+	if !exists {
+		return nil, "", errors.NewManifestUnknownError(dgst.String())
+	}
+	blob, err := s.Store.GetBlob(ctx, repository, dgst)
+	if err != nil {
+		return nil, "", err
+	}
+	defer blob.Close()
+	if !IsOCIManifestMediaType(blob.ContentType) {
+		return nil, "", errors.NewManifestUnknownError(dgst.String())
+	}
+	content, err := io.ReadAll(io.LimitReader(blob.Content, MaxBytesRead))
+	if err != nil {
+		return nil, "", errors.NewInternalError(err)
+	}
+	return content, blob.ContentType, nil
+}
+
+func (s *Registry) OCIPutManifest(w http.ResponseWriter, r *http.Request) {
+	name, reference := GetRepositoryReference(r)
+	log := logr.FromContextOrDiscard(r.Context()).WithValues("action", "oci-put-manifest", "repository", name, "reference", reference)
+
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		ResponseOCIError(w, errors.NewManifestInvalidError(err))
+		return
+	}
+	// a manifest pushed by digest is kept untagged, e.g. the referrers of "oras attach"
+	contentDigest := digest.FromBytes(content)
+	if dgst, ok := ParseDigestReference(reference); ok && dgst != contentDigest {
+		ResponseOCIError(w, errors.NewDigestInvalidError(reference))
+		return
+	}
+	var ocimanifest OCIManifest
+	if err := json.Unmarshal(content, &ocimanifest); err != nil {
+		ResponseOCIError(w, errors.NewManifestInvalidError(err))
+		return
+	}
+	if ocimanifest.MediaType == "" {
+		ocimanifest.MediaType = r.Header.Get("Content-Type")
+	}
+	if !IsOCIManifestMediaType(ocimanifest.MediaType) {
+		ResponseOCIError(w, errors.NewContentTypeInvalidError(ocimanifest.MediaType))
+		return
+	}
+	manifest, err := ConvertFromOCIManifest(ocimanifest)
+	if err != nil {
+		ResponseOCIError(w, errors.NewManifestInvalidError(err))
+		return
+	}
+	if ocimanifest.Subject != nil {
+		if err := s.checkOCISubject(r.Context(), name, ocimanifest.Subject.Digest); err != nil {
+			ResponseOCIError(w, err)
+			return
+		}
+	}
+
+	// keep the original manifest, so it can be pulled by the same digest.
+	unlock, err := s.checkOverwrite(r, name, reference, func(existing *types.Manifest) bool {
+		return existing.Annotations[AnnotationOCIManifest] == contentDigest.String()
+	})
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	defer unlock()
+	original := BlobContent{
+		ContentType:   ocimanifest.MediaType,
+		ContentLength: int64(len(content)),
+		Content:       io.NopCloser(bytes.NewReader(content)),
+	}
+	if err := s.Store.PutBlob(r.Context(), name, contentDigest, original); err != nil {
+		log.Error(err, "store put original manifest")
+		ResponseOCIError(w, err)
+		return
+	}
+	if manifest.Annotations == nil {
+		manifest.Annotations = map[string]string{}
+	}
+	manifest.Annotations[AnnotationOCIManifest] = contentDigest.String()
+
+	oldDigest := s.previousManifestDigest(r.Context(), name, reference)
+	if err := s.putManifest(r.Context(), name, reference, MediaTypeModelManifestJson, manifest); err != nil {
+		log.Error(err, "store put manifest")
+		ResponseOCIError(w, err)
+		return
+	}
+	if newDigest, err := manifest.Digest(); err == nil {
+		s.audit(r, audit.Event{
+			Action:     audit.ActionPutManifest,
+			Repository: name,
+			Reference:  reference,
+			OldDigest:  oldDigest,
+			NewDigest:  newDigest.String(),
+			Details:    map[string]any{"ociDigest": contentDigest.String()},
+		})
+		s.notifyPush(r.Context(), name, reference, oldDigest, newDigest)
+	}
+	w.Header().Set("Location", "/v2/"+name+"/manifests/"+contentDigest.String())
+	w.Header().Set("Docker-Content-Digest", contentDigest.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Registry) OCIDeleteManifest(w http.ResponseWriter, r *http.Request) {
+	name, reference := GetRepositoryReference(r)
+	// versions are the tags deleted, deletes are the references to delete
+	versions := []string{reference}
+	deletes := versions
+	if dgst, err := digest.Parse(reference); err == nil {
+		// delete all tags point to the digest
+		versions, err = s.referencesOfOCIDigest(r.Context(), name, dgst)
+		if err != nil {
+			ResponseOCIError(w, err)
+			return
+		}
+		deletes = versions
+		// a manifest pushed by digest without tags
+		if len(versions) == 0 {
+			exists, err := s.Store.ExistsManifest(r.Context(), name, reference)
+			if err != nil {
+				ResponseOCIError(w, err)
+				return
+			}
+			if exists {
+				deletes = []string{reference}
+			}
+		}
+	}
+	if len(deletes) == 0 {
+		ResponseOCIError(w, errors.NewManifestUnknownError(reference))
+		return
+	}
+	if err := s.checkDelete(r, name, versions...); err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	for _, reference := range deletes {
+		oldDigest := s.previousManifestDigest(r.Context(), name, reference)
+		if err := s.Store.DeleteManifest(r.Context(), name, reference); err != nil {
+			if IsRegistryStoreNotNotFound(err) {
+				ResponseOCIError(w, errors.NewManifestUnknownError(reference))
+			} else {
+				ResponseOCIError(w, err)
+			}
+			return
+		}
+		s.audit(r, audit.Event{
+			Action:     audit.ActionDeleteManifest,
+			Repository: name,
+			Reference:  reference,
+			OldDigest:  oldDigest,
+		})
+		s.notifyDelete(r.Context(), name, oldDigest, reference)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// checkOCISubject checks the subject manifest exists, either pushed via oci api or converted from a modelx manifest.
+func (s *Registry) checkOCISubject(ctx context.Context, repository string, subject digest.Digest) error {
+	exists, err := s.Store.ExistsBlob(ctx, repository, subject)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	references, err := s.referencesOfOCIDigest(ctx, repository, subject)
+	if err != nil {
+		return err
+	}
+	if len(references) == 0 {
+		return errors.NewManifestUnknownError(subject.String())
+	}
+	return nil
+}
+
+// referencesOfOCIDigest returns the tags point to the manifest of the oci digest,
+// the manifest is found by the digest directly, see OCIManifestDigests.
+func (s *Registry) referencesOfOCIDigest(ctx context.Context, repository string, dgst digest.Digest) ([]string, error) {
+	manifest, err := s.Store.GetManifest(ctx, repository, dgst.String())
+	if err != nil {
+		if IsNotFoundOrUnknown(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	contentDigest, err := manifest.Digest()
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	index, err := s.Store.GetIndex(ctx, repository, "")
+	if err != nil {
+		if IsRegistryStoreNotNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	references := []string{}
+	for _, version := range index.Manifests {
+		if version.Digest == contentDigest {
+			references = append(references, version.Name)
+		}
+	}
+	return references, nil
+}
+
+func (s *Registry) OCIHeadBlob(w http.ResponseWriter, r *http.Request) {
+	BlobDigestFun(w, r, func(ctx context.Context, repository string, digest digest.Digest) {
+		if content, ok := wellKnownBlob(digest); ok {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("Docker-Content-Digest", digest.String())
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		exists, err := s.Store.ExistsBlob(ctx, repository, digest)
+		if err != nil {
+			ResponseOCIError(w, err)
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		meta, err := s.Store.GetBlobMeta(ctx, repository, digest)
+		if err != nil {
+			ResponseOCIError(w, err)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(meta.ContentLength, 10))
+		w.Header().Set("Docker-Content-Digest", digest.String())
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (s *Registry) OCIGetBlob(w http.ResponseWriter, r *http.Request) {
+	BlobDigestFun(w, r, func(ctx context.Context, repository string, digest digest.Digest) {
+		if content, ok := wellKnownBlob(digest); ok {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("Docker-Content-Digest", digest.String())
+			w.WriteHeader(http.StatusOK)
+			w.Write(content)
+			return
+		}
+		exists, err := s.Store.ExistsBlob(ctx, repository, digest)
+		if err != nil {
+			ResponseOCIError(w, err)
+			return
+		}
+		if !exists {
+			ResponseOCIError(w, errors.NewBlobUnknownError(digest))
+			return
+		}
+		result, err := s.Store.GetBlob(ctx, repository, digest)
+		if err != nil {
+			ResponseOCIError(w, err)
+			return
+		}
+		defer result.Close()
+
+		w.Header().Set("Docker-Content-Digest", digest.String())
+		ServeBlobContent(w, r, digest, result)
+	})
+}
+
+// wellKnownBlob returns the content of blobs which may be referenced but never uploaded.
+func wellKnownBlob(d digest.Digest) ([]byte, bool) {
+	switch d {
+	case OCIEmptyJSONDigest:
+		return OCIEmptyJSON, true
+	case EmptyBlobDigest:
+		return []byte{}, true
+	default:
+		return nil, false
+	}
+}
+
+func (s *Registry) OCIStartUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	// cross repository mount, fallback to upload if the blob not found
+	// mount only from the repositories the user can read
+	if mount, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from"); mount != "" && from != "" && s.canRead(r, from) {
+		if dgst, err := digest.Parse(mount); err == nil {
+			if err := s.mountBlob(r.Context(), name, from, dgst); err == nil {
+				s.audit(r, audit.Event{
+					Action:     audit.ActionPutBlob,
+					Repository: name,
+					NewDigest:  dgst.String(),
+					Details:    map[string]any{"from": from},
+				})
+				w.Header().Set("Location", "/v2/"+name+"/blobs/"+dgst.String())
+				w.Header().Set("Docker-Content-Digest", dgst.String())
+				w.WriteHeader(http.StatusCreated)
+				return
+			} else if !errors.IsErrCode(err, errors.ErrCodeBlobUnknown) {
+				ResponseOCIError(w, err)
+				return
+			}
+		}
+	}
+	upload, err := s.Uploads.Create(name, UsernameFromContext(r.Context()), "")
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	// monolithic upload, the session is unknown to the client, so it can not be resumed on failures
+	if digeststr := r.URL.Query().Get("digest"); digeststr != "" {
+		defer s.Uploads.Cancel(upload)
+		s.completeOCIUpload(w, r, upload, digeststr)
+		return
+	}
+	responseOCIUploadStatus(w, upload, http.StatusAccepted)
+}
+
+func (s *Registry) OCIGetUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	responseOCIUploadStatus(w, upload, http.StatusNoContent)
+}
+
+func (s *Registry) OCIPatchUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	start, end, err := ParseUploadRange(r)
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	var content io.Reader = r.Body
+	if start >= 0 {
+		content = io.LimitReader(r.Body, end-start+1)
+	}
+	if _, err := s.Uploads.Append(r.Context(), upload, start, content); err != nil {
+		if errors.IsErrCode(err, errors.ErrCodeBlobUploadInvalid) {
+			setOCIUploadHeaders(w, upload)
+		}
+		ResponseOCIError(w, err)
+		return
+	}
+	responseOCIUploadStatus(w, upload, http.StatusAccepted)
+}
+
+func (s *Registry) OCIPutUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	s.completeOCIUpload(w, r, upload, r.URL.Query().Get("digest"))
+}
+
+func (s *Registry) OCIDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	name, _ := GetRepositoryReference(r)
+	upload, err := s.Uploads.Get(name, UsernameFromContext(r.Context()), mux.Vars(r)["uuid"])
+	if err != nil {
+		ResponseOCIError(w, err)
+		return
+	}
+	s.Uploads.Cancel(upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Registry) completeOCIUpload(w http.ResponseWriter, r *http.Request, upload *BlobUpload, digeststr string) {
+	log := logr.FromContextOrDiscard(r.Context()).WithValues("action", "oci-put-blob", "repository", upload.Repository, "digest", digeststr)
+	dgst, err := digest.Parse(digeststr)
+	if err != nil {
+		s.Uploads.Cancel(upload)
+		ResponseOCIError(w, errors.NewDigestInvalidError(digeststr))
+		return
+	}
+	if _, err := s.Uploads.Append(r.Context(), upload, -1, r.Body); err != nil {
+		s.Uploads.Cancel(upload)
+		ResponseOCIError(w, err)
+		return
+	}
+	if err := s.Uploads.Commit(r.Context(), s.Store, upload, dgst, "application/octet-stream"); err != nil {
+		log.Error(err, "commit upload")
+		ResponseOCIError(w, err)
+		return
+	}
+	s.audit(r, audit.Event{
+		Action:     audit.ActionPutBlob,
+		Repository: upload.Repository,
+		NewDigest:  dgst.String(),
+		Details:    map[string]any{"size": upload.Offset()},
+	})
+	w.Header().Set("Location", "/v2/"+upload.Repository+"/blobs/"+dgst.String())
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+func responseOCIUploadStatus(w http.ResponseWriter, upload *BlobUpload, status int) {
+	setOCIUploadHeaders(w, upload)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+}
+
+func setOCIUploadHeaders(w http.ResponseWriter, upload *BlobUpload) {
+	w.Header().Set("Location", "/v2/"+upload.Repository+"/blobs/uploads/"+upload.ID)
+	w.Header().Set("Docker-Upload-UUID", upload.ID)
+	end := upload.Offset() - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Range", "0-"+strconv.FormatInt(end, 10))
+}
+
+// ResponseOCIError writes err in the oci distribution error format.
+func ResponseOCIError(w http.ResponseWriter, err error) {
+	info := errors.ErrorInfo{}
+	if !stderrors.As(err, &info) {
+		info = errors.ErrorInfo{
+			HttpStatus: http.StatusBadRequest,
+			Code:       errors.ErrCodeUnknow,
+			Message:    err.Error(),
+			Detail:     err.Error(),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(info.HttpStatus)
+	json.NewEncoder(w).Encode(map[string]any{"errors": []errors.ErrorInfo{info}})
+}
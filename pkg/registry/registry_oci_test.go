@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// serveOCI calls the oci api of s.
+func serveOCI(t *testing.T, s *Registry, method, target string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := mux.NewRouter()
+	s.ociRoute(router)
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// ociErrorCode returns the code of the first error in the oci error response.
+func ociErrorCode(rec *httptest.ResponseRecorder) errors.ErrCode {
+	resp := struct {
+		Errors []errors.ErrorInfo `json:"errors"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Errors) == 0 {
+		return ""
+	}
+	return resp.Errors[0].Code
+}
+
+// putTestOCIManifest pushes an oci artifact manifest of the blobs by reference, returns its content.
+func putTestOCIManifest(t *testing.T, s *Registry, repository, reference string, subject *OCIDescriptor, blobs ...string) []byte {
+	t.Helper()
+	manifest := OCIManifest{MediaType: MediaTypeOCIArtifactManifest, Subject: subject}
+	for _, blob := range blobs {
+		desc := putTestBlob(t, s.Store, repository, blob)
+		manifest.Blobs = append(manifest.Blobs, OCIDescriptor{
+			MediaType:   "application/octet-stream",
+			Digest:      desc.Digest,
+			Size:        desc.Size,
+			Annotations: map[string]string{OCIAnnotationTitle: blob},
+		})
+	}
+	content, dgst, err := MarshalOCIManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reference == "" {
+		reference = dgst.String()
+	}
+	rec := serveOCI(t, s, http.MethodPut, "/v2/"+repository+"/manifests/"+reference, content,
+		map[string]string{"Content-Type": MediaTypeOCIArtifactManifest})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT manifest %s status = %d, body = %s", reference, rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Docker-Content-Digest"); got != dgst.String() {
+		t.Fatalf("Docker-Content-Digest = %s, want %s", got, dgst)
+	}
+	return content
+}
+
+func TestOCIPutManifestByDigest(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStore(t)
+	s := &Registry{Store: store}
+	repository := "project/a"
+
+	subject := putTestOCIManifest(t, s, repository, "v1", nil, "weights")
+	subjectDesc := &OCIDescriptor{MediaType: MediaTypeOCIArtifactManifest, Digest: digest.FromBytes(subject), Size: int64(len(subject))}
+	referrer := putTestOCIManifest(t, s, repository, "", subjectDesc, "signature")
+	referrerDigest := digest.FromBytes(referrer)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := serveOCI(t, s, method, "/v2/"+repository+"/manifests/"+referrerDigest.String(), nil, nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != MediaTypeOCIArtifactManifest {
+			t.Fatalf("%s manifest by digest status = %d, content type = %s", method, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if method == http.MethodGet && !bytes.Equal(rec.Body.Bytes(), referrer) {
+			t.Errorf("GET manifest by digest = %s, want the pushed content", rec.Body)
+		}
+	}
+	// not a version
+	rec := serveOCI(t, s, http.MethodGet, "/v2/"+repository+"/tags/list", nil, nil)
+	if !strings.Contains(rec.Body.String(), `"tags":["v1"]`) {
+		t.Errorf("tags = %s, want v1 only", rec.Body)
+	}
+
+	// the digest must be of the content
+	rec = serveOCI(t, s, http.MethodPut, "/v2/"+repository+"/manifests/"+subjectDesc.Digest.String(), referrer,
+		map[string]string{"Content-Type": MediaTypeOCIArtifactManifest})
+	if code := ociErrorCode(rec); code != errors.ErrCodeDigestInvalid {
+		t.Errorf("PUT manifest by another digest code = %q, want %q", code, errors.ErrCodeDigestInvalid)
+	}
+
+	// the untagged manifest keeps its blobs
+	if _, err := GCBlobs(ctx, store, repository, GCOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := store.ExistsBlob(ctx, repository, digest.FromString("signature")); !exists {
+		t.Fatal("blob of the manifest pushed by digest removed by gc")
+	}
+
+	rec = serveOCI(t, s, http.MethodDelete, "/v2/"+repository+"/manifests/"+referrerDigest.String(), nil, nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("DELETE manifest by digest status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if exists, _ := store.ExistsManifest(ctx, repository, referrerDigest.String()); exists {
+		t.Error("manifest exists after deleted by digest")
+	}
+	if exists, _ := store.ExistsManifest(ctx, repository, "v1"); !exists {
+		t.Error("subject deleted along with the manifest pushed by digest")
+	}
+	if _, err := GCBlobs(ctx, store, repository, GCOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := store.ExistsBlob(ctx, repository, digest.FromString("signature")); exists {
+		t.Error("blob of the deleted manifest not collected")
+	}
+}
+
+// countingStore counts the manifests read.
+type countingStore struct {
+	RegistryStore
+	manifestReads int
+}
+
+func (c *countingStore) GetManifest(ctx context.Context, repository string, reference string) (*types.Manifest, error) {
+	c.manifestReads++
+	return c.RegistryStore.GetManifest(ctx, repository, reference)
+}
+
+func TestOCIManifestByConvertedDigest(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStore(t)
+	counting := &countingStore{RegistryStore: store}
+	s := &Registry{Store: counting}
+	repository := "project/a"
+	for _, version := range []string{"v1", "v2", "v3", "v4", "v5"} {
+		putTestManifest(t, store, repository, version, testManifest(putTestBlob(t, store, repository, "weights of "+version)))
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+	}{
+		{name: "artifact", accept: MediaTypeOCIArtifactManifest},
+		{name: "image", accept: MediaTypeOCIImageManifest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]string{"Accept": tt.accept}
+			byTag := serveOCI(t, s, http.MethodGet, "/v2/"+repository+"/manifests/v3", nil, header)
+			dgst := byTag.Header().Get("Docker-Content-Digest")
+			if byTag.Code != http.StatusOK || dgst == "" {
+				t.Fatalf("GET manifest by tag status = %d", byTag.Code)
+			}
+			counting.manifestReads = 0
+			byDigest := serveOCI(t, s, http.MethodGet, "/v2/"+repository+"/manifests/"+dgst, nil, header)
+			if byDigest.Code != http.StatusOK || !bytes.Equal(byDigest.Body.Bytes(), byTag.Body.Bytes()) ||
+				byDigest.Header().Get("Content-Type") != tt.accept {
+				t.Fatalf("GET manifest by digest status = %d, content type = %s", byDigest.Code, byDigest.Header().Get("Content-Type"))
+			}
+			if counting.manifestReads != 1 {
+				t.Errorf("GET manifest by digest read %d manifests, want 1", counting.manifestReads)
+			}
+			references, err := s.referencesOfOCIDigest(ctx, repository, digest.Digest(dgst))
+			if err != nil || len(references) != 1 || references[0] != "v3" {
+				t.Errorf("referencesOfOCIDigest() = %v, %v, want v3", references, err)
+			}
+		})
+	}
+	unknown := digest.FromString("unknown").String()
+	counting.manifestReads = 0
+	if rec := serveOCI(t, s, http.MethodHead, "/v2/"+repository+"/manifests/"+unknown, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD unknown manifest status = %d, want 404", rec.Code)
+	}
+	if counting.manifestReads > 1 {
+		t.Errorf("HEAD unknown manifest read %d manifests, want at most 1", counting.manifestReads)
+	}
+}
+
+func TestFSRegistryStoreReindexManifestDigests(t *testing.T) {
+	ctx := context.Background()
+	store, basepath := newTestFSStore(t)
+	repository := "project/a"
+	manifest := testManifest(putTestBlob(t, store, repository, "weights"))
+	putTestManifest(t, store, repository, "v1", manifest)
+	// versions put by an older modelxd are stored by tags only
+	if err := os.RemoveAll(filepath.Join(basepath, repository, "digests")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reindex(ctx); err != nil {
+		t.Fatal(err)
+	}
+	contentDigest, _ := manifest.Digest()
+	for _, dgst := range manifestDigests(manifest, contentDigest) {
+		if exists, _ := store.ExistsManifest(ctx, repository, dgst.String()); !exists {
+			t.Errorf("manifest not stored by %s after reindex", dgst)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"gopkg.in/yaml.v3"
+	"kubegems.io/modelx/pkg/audit"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// RetentionPolicy is the retention rules of repositories, loaded from the retention config file.
+//
+//	rules:
+//	  - repository: "project/*"
+//	    keepLast: 10
+//	    olderThan: 720h
+//	    keep: '^v\d+\.\d+\.\d+$'
+type RetentionPolicy struct {
+	Rules []RetentionRule `json:"rules" yaml:"rules"`
+}
+
+type RetentionRule struct {
+	// Repository selects the repositories the rule applies to,
+	// "project/name" for a repository, "project/*" for all repositories of a project and "*" for all repositories.
+	Repository string `json:"repository" yaml:"repository"`
+	// KeepLast keeps the latest N versions, 0 means not limited by count.
+	KeepLast int `json:"keepLast,omitempty" yaml:"keepLast,omitempty"`
+	// OlderThan keeps the versions modified within the duration, empty means not limited by age.
+	OlderThan string `json:"olderThan,omitempty" yaml:"olderThan,omitempty"`
+	// Keep is a regexp of version names always kept.
+	Keep string `json:"keep,omitempty" yaml:"keep,omitempty"`
+
+	olderThan time.Duration
+	keep      *regexp.Regexp
+}
+
+type RetentionResult struct {
+	DryRun bool   `json:"dryRun"`
+	Rule   string `json:"rule,omitempty"`
+	// Versions is the status of each version to delete, keyed by {repository}@{version}.
+	Versions map[string]string `json:"versions"`
+	// GC is the result of the garbage collect ran after versions deleted.
+	GC *GCResult `json:"gc,omitempty"`
+}
+
+const (
+	RetentionStatusExpired = "expired"
+	RetentionStatusDeleted = "deleted"
+)
+
+func LoadRetentionPolicy(file string) (*RetentionPolicy, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &RetentionPolicy{}
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("parse retention config %s: %w", file, err)
+	}
+	if err := policy.Complete(); err != nil {
+		return nil, fmt.Errorf("retention config %s: %w", file, err)
+	}
+	return policy, nil
+}
+
+// Complete validates the rules and compiles the durations and patterns.
+func (p *RetentionPolicy) Complete() error {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if _, err := path.Match(rule.Repository, ""); err != nil || rule.Repository == "" {
+			return fmt.Errorf("rule %d: invalid repository pattern %q", i, rule.Repository)
+		}
+		if rule.KeepLast < 0 {
+			return fmt.Errorf("rule %d: keepLast must not be negative", i)
+		}
+		if rule.OlderThan != "" {
+			olderThan, err := time.ParseDuration(rule.OlderThan)
+			if err != nil || olderThan <= 0 {
+				return fmt.Errorf("rule %d: invalid olderThan %q", i, rule.OlderThan)
+			}
+			rule.olderThan = olderThan
+		}
+		if rule.Keep != "" {
+			keep, err := regexp.Compile(rule.Keep)
+			if err != nil {
+				return fmt.Errorf("rule %d: invalid keep %q: %w", i, rule.Keep, err)
+			}
+			rule.keep = keep
+		}
+		if rule.KeepLast == 0 && rule.olderThan == 0 {
+			return fmt.Errorf("rule %d: at least one of keepLast and olderThan is required", i)
+		}
+	}
+	return nil
+}
+
+// RuleOf returns the rule applies to repository, a rule of the repository itself takes precedence over patterns,
+// otherwise the first matched pattern is used.
+func (p *RetentionPolicy) RuleOf(repository string) *RetentionRule {
+	if p == nil {
+		return nil
+	}
+	for i := range p.Rules {
+		if p.Rules[i].Repository == repository {
+			return &p.Rules[i]
+		}
+	}
+	for i := range p.Rules {
+		if MatchRepository(p.Rules[i].Repository, repository) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Expired returns the versions of index to delete, immutable versions are checked by caller.
+// A version is deleted only when it is out of every configured limit and not matched by keep.
+func (r *RetentionRule) Expired(index types.Index, now time.Time) []string {
+	versions := make([]types.Descriptor, 0, len(index.Manifests))
+	for _, version := range index.Manifests {
+		if r.keep != nil && r.keep.MatchString(version.Name) {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	// latest first
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Modified.After(versions[j].Modified)
+	})
+	expired := []string{}
+	for i, version := range versions {
+		if r.KeepLast > 0 && i < r.KeepLast {
+			continue
+		}
+		if r.olderThan > 0 && now.Sub(version.Modified) < r.olderThan {
+			continue
+		}
+		expired = append(expired, version.Name)
+	}
+	return expired
+}
+
+// applyRetention deletes the expired versions of repository, and collects the blobs no longer used if any deleted.
+func (s *Registry) applyRetention(ctx context.Context, repository string, dryrun bool) (*RetentionResult, error) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("repository", repository, "dryRun", dryrun)
+
+	result := &RetentionResult{DryRun: dryrun, Versions: map[string]string{}}
+	rule := s.Retention.RuleOf(repository)
+	if rule == nil {
+		return result, nil
+	}
+	result.Rule = rule.Repository
+	if err := s.applyRetentionRule(ctx, rule, repository, dryrun, result); err != nil {
+		return nil, err
+	}
+	if dryrun || len(result.Versions) == 0 {
+		return result, nil
+	}
+	gcresult, err := GCBlobs(ctx, s.Store, repository, s.GCOptions())
+	if err != nil {
+		log.Error(err, "garbage collect after retention")
+		return nil, err
+	}
+	result.GC = gcresult
+	return result, nil
+}
+
+// applyRetentionAll deletes the expired versions of all repositories, and collects the blobs no longer used if any deleted.
+func (s *Registry) applyRetentionAll(ctx context.Context, dryrun bool) (*RetentionResult, error) {
+	repositories, err := listRepositories(ctx, s.Store)
+	if err != nil {
+		return nil, err
+	}
+	result := &RetentionResult{DryRun: dryrun, Versions: map[string]string{}}
+	for _, repository := range repositories {
+		rule := s.Retention.RuleOf(repository)
+		if rule == nil {
+			continue
+		}
+		if err := s.applyRetentionRule(ctx, rule, repository, dryrun, result); err != nil {
+			return nil, err
+		}
+	}
+	if dryrun || len(result.Versions) == 0 {
+		return result, nil
+	}
+	gcresult, err := GCBlobsAll(ctx, s.Store, s.GCOptions())
+	if err != nil {
+		return nil, err
+	}
+	result.GC = gcresult
+	return result, nil
+}
+
+func (s *Registry) applyRetentionRule(ctx context.Context, rule *RetentionRule, repository string, dryrun bool, result *RetentionResult) error {
+	log := logr.FromContextOrDiscard(ctx).WithValues("repository", repository, "rule", rule.Repository)
+
+	index, err := s.Store.GetIndex(ctx, repository, "")
+	if err != nil {
+		if IsRegistryStoreNotNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	for _, version := range rule.Expired(index, time.Now()) {
+		if s.Immutability.IsImmutable(repository, version) {
+			continue
+		}
+		key := repository + "@" + version
+		if dryrun {
+			result.Versions[key] = RetentionStatusExpired
+			continue
+		}
+		oldDigest := s.previousManifestDigest(ctx, repository, version)
+		if err := s.Store.DeleteManifest(ctx, repository, version); err != nil {
+			if IsNotFoundOrUnknown(err) {
+				continue
+			}
+			log.Error(err, "delete expired version", "version", version)
+			return err
+		}
+		log.Info("deleted expired version", "version", version)
+		s.recordAudit(ctx, audit.Event{
+			Action:     audit.ActionDeleteManifest,
+			Repository: repository,
+			Reference:  version,
+			OldDigest:  oldDigest,
+			Details:    map[string]any{"versions": []string{version}, "retention": rule.Repository},
+		})
+		s.notifyDelete(ctx, repository, oldDigest, version)
+		result.Versions[key] = RetentionStatusDeleted
+	}
+	return nil
+}
+
+// RunRetention applies the retention policy to all repositories every interval until ctx done.
+func (s *Registry) RunRetention(ctx context.Context, opts RetentionOptions) {
+	log := logr.FromContextOrDiscard(ctx).WithName("retention")
+	ctx = logr.NewContext(ctx, log)
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			unlock := s.lockGC()
+			result, err := s.applyRetentionAll(ctx, opts.DryRun)
+			unlock()
+			if err != nil {
+				log.Error(err, "periodic retention")
+				continue
+			}
+			log.Info("retention applied", "dryRun", opts.DryRun, "versions", result.Versions)
+		}
+	}
+}
+
+// listRepositories returns the repositories in the global index, those have versions.
+func listRepositories(ctx context.Context, store RegistryStore) ([]string, error) {
+	globalindex, err := store.GetGlobalIndex(ctx, "")
+	if err != nil {
+		if IsRegistryStoreNotNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	repositories := make([]string, 0, len(globalindex.Manifests))
+	for _, desc := range globalindex.Manifests {
+		repositories = append(repositories, desc.Name)
+	}
+	return repositories, nil
+}
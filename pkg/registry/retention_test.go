@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/audit"
+	"kubegems.io/modelx/pkg/notification"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func TestRetentionRuleExpired(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	index := types.Index{Manifests: []types.Descriptor{
+		{Name: "v1.0.0", Modified: now.Add(-72 * time.Hour)},
+		{Name: "dev-1", Modified: now.Add(-48 * time.Hour)},
+		{Name: "dev-2", Modified: now.Add(-24 * time.Hour)},
+		{Name: "dev-3", Modified: now.Add(-time.Hour)},
+	}}
+
+	tests := []struct {
+		name string
+		rule RetentionRule
+		want []string
+	}{
+		{name: "keep last", rule: RetentionRule{KeepLast: 2}, want: []string{"dev-1", "v1.0.0"}},
+		{name: "keep all by count", rule: RetentionRule{KeepLast: 10}, want: []string{}},
+		{name: "older than", rule: RetentionRule{OlderThan: "36h"}, want: []string{"dev-1", "v1.0.0"}},
+		{name: "out of both limits", rule: RetentionRule{KeepLast: 3, OlderThan: "12h"}, want: []string{"v1.0.0"}},
+		{name: "keep pattern", rule: RetentionRule{KeepLast: 1, Keep: `^v\d+\.\d+\.\d+$`}, want: []string{"dev-1", "dev-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Repository = "*"
+			policy := &RetentionPolicy{Rules: []RetentionRule{tt.rule}}
+			if err := policy.Complete(); err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			got := policy.Rules[0].Expired(index, now)
+			sort.Strings(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyComplete(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RetentionRule
+		wantErr bool
+	}{
+		{name: "valid", rule: RetentionRule{Repository: "project/*", KeepLast: 1, OlderThan: "24h", Keep: "^v"}},
+		{name: "no repository", rule: RetentionRule{KeepLast: 1}, wantErr: true},
+		{name: "invalid repository pattern", rule: RetentionRule{Repository: "[", KeepLast: 1}, wantErr: true},
+		{name: "no limit", rule: RetentionRule{Repository: "*"}, wantErr: true},
+		{name: "negative keep last", rule: RetentionRule{Repository: "*", KeepLast: -1}, wantErr: true},
+		{name: "invalid older than", rule: RetentionRule{Repository: "*", OlderThan: "1d"}, wantErr: true},
+		{name: "negative older than", rule: RetentionRule{Repository: "*", OlderThan: "-1h"}, wantErr: true},
+		{name: "invalid keep", rule: RetentionRule{Repository: "*", KeepLast: 1, Keep: "("}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &RetentionPolicy{Rules: []RetentionRule{tt.rule}}
+			if err := policy.Complete(); (err != nil) != tt.wantErr {
+				t.Errorf("Complete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyRuleOf(t *testing.T) {
+	policy := &RetentionPolicy{Rules: []RetentionRule{
+		{Repository: "*", KeepLast: 100},
+		{Repository: "project/*", KeepLast: 10},
+		{Repository: "project/demo", KeepLast: 1},
+	}}
+	tests := []struct {
+		repository string
+		want       string
+	}{
+		{repository: "project/demo", want: "project/demo"},
+		{repository: "project/other", want: "*"},
+		{repository: "other/demo", want: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			rule := policy.RuleOf(tt.repository)
+			if rule == nil || rule.Repository != tt.want {
+				t.Errorf("RuleOf() = %v, want %s", rule, tt.want)
+			}
+		})
+	}
+	if (*RetentionPolicy)(nil).RuleOf("project/demo") != nil {
+		t.Errorf("RuleOf() of nil policy expect nil")
+	}
+}
+
+type memoryAuditSink struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (m *memoryAuditSink) Write(ctx context.Context, event audit.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestRegistryApplyRetention(t *testing.T) {
+	ctx := context.Background()
+	store, basepath := newTestFSStore(t)
+	sink := &memoryAuditSink{}
+	s := &Registry{
+		Store:        store,
+		Retention:    &RetentionPolicy{Rules: []RetentionRule{{Repository: "project/*", OlderThan: "1h"}}},
+		Immutability: &ImmutabilityPolicy{Rules: []ImmutabilityRule{{Repository: "*", Tags: []string{"v*"}}}},
+		Audit:        audit.NewAuditor(sink),
+		Events:       notification.NewBroker(0),
+	}
+	if err := s.Retention.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v1", "dev-1", "dev-2"} {
+		putTestManifest(t, store, "project/demo", version, testManifest(putTestBlob(t, store, "project/demo", version)))
+	}
+	ageStorage(t, basepath, 2*time.Hour)
+	putTestManifest(t, store, "project/demo", "dev-3", testManifest(putTestBlob(t, store, "project/demo", "dev-3")))
+
+	dryrun, err := s.applyRetention(ctx, "project/demo", true)
+	if err != nil {
+		t.Fatalf("applyRetention() dry run error = %v", err)
+	}
+	want := map[string]string{"project/demo@dev-1": RetentionStatusExpired, "project/demo@dev-2": RetentionStatusExpired}
+	if !mapsEqual(dryrun.Versions, want) || len(sink.events) != 0 {
+		t.Fatalf("dry run versions = %v, events = %v, want %v and no events", dryrun.Versions, sink.events, want)
+	}
+
+	_, events, cancel := s.Events.Subscribe("")
+	defer cancel()
+	result, err := s.applyRetention(NewUsernameContext(ctx, "admin"), "project/demo", false)
+	if err != nil {
+		t.Fatalf("applyRetention() error = %v", err)
+	}
+	want = map[string]string{"project/demo@dev-1": RetentionStatusDeleted, "project/demo@dev-2": RetentionStatusDeleted}
+	if !mapsEqual(result.Versions, want) {
+		t.Fatalf("versions = %v, want %v", result.Versions, want)
+	}
+	if result.GC == nil || len(result.GC.Blobs) != 2 {
+		t.Errorf("gc = %v, want the blobs of deleted versions removed", result.GC)
+	}
+	index, err := store.GetIndex(ctx, "project/demo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remains := []string{}
+	for _, version := range index.Manifests {
+		remains = append(remains, version.Name)
+	}
+	sort.Strings(remains)
+	if !slices.Equal(remains, []string{"dev-3", "v1"}) {
+		t.Errorf("remain versions = %v, want immutable v1 and recent dev-3", remains)
+	}
+
+	// every version deleted is audited
+	audited := []string{}
+	for _, event := range sink.events {
+		if event.Action != audit.ActionDeleteManifest || event.User != "admin" ||
+			event.OldDigest == "" || event.Details["retention"] != "project/*" {
+			t.Errorf("unexpected audit event %+v", event)
+		}
+		audited = append(audited, event.Reference)
+	}
+	sort.Strings(audited)
+	if !slices.Equal(audited, []string{"dev-1", "dev-2"}) {
+		t.Errorf("audited versions = %v, want dev-1 and dev-2", audited)
+	}
+
+	// and notified
+	notified := []string{}
+	for len(events) > 0 {
+		entry := <-events
+		if entry.Event.Action != notification.ActionDelete || entry.Event.Actor != "admin" || entry.Event.Digest == "" {
+			t.Errorf("unexpected event %+v", entry.Event)
+		}
+		notified = append(notified, entry.Event.Reference)
+	}
+	sort.Strings(notified)
+	if !slices.Equal(notified, []string{"dev-1", "dev-2"}) {
+		t.Errorf("notified versions = %v, want dev-1 and dev-2", notified)
+	}
+}
+
+func mapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -12,7 +12,7 @@ const (
 	DigestRegexp    = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*[:][[:xdigit:]]{32,}`
 )
 
-func (s *Registry) route() http.Handler {
+func (s *Registry) route() *mux.Router {
 	mux := mux.NewRouter()
 	mux = mux.StrictSlash(true)
 	// healthy
@@ -20,32 +20,55 @@ func (s *Registry) route() http.Handler {
 		w.Write([]byte("ok"))
 		w.WriteHeader(http.StatusOK)
 	})
+	// oci distribution
+	s.ociRoute(mux)
+	// api tokens, "_tokens" never conflicts with repository names
+	mux.Methods("GET").Path("/_tokens").HandlerFunc(s.ListAPITokens)
+	mux.Methods("POST").Path("/_tokens").HandlerFunc(MaxBytesReadHandler(s.CreateAPIToken, MaxBytesRead))
+	mux.Methods("DELETE").Path("/_tokens/{id:[0-9a-f]+}").HandlerFunc(s.RevokeAPIToken)
+	// projects
+	mux.Methods("GET").Path("/_projects/{project:" + ProjectRegexp + "}").HandlerFunc(s.GetProject)
+	mux.Methods("PUT").Path("/_projects/{project:" + ProjectRegexp + "}").HandlerFunc(MaxBytesReadHandler(s.PutProject, MaxBytesRead))
+	// event stream
+	mux.Methods("GET").Path("/events").HandlerFunc(s.StreamEvents)
 	// global index
 	mux.Methods("GET").Path("/").HandlerFunc(s.GetGlobalIndex)
 	// repository
 	repository := mux.PathPrefix("/{name:" + NameRegexp + "}").Subrouter()
 
 	// gc
-	repository.Methods("POST").Path("/garbage-collect").HandlerFunc(s.GarbageCollect)
+	repository.Methods("POST").Path("/garbage-collect").HandlerFunc(s.authorize(RoleAdmin, s.GarbageCollect))
+	// retention
+	repository.Methods("POST").Path("/retention").HandlerFunc(s.authorize(RoleAdmin, s.ApplyRetention))
 
 	// index
-	repository.Methods("GET").Path("/index").HandlerFunc(s.GetIndex)
-	repository.Methods("DELETE").Path("/index").HandlerFunc(s.DeleteIndex)
+	repository.Methods("GET").Path("/index").HandlerFunc(s.authorize(RoleReader, s.GetIndex))
+	repository.Methods("DELETE").Path("/index").HandlerFunc(s.authorize(RoleAdmin, s.DeleteIndex))
 	// repository/manifests
 	manifests := repository.PathPrefix("/manifests").Subrouter()
-	manifests.Methods("GET").Path("/{reference:" + ReferenceRegexp + "}").HandlerFunc(s.GetManifest)
-	manifests.Methods("PUT").Path("/{reference:" + ReferenceRegexp + "}").HandlerFunc(MaxBytesReadHandler(s.PutManifest, MaxBytesRead))
-	manifests.Methods("DELETE").Path("/{reference:" + ReferenceRegexp + "}").HandlerFunc(s.DeleteManifest)
+	manifestReference := "/{reference:" + ReferenceRegexp + "|" + DigestRegexp + "}"
+	manifests.Methods("GET").Path(manifestReference).HandlerFunc(s.authorize(RoleReader, s.GetManifest))
+	manifests.Methods("PUT").Path(manifestReference).HandlerFunc(s.authorize(RoleWriter, MaxBytesReadHandler(s.PutManifest, MaxBytesRead)))
+	manifests.Methods("DELETE").Path(manifestReference).HandlerFunc(s.authorize(RoleWriter, s.DeleteManifest))
 
 	// repository/blobs
 	blobs := repository.PathPrefix("/blobs").Subrouter()
-	blobs.Methods("HEAD").Path("/{digest:" + DigestRegexp + "}").HandlerFunc(s.HeadBlob)
-	blobs.Methods("GET").Path("/{digest:" + DigestRegexp + "}").HandlerFunc(s.GetBlob)
-	blobs.Methods("PUT").Path("/{digest:" + DigestRegexp + "}").HandlerFunc(s.PutBlob)
+	blobs.Methods("HEAD").Path("/{digest:" + DigestRegexp + "}").HandlerFunc(s.authorize(RoleReader, s.HeadBlob))
+	blobs.Methods("GET").Path("/{digest:" + DigestRegexp + "}").HandlerFunc(s.authorize(RoleReader, s.GetBlob))
+	blobs.Methods("PUT").Path("/{digest:" + DigestRegexp + "}").HandlerFunc(s.authorize(RoleWriter, s.PutBlob))
+
+	// repository/blobs/uploads
+	uploads := repository.PathPrefix("/blobs/uploads").Subrouter()
+	uploads.Methods("POST").Path("/").HandlerFunc(s.authorize(RoleWriter, s.StartBlobUpload))
+	uploads.Methods("GET").Path("/{uuid}").HandlerFunc(s.authorize(RoleWriter, s.GetBlobUpload))
+	uploads.Methods("PATCH").Path("/{uuid}").HandlerFunc(s.authorize(RoleWriter, s.PatchBlobUpload))
+	uploads.Methods("PUT").Path("/{uuid}").HandlerFunc(s.authorize(RoleWriter, s.PutBlobUpload))
+	uploads.Methods("DELETE").Path("/{uuid}").HandlerFunc(s.authorize(RoleWriter, s.DeleteBlobUpload))
 
 	// repository/blobs/locations
 	blobLocations := repository.PathPrefix("/blobs/{digest:" + DigestRegexp + "}/locations").Subrouter()
-	blobLocations.Methods("GET").Path("/{purpose}").HandlerFunc(s.GetBlobLocation)
+	blobLocations.Methods("GET").Path("/{purpose:" + BlobLocationPurposeDownload + "}").HandlerFunc(s.authorize(RoleReader, s.GetBlobLocation))
+	blobLocations.Methods("GET").Path("/{purpose:" + BlobLocationPurposeUpload + "}").HandlerFunc(s.authorize(RoleWriter, s.GetBlobLocation))
 
 	return mux
 }
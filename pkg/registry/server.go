@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"kubegems.io/modelx/pkg/audit"
+	"kubegems.io/modelx/pkg/auth"
+	"kubegems.io/modelx/pkg/notification"
 )
 
 func Run(ctx context.Context, opts *Options) error {
@@ -16,12 +21,27 @@ func Run(ctx context.Context, opts *Options) error {
 		return err
 	}
 
-	handler := registry.route()
-	handler = LoggingFilter(log, handler)
+	router := registry.route()
+	if opts.MetricsListen == "" {
+		router.Methods("GET").Path("/metrics").Handler(registry.MetricsHandler())
+	}
+	handler := LoggingFilter(log, router)
 
-	if opts.OIDC.Issuer != "" {
-		handler = NewOIDCAuthFilter(ctx, opts.OIDC.Issuer, handler)
+	tokens, passwords, err := NewAuthenticator(ctx, opts)
+	if err != nil {
+		return err
 	}
+	if tokens != nil || passwords != nil {
+		// api tokens issued by the registry work along with the configured authentication
+		if tokens != nil {
+			tokens = auth.Union(registry.Tokens, tokens)
+		} else {
+			tokens = registry.Tokens
+		}
+		handler = NewAuthFilter(tokens, passwords, handler)
+	}
+	handler = MetricsFilter(router, handler)
+	handler = TracingFilter(router, handler)
 
 	server := http.Server{
 		Addr:    opts.Listen,
@@ -30,6 +50,18 @@ func Run(ctx context.Context, opts *Options) error {
 			return ctx
 		},
 	}
+	if opts.GC.Interval > 0 {
+		go registry.RunGC(ctx, *opts.GC)
+	}
+	if opts.UploadTTL > 0 {
+		go registry.Uploads.RunCleanup(ctx, opts.UploadTTL)
+	}
+	if opts.Retention.Interval > 0 && registry.Retention != nil {
+		go registry.RunRetention(ctx, *opts.Retention)
+	}
+	if opts.MetricsListen != "" {
+		go RunMetricsServer(ctx, opts.MetricsListen)
+	}
 	go func() {
 		<-ctx.Done()
 		server.Shutdown(ctx)
@@ -43,26 +75,171 @@ func Run(ctx context.Context, opts *Options) error {
 	}
 }
 
+// Reindex rebuilds the indexes from storage, modelxd must be stopped if the metadata database is used, it's locked by modelxd.
+func Reindex(ctx context.Context, opts *Options) error {
+	fs, err := NewFSProvider(ctx, opts)
+	if err != nil {
+		return err
+	}
+	metadata, err := NewMetadataDB(opts)
+	if err != nil {
+		return err
+	}
+	if metadata != nil {
+		defer metadata.Close()
+	}
+	store := &FSRegistryStore{FS: fs, Metadata: metadata}
+	return store.Reindex(ctx)
+}
+
+// RunMetricsServer serves metrics on listen until ctx done.
+func RunMetricsServer(ctx context.Context, listen string) {
+	log := logr.FromContextOrDiscard(ctx).WithName("metrics")
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := http.Server{Addr: listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(ctx)
+	}()
+	log.Info("metrics listening", "http", listen)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error(err, "serve metrics")
+	}
+}
+
+// NewAuthenticator returns the authenticators of bearer tokens and basic credentials enabled by options,
+// both nil if authentication is disabled.
+func NewAuthenticator(ctx context.Context, opts *Options) (auth.TokenAuthenticator, auth.PasswordAuthenticator, error) {
+	authenticators := []auth.TokenAuthenticator{}
+	if opts.Auth.TokenFile != "" {
+		static, err := auth.NewStaticTokenAuthenticator(opts.Auth.TokenFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		authenticators = append(authenticators, static)
+	}
+	if opts.OIDC.Issuer != "" {
+		oidcAuthenticator, err := auth.NewOIDCAuthenticator(ctx, opts.OIDC.Issuer, opts.OIDC.GroupsClaim)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc: %w", err)
+		}
+		authenticators = append(authenticators, oidcAuthenticator)
+	}
+	if webhook := opts.AuthWebhook; webhook.URL != "" {
+		authenticators = append(authenticators,
+			auth.NewWebhookAuthenticator(webhook.URL, webhook.Timeout, webhook.CacheTTL, webhook.NegativeCacheTTL))
+	}
+	var tokens auth.TokenAuthenticator
+	if len(authenticators) > 0 {
+		tokens = auth.Union(authenticators...)
+	}
+	var passwords auth.PasswordAuthenticator
+	if opts.Auth.HtpasswdFile != "" {
+		htpasswd, err := auth.NewHtpasswdAuthenticator(opts.Auth.HtpasswdFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		passwords = htpasswd
+	}
+	return tokens, passwords, nil
+}
+
+// NewAuditor returns the auditor writes to the sinks enabled by options.
+func NewAuditor(ctx context.Context, opts *AuditOptions) (*audit.Auditor, error) {
+	sinks := []audit.Sink{}
+	if opts.File != "" {
+		file, err := audit.NewFileSink(opts.File)
+		if err != nil {
+			return nil, fmt.Errorf("audit: %w", err)
+		}
+		sinks = append(sinks, file)
+	}
+	if opts.Stdout {
+		sinks = append(sinks, audit.NewWriterSink(os.Stdout))
+	}
+	if opts.WebhookURL != "" {
+		sinks = append(sinks, audit.NewWebhookSink(ctx, opts.WebhookURL, opts.WebhookTimeout))
+	}
+	return audit.NewAuditor(sinks...), nil
+}
+
 func NewRegistry(ctx context.Context, opt *Options) (*Registry, error) {
 	log := logr.FromContextOrDiscard(ctx)
 	log.Info("prepare registry", "options", opt)
 	var registryStore RegistryStore
+	// fs of the store, keeps the data besides repositories
+	var fs FSProvider
 	if registryStore == nil && opt.S3 != nil && opt.S3.URL != "" {
 		s3store, err := NewS3RegistryStore(ctx, opt)
 		if err != nil {
 			return nil, err
 		}
-		registryStore = s3store
+		registryStore, fs = s3store, s3store.provider
 	}
 	if registryStore == nil {
 		fsstore, err := NewFSRegistryStore(ctx, opt)
 		if err != nil {
 			return nil, err
 		}
-		registryStore = fsstore
+		registryStore, fs = fsstore, fsstore.FS
 	}
 	if registryStore == nil {
 		return nil, fmt.Errorf("no storage backend set")
 	}
-	return &Registry{Store: registryStore}, nil
+	registryStore = NewTracingRegistryStore(registryStore)
+	uploads, err := NewBlobUploads(opt.UploadDir)
+	if err != nil {
+		return nil, err
+	}
+	var retention *RetentionPolicy
+	if opt.Retention.Config != "" {
+		if retention, err = LoadRetentionPolicy(opt.Retention.Config); err != nil {
+			return nil, err
+		}
+	}
+	var immutability *ImmutabilityPolicy
+	if opt.ImmutabilityConfig != "" {
+		if immutability, err = LoadImmutabilityPolicy(opt.ImmutabilityConfig); err != nil {
+			return nil, err
+		}
+	}
+	auditor, err := NewAuditor(ctx, opt.Audit)
+	if err != nil {
+		return nil, err
+	}
+	var notifier *notification.Notifier
+	if opt.Notification.Config != "" {
+		config, err := notification.LoadConfig(opt.Notification.Config)
+		if err != nil {
+			return nil, err
+		}
+		if notifier, err = notification.NewNotifier(ctx, config, opt.Notification.QueueDir); err != nil {
+			return nil, err
+		}
+	}
+	var events *notification.Broker
+	if opt.EventsBufferSize > 0 {
+		events = notification.NewBroker(opt.EventsBufferSize)
+	}
+	var authorizer *Authorizer
+	if opt.AuthorizationConfig != "" {
+		if authorizer, err = NewAuthorizer(ctx, opt.AuthorizationConfig); err != nil {
+			return nil, err
+		}
+	}
+	return &Registry{
+		Store:         registryStore,
+		Authorizer:    authorizer,
+		Tokens:        NewAPITokens(fs),
+		Projects:      NewProjects(fs),
+		Audit:         auditor,
+		Notifier:      notifier,
+		Events:        events,
+		Uploads:       uploads,
+		Retention:     retention,
+		Immutability:  immutability,
+		Admins:        opt.AdminUsers,
+		GCGracePeriod: opt.GC.GracePeriod,
+	}, nil
 }
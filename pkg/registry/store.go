@@ -6,8 +6,10 @@ import (
 	"io"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/errors"
 	"kubegems.io/modelx/pkg/types"
 )
 
@@ -29,6 +31,13 @@ type BlobContent struct {
 type BlobMeta struct {
 	ContentType   string
 	ContentLength int64
+	LastModified  time.Time
+}
+
+// BlobLink is a blob mounted into a repository from the repository holds it.
+type BlobLink struct {
+	Holder       string
+	LastModified time.Time
 }
 
 type RegistryStore interface {
@@ -36,16 +45,22 @@ type RegistryStore interface {
 
 	GetIndex(ctx context.Context, repository string, search string) (types.Index, error)
 	RemoveIndex(ctx context.Context, repository string) error
+	// ListRepositories returns the repositories have any manifests, blobs or links in storage,
+	// it includes repositories missing from the global index.
+	ListRepositories(ctx context.Context) ([]string, error)
 
 	ExistsManifest(ctx context.Context, repository string, reference string) (bool, error)
 	GetManifest(ctx context.Context, repository string, reference string) (*types.Manifest, error)
 	PutManifest(ctx context.Context, repository string, reference string, contentType string, manifest types.Manifest) error
 	DeleteManifest(ctx context.Context, repository string, reference string) error
+	ListManifestDigests(ctx context.Context, repository string) ([]digest.Digest, error)
 
 	ListBlobs(ctx context.Context, repository string) ([]digest.Digest, error)
 	GetBlob(ctx context.Context, repository string, digest digest.Digest) (*BlobContent, error)
 	DeleteBlob(ctx context.Context, repository string, digest digest.Digest) error
 	PutBlob(ctx context.Context, repository string, digest digest.Digest, content BlobContent) error
+	MountBlob(ctx context.Context, repository string, from string, digest digest.Digest) error
+	ListBlobLinks(ctx context.Context, repository string) (map[digest.Digest]BlobLink, error)
 	ExistsBlob(ctx context.Context, repository string, digest digest.Digest) (bool, error)
 	GetBlobMeta(ctx context.Context, repository string, digest digest.Digest) (BlobMeta, error)
 
@@ -60,14 +75,40 @@ func BlobDigestPath(repository string, d digest.Digest) string {
 	return path.Join(repository, "blobs", d.Algorithm().String(), d.Hex())
 }
 
+// BlobLinkPath returns the path of the link to a blob mounted from another repository,
+// the link records the repository actually holds the blob.
+func BlobLinkPath(repository string, d digest.Digest) string {
+	if d == "" {
+		d = ":"
+	}
+	return path.Join(repository, "links", d.Algorithm().String(), d.Hex())
+}
+
 func IndexPath(repository string) string {
 	return path.Join(repository, RegistryIndexFileName)
 }
 
+// ManifestPath returns the path of the manifest, a digest reference is stored apart from tags,
+// so digest manifests are immutable and not listed as versions.
 func ManifestPath(repository string, reference string) string {
+	if d, ok := ParseDigestReference(reference); ok {
+		return path.Join(repository, "digests", d.Algorithm().String(), d.Encoded())
+	}
 	return path.Join(repository, "manifests", reference)
 }
 
+// ParseDigestReference returns the digest if reference is a valid digest like sha256:abc...
+func ParseDigestReference(reference string) (digest.Digest, bool) {
+	if !strings.Contains(reference, ":") {
+		return "", false
+	}
+	d, err := digest.Parse(reference)
+	if err != nil {
+		return "", false
+	}
+	return d, true
+}
+
 func SplitManifestPath(in string) (string, string) {
 	in = strings.TrimPrefix(in, "manifests")
 	return path.Split(in)
@@ -76,3 +117,9 @@ func SplitManifestPath(in string) (string, string) {
 func IsRegistryStoreNotNotFound(err error) bool {
 	return stderrors.Is(err, ErrRegistryStoreNotFound)
 }
+
+// IsNotFoundOrUnknown reports whether err means the object, manifest or blob not exists.
+func IsNotFoundOrUnknown(err error) bool {
+	return IsRegistryStoreNotNotFound(err) ||
+		errors.IsErrCode(err, errors.ErrCodeManifestUnknown) || errors.IsErrCode(err, errors.ErrCodeBlobUnknown)
+}
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/opencontainers/go-digest"
 	"golang.org/x/exp/slices"
 	"golang.org/x/sync/errgroup"
@@ -20,14 +23,43 @@ import (
 
 const RegistryIndexFileName = "index.json"
 
+// IndexUpdateRetries is the times to rebuild an index file when it is changed by another writer concurrently.
+const IndexUpdateRetries = 10
+
 type FSRegistryStore struct {
 	FS             FSProvider
 	EnableRedirect bool
+	// Metadata serves the indexes instead of the index files if not nil.
+	Metadata *MetadataDB
+	// indexLocks serializes the updates of an index file in this process,
+	// updates from other processes are detected by conditional writes.
+	indexLocks KeyedMutex
 }
 
 var _ RegistryStore = &FSRegistryStore{}
 
 func NewFSRegistryStore(ctx context.Context, options *Options) (*FSRegistryStore, error) {
+	fs, err := NewFSProvider(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := NewMetadataDB(options)
+	if err != nil {
+		return nil, err
+	}
+	store := &FSRegistryStore{
+		FS:             fs,
+		EnableRedirect: options.EnableRedirect,
+		Metadata:       metadata,
+	}
+	if err := store.InitIndex(ctx); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewFSProvider returns the FSProvider of s3 or local storage configured by options.
+func NewFSProvider(ctx context.Context, options *Options) (FSProvider, error) {
 	var fs FSProvider
 	if fs == nil && options.S3.URL != "" {
 		s3fs, err := NewS3FSProvider(ctx, options.S3)
@@ -49,14 +81,26 @@ func NewFSRegistryStore(ctx context.Context, options *Options) (*FSRegistryStore
 	if fs == nil {
 		return nil, errors.NewInternalError(fmt.Errorf("no storage provider is configured"))
 	}
-	store := &FSRegistryStore{
-		FS:             fs,
-		EnableRedirect: options.EnableRedirect,
+	return NewTracingFSProvider(NewMetricsFSProvider(fs)), nil
+}
+
+// NewMetadataDB opens the metadata database configured by options, nil if not configured.
+func NewMetadataDB(options *Options) (*MetadataDB, error) {
+	if options.MetadataDB == "" {
+		return nil, nil
 	}
-	if err := store.RefreshGlobalIndex(ctx); err != nil {
-		return nil, err
+	return OpenMetadataDB(options.MetadataDB)
+}
+
+// InitIndex builds the indexes on start, the metadata database is built only once, Reindex rebuilds it.
+func (m *FSRegistryStore) InitIndex(ctx context.Context) error {
+	if m.Metadata == nil {
+		return m.RefreshGlobalIndex(ctx)
 	}
-	return store, nil
+	if m.Metadata.Indexed() {
+		return nil
+	}
+	return m.Reindex(ctx)
 }
 
 func (m *FSRegistryStore) ExistsManifest(ctx context.Context, repository string, reference string) (bool, error) {
@@ -70,7 +114,11 @@ func (m *FSRegistryStore) ExistsManifest(ctx context.Context, repository string,
 func (m *FSRegistryStore) GetManifest(ctx context.Context, repository string, reference string) (*types.Manifest, error) {
 	body, err := m.FS.Get(ctx, ManifestPath(repository, reference))
 	if err != nil {
-		if IsS3StorageNotFound(err) {
+		if IsStorageNotFound(err) {
+			// manifests pushed before stored by digest are only found by tags
+			if dgst, ok := ParseDigestReference(reference); ok {
+				return m.getManifestByTagsDigest(ctx, repository, dgst)
+			}
 			return nil, errors.NewManifestUnknownError(reference)
 		}
 		return nil, errors.NewInternalError(err)
@@ -85,17 +133,46 @@ func (m *FSRegistryStore) GetManifest(ctx context.Context, repository string, re
 }
 
 func (m *FSRegistryStore) PutManifest(ctx context.Context, repository string, reference string, contentType string, manifest types.Manifest) error {
+	if err := m.checkManifestBlobs(ctx, repository, manifest); err != nil {
+		return err
+	}
 	content, err := json.Marshal(manifest)
 	if err != nil {
 		return errors.NewManifestInvalidError(err)
 	}
-	storageContent := BlobContent{
-		Content:       io.NopCloser(bytes.NewReader(content)),
-		ContentLength: int64(len(content)),
-		ContentType:   contentType,
+	// the manifest is always stored by its digests, and also by the tag if reference is a tag
+	contentDigest := digest.FromBytes(content)
+	digests := manifestDigests(manifest, contentDigest)
+	paths := []string{}
+	for _, dgst := range digests {
+		paths = append(paths, ManifestPath(repository, dgst.String()))
 	}
-	if err := m.FS.Put(ctx, ManifestPath(repository, reference), storageContent); err != nil {
-		return errors.NewInternalError(err)
+	if dgst, ok := ParseDigestReference(reference); ok {
+		if !slices.Contains(digests, dgst) {
+			return errors.NewDigestInvalidError(reference)
+		}
+	} else {
+		paths = append(paths, ManifestPath(repository, reference))
+	}
+	for _, path := range paths {
+		storageContent := BlobContent{
+			Content:       io.NopCloser(bytes.NewReader(content)),
+			ContentLength: int64(len(content)),
+			ContentType:   contentType,
+		}
+		if err := m.FS.Put(ctx, path, storageContent); err != nil {
+			return errors.NewInternalError(err)
+		}
+	}
+	if m.Metadata != nil {
+		// manifests put by digest are not versions
+		if _, ok := ParseDigestReference(reference); ok {
+			return nil
+		}
+		if err := m.Metadata.PutVersion(repository, versionDescriptor(reference, manifest, contentDigest, time.Now())); err != nil {
+			return errors.NewInternalError(err)
+		}
+		return nil
 	}
 	if err := m.RefreshIndex(ctx, repository); err != nil {
 		return errors.NewInternalError(err)
@@ -103,18 +180,239 @@ func (m *FSRegistryStore) PutManifest(ctx context.Context, repository string, re
 	return nil
 }
 
+// manifestDigests returns the digests the manifest is stored by, its content digest is the first,
+// followed by the digests of oci manifests it is addressed by, see OCIManifestDigests.
+func manifestDigests(manifest types.Manifest, contentDigest digest.Digest) []digest.Digest {
+	digests := []digest.Digest{contentDigest}
+	for _, dgst := range OCIManifestDigests(manifest) {
+		if !slices.Contains(digests, dgst) {
+			digests = append(digests, dgst)
+		}
+	}
+	return digests
+}
+
+// ListManifestDigests returns the digests of manifests stored by digest, including the ones not tagged.
+func (m *FSRegistryStore) ListManifestDigests(ctx context.Context, repository string) ([]digest.Digest, error) {
+	metas, err := m.FS.List(ctx, path.Dir(ManifestPath(repository, digest.Canonical.FromString("").String())), false)
+	if err != nil {
+		if IsStorageNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	digests := make([]digest.Digest, 0, len(metas))
+	for _, meta := range metas {
+		if dgst, ok := digestOfPath(path.Join(digest.Canonical.String(), path.Base(meta.Name))); ok {
+			digests = append(digests, dgst)
+		}
+	}
+	return digests, nil
+}
+
+// getManifestByTagsDigest finds the manifest of digest in tags.
+func (m *FSRegistryStore) getManifestByTagsDigest(ctx context.Context, repository string, dgst digest.Digest) (*types.Manifest, error) {
+	tags, err := m.tagsOfManifestDigest(ctx, repository, dgst)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, errors.NewManifestUnknownError(dgst.String())
+	}
+	return m.GetManifest(ctx, repository, tags[0])
+}
+
+// tagsOfManifestDigest returns the tags point to the manifest of digest.
+func (m *FSRegistryStore) tagsOfManifestDigest(ctx context.Context, repository string, dgst digest.Digest) ([]string, error) {
+	index, err := m.GetIndex(ctx, repository, "")
+	if err != nil {
+		if err == ErrRegistryStoreNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tags := []string{}
+	for _, desc := range index.Manifests {
+		if desc.Digest != "" {
+			if desc.Digest == dgst {
+				tags = append(tags, desc.Name)
+			}
+			continue
+		}
+		// index refreshed before manifest digests recorded
+		manifest, err := m.GetManifest(ctx, repository, desc.Name)
+		if err != nil {
+			continue
+		}
+		if contentDigest, err := manifest.Digest(); err == nil && contentDigest == dgst {
+			tags = append(tags, desc.Name)
+		}
+	}
+	return tags, nil
+}
+
+// checkManifestBlobs checks the media types of the manifest and that all blobs it references exist with the declared size.
+func (m *FSRegistryStore) checkManifestBlobs(ctx context.Context, repository string, manifest types.Manifest) error {
+	if manifest.MediaType != "" && manifest.MediaType != MediaTypeModelManifestJson {
+		return errors.NewManifestInvalidError(fmt.Errorf("unsupported manifest media type %s", manifest.MediaType))
+	}
+	blobs := []types.Descriptor{}
+	if manifest.Config.Digest != "" {
+		if manifest.Config.MediaType != MediaTypeModelConfigYaml {
+			return errors.NewManifestInvalidError(fmt.Errorf("unsupported config media type %s", manifest.Config.MediaType))
+		}
+		blobs = append(blobs, manifest.Config)
+	}
+	for _, blob := range manifest.Blobs {
+		switch blob.MediaType {
+		case MediaTypeModelFile, MediaTypeModelDirectoryTarGz:
+		default:
+			return errors.NewManifestInvalidError(fmt.Errorf("unsupported media type %s of blob %s", blob.MediaType, blob.Name))
+		}
+		blobs = append(blobs, blob)
+	}
+	// the config of the oci image manifest converted from is a blob too
+	if config, _ := OCIManifestReferences(manifest); config != nil {
+		blobs = append(blobs, types.Descriptor{Name: "oci config", MediaType: config.MediaType, Digest: config.Digest, Size: config.Size})
+	}
+	for _, blob := range blobs {
+		if err := blob.Digest.Validate(); err != nil {
+			return errors.NewDigestInvalidError(blob.Digest.String())
+		}
+	}
+
+	mu := sync.Mutex{}
+	missing := []digest.Digest{}
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(10)
+	for _, blob := range blobs {
+		blob := blob
+		// empty files are never uploaded
+		if blob.Digest == EmptyBlobDigest && blob.Size == 0 {
+			continue
+		}
+		eg.Go(func() error {
+			meta, err := m.GetBlobMeta(ctx, repository, blob.Digest)
+			if err != nil {
+				if !errors.IsErrCode(err, errors.ErrCodeBlobUnknown) {
+					return err
+				}
+				mu.Lock()
+				missing = append(missing, blob.Digest)
+				mu.Unlock()
+				return nil
+			}
+			if meta.ContentLength != blob.Size {
+				return errors.NewManifestInvalidError(fmt.Errorf("size of blob %s mismatch: %d != %d", blob.Name, meta.ContentLength, blob.Size))
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return errors.NewManifestBlobUnknownError(slices.Compact(missing))
+	}
+	return nil
+}
+
+// DeleteManifest removes the tag, or the manifest and all tags point to it if reference is a digest.
 func (m *FSRegistryStore) DeleteManifest(ctx context.Context, repository string, reference string) error {
-	if err := m.FS.Remove(ctx, ManifestPath(repository, reference), false); err != nil {
-		return errors.NewInternalError(err)
+	dgst, ok := ParseDigestReference(reference)
+	if !ok {
+		manifest, err := m.GetManifest(ctx, repository, reference)
+		if err != nil {
+			return err
+		}
+		if err := m.FS.Remove(ctx, ManifestPath(repository, reference), false); err != nil {
+			return errors.NewInternalError(err)
+		}
+		if err := m.removeVersions(ctx, repository, reference); err != nil {
+			return errors.NewInternalError(err)
+		}
+		// remove the manifest stored by digest if no tags point to it, so its blobs can be collected
+		contentDigest, err := manifest.Digest()
+		if err != nil {
+			return errors.NewInternalError(err)
+		}
+		tags, err := m.tagsOfManifestDigest(ctx, repository, contentDigest)
+		if err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return m.removeManifestDigests(ctx, repository, manifestDigests(*manifest, contentDigest))
+		}
+		return nil
+	}
+	// the digest may be one the manifest is also addressed by, its tags point to its content digest
+	digests := []digest.Digest{dgst}
+	if manifest, err := m.GetManifest(ctx, repository, reference); err == nil {
+		contentDigest, err := manifest.Digest()
+		if err != nil {
+			return errors.NewInternalError(err)
+		}
+		digests = manifestDigests(*manifest, contentDigest)
+		if !slices.Contains(digests, dgst) {
+			digests = append(digests, dgst)
+		}
+	} else if !IsNotFoundOrUnknown(err) {
+		return err
+	}
+	tags, err := m.tagsOfManifestDigest(ctx, repository, digests[0])
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := m.FS.Remove(ctx, ManifestPath(repository, tag), false); err != nil && !IsStorageNotFound(err) {
+			return errors.NewInternalError(err)
+		}
+	}
+	if err := m.removeManifestDigests(ctx, repository, digests); err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		if err := m.removeVersions(ctx, repository, tags...); err != nil {
+			return errors.NewInternalError(err)
+		}
 	}
 	return nil
 }
 
+// removeManifestDigests removes the manifest stored by digests.
+func (m *FSRegistryStore) removeManifestDigests(ctx context.Context, repository string, digests []digest.Digest) error {
+	for _, dgst := range digests {
+		if err := m.FS.Remove(ctx, ManifestPath(repository, dgst.String()), false); err != nil && !IsStorageNotFound(err) {
+			return errors.NewInternalError(err)
+		}
+	}
+	return nil
+}
+
+// removeVersions updates the index of repository after the versions removed.
+func (m *FSRegistryStore) removeVersions(ctx context.Context, repository string, versions ...string) error {
+	if m.Metadata != nil {
+		return m.Metadata.RemoveVersions(repository, versions...)
+	}
+	return m.RefreshIndex(ctx, repository)
+}
+
 // Gettypes.Index returns the types.Index for the given repository. if no manifests return an empty types.Index.
 func (m *FSRegistryStore) GetIndex(ctx context.Context, repository string, search string) (types.Index, error) {
+	if m.Metadata != nil {
+		index, err := m.Metadata.GetIndex(repository)
+		if err != nil {
+			if IsRegistryStoreNotNotFound(err) {
+				return types.Index{}, err
+			}
+			return types.Index{}, errors.NewInternalError(err)
+		}
+		return filterIndex(index, search)
+	}
 	body, err := m.FS.Get(ctx, IndexPath(repository))
 	if err != nil {
-		if IsS3StorageNotFound(err) {
+		if IsStorageNotFound(err) {
 			return types.Index{}, ErrRegistryStoreNotFound
 		}
 		return types.Index{}, err
@@ -125,37 +423,34 @@ func (m *FSRegistryStore) GetIndex(ctx context.Context, repository string, searc
 	if err := json.NewDecoder(body).Decode(&index); err != nil {
 		return types.Index{}, err
 	}
-	if search != "" {
-		searchregexp, err := regexp.Compile(search)
-		if err != nil {
-			return types.Index{}, errors.NewParameterInvalidError(fmt.Sprintf("search %s: %v", search, err))
-		}
-		indexies := []types.Descriptor{}
-		for _, manifest := range index.Manifests {
-			if searchregexp.MatchString(manifest.Name) {
-				indexies = append(indexies, manifest)
-			}
-		}
-		index.Manifests = indexies
-	}
-
-	return index, nil
+	return filterIndex(index, search)
 }
 
-func (m *FSRegistryStore) PutIndex(ctx context.Context, repository string, index types.Index) error {
-	slices.SortFunc(index.Manifests, func(a, b types.Descriptor) int {
-		return strings.Compare(a.Name, b.Name)
-	})
-
-	// use latest manifest annotations as index annotations
+// filterIndex keeps the manifests of index whose names match regexp search, all manifests are kept if search is empty.
+func filterIndex(index types.Index, search string) (types.Index, error) {
+	if search == "" {
+		return index, nil
+	}
+	searchregexp, err := regexp.Compile(search)
+	if err != nil {
+		return types.Index{}, errors.NewParameterInvalidError(fmt.Sprintf("search %s: %v", search, err))
+	}
+	indexies := []types.Descriptor{}
 	for _, manifest := range index.Manifests {
-		if manifest.Annotations == nil {
-			continue
+		if searchregexp.MatchString(manifest.Name) {
+			indexies = append(indexies, manifest)
 		}
-		index.Annotations = manifest.Annotations
-		break
 	}
+	index.Manifests = indexies
+	return index, nil
+}
 
+// PutIndex writes the index file of repository if its ETag is still etag, see FSProvider.PutIfMatch.
+func (m *FSRegistryStore) PutIndex(ctx context.Context, repository string, index types.Index, etag string) error {
+	return m.putIndexFile(ctx, IndexPath(repository), newIndex(index.Manifests), etag)
+}
+
+func (m *FSRegistryStore) putIndexFile(ctx context.Context, indexpath string, index types.Index, etag string) error {
 	content, err := json.Marshal(index)
 	if err != nil {
 		return errors.NewInternalError(err)
@@ -165,28 +460,154 @@ func (m *FSRegistryStore) PutIndex(ctx context.Context, repository string, index
 		ContentLength: int64(len(content)),
 		ContentType:   MediaTypeModelIndexJson,
 	}
-	if err := m.FS.Put(ctx, IndexPath(repository), storageContent); err != nil {
+	if err := m.FS.PutIfMatch(ctx, indexpath, storageContent, etag); err != nil {
+		if IsPreconditionFailed(err) {
+			return err
+		}
 		return errors.NewInternalError(err)
 	}
 	return nil
 }
 
+// indexETag returns the ETag of the index file, empty if it not exists.
+func (m *FSRegistryStore) indexETag(ctx context.Context, indexpath string) (string, error) {
+	meta, err := m.FS.Stat(ctx, indexpath)
+	if err != nil {
+		if IsStorageNotFound(err) {
+			return "", nil
+		}
+		return "", errors.NewInternalError(err)
+	}
+	return meta.ETag, nil
+}
+
+// updateIndexFile writes the index built by build to indexpath, the index is built again
+// if the file is changed by another writer during the build, so no concurrent update is lost.
+// The file is removed if removeEmpty and the index has no manifests.
+func (m *FSRegistryStore) updateIndexFile(ctx context.Context, indexpath string, removeEmpty bool, build func() (types.Index, error)) error {
+	unlock := m.indexLocks.Lock(indexpath)
+	defer unlock()
+
+	for attempt := 0; ; attempt++ {
+		if attempt == IndexUpdateRetries {
+			return errors.NewInternalError(fmt.Errorf("update %s: %w after %d retries", indexpath, ErrPreconditionFailed, attempt))
+		}
+		// the ETag must be read before the build, a change after it is detected by the write
+		etag, err := m.indexETag(ctx, indexpath)
+		if err != nil {
+			return err
+		}
+		index, err := build()
+		if err != nil {
+			return err
+		}
+		if removeEmpty && len(index.Manifests) == 0 {
+			if etag != "" {
+				if err := m.FS.Remove(ctx, indexpath, false); err != nil && !IsStorageNotFound(err) {
+					return errors.NewInternalError(err)
+				}
+			}
+			// storages have no conditional remove, build again to check no manifest added concurrently
+			index, err := build()
+			if err != nil {
+				return err
+			}
+			if len(index.Manifests) == 0 {
+				return nil
+			}
+			continue
+		}
+		if err := m.putIndexFile(ctx, indexpath, index, etag); err != nil {
+			if IsPreconditionFailed(err) {
+				logr.FromContextOrDiscard(ctx).V(1).Info("index changed concurrently, rebuilding", "path", indexpath, "attempt", attempt)
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
 func (m *FSRegistryStore) RemoveIndex(ctx context.Context, repository string) error {
+	// keep the blobs mounted by other repositories
+	if err := m.detachMountedBlobs(ctx, repository); err != nil {
+		return err
+	}
 	// remove all manifests and blobs
 	if err := m.FS.Remove(ctx, repository, true); err != nil {
 		return errors.NewInternalError(err)
 	}
+	if m.Metadata != nil {
+		if err := m.Metadata.RemoveRepository(repository); err != nil {
+			return errors.NewInternalError(err)
+		}
+		return nil
+	}
 	if err := m.RefreshIndex(ctx, repository); err != nil {
 		return errors.NewInternalError(err)
 	}
 	return nil
 }
 
-func (m *FSRegistryStore) RefreshIndex(ctx context.Context, repository string) error {
-	filemetas, err := m.FS.List(ctx, ManifestPath(repository, ""), false)
+// ListRepositories lists the repositories by the objects under {repository}/{manifests,digests,blobs,links}.
+func (m *FSRegistryStore) ListRepositories(ctx context.Context) ([]string, error) {
+	metas, err := m.FS.List(ctx, "", true)
 	if err != nil {
+		if IsStorageNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	repositories := []string{}
+	for _, meta := range metas {
+		// {project}/{name}/{kind}/...
+		parts := strings.SplitN(filepath.ToSlash(meta.Name), "/", 4)
+		if len(parts) < 4 {
+			continue
+		}
+		switch parts[2] {
+		case "manifests", "digests", "blobs", "links":
+			repositories = append(repositories, parts[0]+"/"+parts[1])
+		}
+	}
+	slices.Sort(repositories)
+	return slices.Compact(repositories), nil
+}
+
+func (m *FSRegistryStore) RefreshIndex(ctx context.Context, repository string) error {
+	if err := m.refreshRepositoryIndex(ctx, repository); err != nil {
+		return err
+	}
+	// refresh global index
+	if err := m.RefreshGlobalIndex(ctx); err != nil {
 		return errors.NewInternalError(err)
 	}
+	return nil
+}
+
+// refreshRepositoryIndex rebuilds the index file of repository from its manifests, removes it if no manifests left.
+func (m *FSRegistryStore) refreshRepositoryIndex(ctx context.Context, repository string) error {
+	from := time.Now()
+	err := m.updateIndexFile(ctx, IndexPath(repository), true, func() (types.Index, error) {
+		versions, err := m.scanVersions(ctx, repository)
+		if err != nil {
+			return types.Index{}, err
+		}
+		return newIndex(versions), nil
+	})
+	if err != nil {
+		return err
+	}
+	indexRefreshDuration.WithLabelValues("repository").Observe(time.Since(from).Seconds())
+	return nil
+}
+
+// scanVersions reads all versions of repository from storage.
+func (m *FSRegistryStore) scanVersions(ctx context.Context, repository string) ([]types.Descriptor, error) {
+	filemetas, err := m.FS.List(ctx, ManifestPath(repository, ""), false)
+	if err != nil && !IsStorageNotFound(err) {
+		return nil, errors.NewInternalError(err)
+	}
 
 	eg := errgroup.Group{}
 	manifests := sync.Map{}
@@ -197,50 +618,165 @@ func (m *FSRegistryStore) RefreshIndex(ctx context.Context, repository string) e
 			if err != nil {
 				return err
 			}
-			desc := types.Descriptor{
-				Name:        meta.Name,
-				Modified:    meta.LastModified,
-				Annotations: manifest.Annotations,
-				Size: func() int64 {
-					size := manifest.Config.Size
-					for _, blob := range manifest.Blobs {
-						size += blob.Size
-					}
-					return size
-				}(),
+			contentDigest, err := manifest.Digest()
+			if err != nil {
+				return err
 			}
-			manifests.Store(meta.Name, desc)
+			manifests.Store(meta.Name, versionDescriptor(meta.Name, *manifest, contentDigest, meta.LastModified))
 			return nil
 		})
 	}
 	if err := eg.Wait(); err != nil {
-		return errors.NewInternalError(err)
+		return nil, errors.NewInternalError(err)
 	}
 
-	index := types.Index{}
-
+	versions := []types.Descriptor{}
 	manifests.Range(func(key, value any) bool {
-		index.Manifests = append(index.Manifests, value.(types.Descriptor))
+		versions = append(versions, value.(types.Descriptor))
 		return true
 	})
+	return versions, nil
+}
 
-	// save the index
-	if len(index.Manifests) != 0 {
-		if err := m.PutIndex(ctx, repository, index); err != nil {
+// putMissingManifestDigests stores the versions of repository by the digests they are not stored by yet,
+// versions put by an older modelxd are only stored by tags.
+func (m *FSRegistryStore) putMissingManifestDigests(ctx context.Context, repository string) error {
+	filemetas, err := m.FS.List(ctx, ManifestPath(repository, ""), false)
+	if err != nil {
+		if IsStorageNotFound(err) {
+			return nil
+		}
+		return errors.NewInternalError(err)
+	}
+	for _, meta := range filemetas {
+		manifest, err := m.GetManifest(ctx, repository, meta.Name)
+		if err != nil {
+			return err
+		}
+		content, err := json.Marshal(manifest)
+		if err != nil {
 			return errors.NewInternalError(err)
 		}
+		for _, dgst := range manifestDigests(*manifest, digest.FromBytes(content)) {
+			digestpath := ManifestPath(repository, dgst.String())
+			if exists, err := m.FS.Exists(ctx, digestpath); err != nil {
+				return errors.NewInternalError(err)
+			} else if exists {
+				continue
+			}
+			storageContent := BlobContent{
+				Content:       io.NopCloser(bytes.NewReader(content)),
+				ContentLength: int64(len(content)),
+				ContentType:   MediaTypeModelManifestJson,
+			}
+			if err := m.FS.Put(ctx, digestpath, storageContent); err != nil {
+				return errors.NewInternalError(err)
+			}
+		}
 	}
-	// refresh global index
-	if err := m.RefreshGlobalIndex(ctx); err != nil {
+	return nil
+}
+
+// versionDescriptor returns the descriptor of version name in index, the size is the total size of the blobs.
+func versionDescriptor(name string, manifest types.Manifest, contentDigest digest.Digest, modified time.Time) types.Descriptor {
+	size := manifest.Config.Size
+	for _, blob := range manifest.Blobs {
+		size += blob.Size
+	}
+	return types.Descriptor{
+		Name:        name,
+		Digest:      contentDigest,
+		Modified:    modified,
+		Annotations: manifest.Annotations,
+		Size:        size,
+	}
+}
+
+// Reindex rebuilds the metadata database, or the index files if the database is not used, from the manifests in storage.
+func (m *FSRegistryStore) Reindex(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+	from := time.Now()
+	filemetas, err := m.FS.List(ctx, "", true)
+	if err != nil && !IsStorageNotFound(err) {
 		return errors.NewInternalError(err)
 	}
+	// manifests are at {repository}/manifests/{version}, index files of repositories without manifests are removed
+	repositories := map[string]struct{}{}
+	for _, meta := range filemetas {
+		dir := path.Dir(meta.Name)
+		if path.Base(dir) != "manifests" && path.Base(meta.Name) != RegistryIndexFileName {
+			continue
+		}
+		if path.Base(dir) == "manifests" {
+			dir = path.Dir(dir)
+		}
+		if strings.Count(dir, "/") == 1 {
+			repositories[dir] = struct{}{}
+		}
+	}
+	eg := errgroup.Group{}
+	eg.SetLimit(10)
+	if m.Metadata == nil {
+		for repository := range repositories {
+			repository := repository
+			eg.Go(func() error {
+				if err := m.putMissingManifestDigests(ctx, repository); err != nil {
+					return fmt.Errorf("reindex %s: %w", repository, err)
+				}
+				if err := m.refreshRepositoryIndex(ctx, repository); err != nil {
+					return fmt.Errorf("reindex %s: %w", repository, err)
+				}
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+		if err := m.RefreshGlobalIndex(ctx); err != nil {
+			return err
+		}
+		log.Info("index files reindexed", "repositories", len(repositories), "cost", time.Since(from).String())
+		return nil
+	}
+	indexes := make(map[string][]types.Descriptor, len(repositories))
+	mu := sync.Mutex{}
+	for repository := range repositories {
+		repository := repository
+		eg.Go(func() error {
+			if err := m.putMissingManifestDigests(ctx, repository); err != nil {
+				return fmt.Errorf("reindex %s: %w", repository, err)
+			}
+			versions, err := m.scanVersions(ctx, repository)
+			if err != nil {
+				return fmt.Errorf("scan %s: %w", repository, err)
+			}
+			mu.Lock()
+			indexes[repository] = versions
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	if err := m.Metadata.Replace(indexes); err != nil {
+		return errors.NewInternalError(err)
+	}
+	log.Info("metadata database reindexed", "repositories", len(indexes), "cost", time.Since(from).String())
 	return nil
 }
 
 func (m *FSRegistryStore) GetGlobalIndex(ctx context.Context, search string) (types.Index, error) {
+	if m.Metadata != nil {
+		index, err := m.Metadata.GetGlobalIndex()
+		if err != nil {
+			return types.Index{}, errors.NewInternalError(err)
+		}
+		return filterIndex(index, search)
+	}
 	body, err := m.FS.Get(ctx, IndexPath(""))
 	if err != nil {
-		if IsS3StorageNotFound(err) {
+		if IsStorageNotFound(err) {
 			return types.Index{}, ErrRegistryStoreNotFound
 		}
 		return types.Index{}, err
@@ -251,43 +787,35 @@ func (m *FSRegistryStore) GetGlobalIndex(ctx context.Context, search string) (ty
 	if err := json.NewDecoder(body).Decode(&globalindex); err != nil {
 		return types.Index{}, err
 	}
-	if search != "" {
-		searchregexp, err := regexp.Compile(search)
-		if err != nil {
-			return types.Index{}, errors.NewParameterInvalidError(fmt.Sprintf("search %s: %v", search, err))
-		}
-		indexies := []types.Descriptor{}
-		for _, index := range globalindex.Manifests {
-			if searchregexp.MatchString(index.Name) {
-				indexies = append(indexies, index)
-			}
-		}
-		globalindex.Manifests = indexies
-	}
-	return globalindex, nil
+	return filterIndex(globalindex, search)
 }
 
-func (m *FSRegistryStore) PutGlobalIndex(ctx context.Context, index types.Index) error {
+// PutGlobalIndex writes the global index file if its ETag is still etag, see FSProvider.PutIfMatch.
+func (m *FSRegistryStore) PutGlobalIndex(ctx context.Context, index types.Index, etag string) error {
 	slices.SortFunc(index.Manifests, types.SortDescriptorName)
-	content, err := json.Marshal(index)
-	if err != nil {
-		return errors.NewInternalError(err)
-	}
-	storageContent := BlobContent{
-		Content:       io.NopCloser(bytes.NewReader(content)),
-		ContentLength: int64(len(content)),
-		ContentType:   MediaTypeModelIndexJson,
-	}
-	if err := m.FS.Put(ctx, IndexPath(""), storageContent); err != nil {
-		return errors.NewInternalError(err)
-	}
-	return nil
+	return m.putIndexFile(ctx, IndexPath(""), index, etag)
 }
 
 func (m *FSRegistryStore) RefreshGlobalIndex(ctx context.Context) error {
+	from := time.Now()
+	defer func() {
+		indexRefreshDuration.WithLabelValues("global").Observe(time.Since(from).Seconds())
+	}()
+	return m.updateIndexFile(ctx, IndexPath(""), false, func() (types.Index, error) {
+		index, err := m.scanGlobalIndex(ctx)
+		if err != nil {
+			return types.Index{}, err
+		}
+		slices.SortFunc(index.Manifests, types.SortDescriptorName)
+		return index, nil
+	})
+}
+
+// scanGlobalIndex reads the repositories from their index files.
+func (m *FSRegistryStore) scanGlobalIndex(ctx context.Context) (types.Index, error) {
 	filemetas, err := m.FS.List(ctx, "", true)
 	if err != nil {
-		return errors.NewInternalError(err)
+		return types.Index{}, errors.NewInternalError(err)
 	}
 
 	eg := errgroup.Group{}
@@ -302,21 +830,19 @@ func (m *FSRegistryStore) RefreshGlobalIndex(ctx context.Context) error {
 		eg.Go(func() error {
 			index, err := m.GetIndex(ctx, repository, "")
 			if err != nil {
+				// removed since listed
+				if IsRegistryStoreNotNotFound(err) {
+					return nil
+				}
 				return err
 			}
-
-			desc := types.Descriptor{
-				Name:        repository,
-				MediaType:   MediaTypeModelIndexJson,
-				Annotations: index.Annotations,
-			}
-			indexmap.Store(repository, desc)
+			indexmap.Store(repository, repositoryDescriptor(repository, index))
 			return nil
 		})
 	}
 
 	if err := eg.Wait(); err != nil {
-		return errors.NewInternalError(err)
+		return types.Index{}, errors.NewInternalError(err)
 	}
 
 	index := types.Index{}
@@ -325,65 +851,261 @@ func (m *FSRegistryStore) RefreshGlobalIndex(ctx context.Context) error {
 		index.Manifests = append(index.Manifests, value.(types.Descriptor))
 		return true
 	})
-	// save the index
-	return m.PutGlobalIndex(ctx, index)
+	return index, nil
 }
 
 func (m *FSRegistryStore) ExistsBlob(ctx context.Context, repository string, digest digest.Digest) (bool, error) {
-	if exists, err := m.FS.Exists(ctx, BlobDigestPath(repository, digest)); err != nil {
+	path, err := m.BlobPath(ctx, repository, digest)
+	if err != nil {
+		return false, err
+	}
+	if exists, err := m.FS.Exists(ctx, path); err != nil {
 		return false, errors.NewInternalError(err)
 	} else {
 		return exists, nil
 	}
 }
 
+// BlobPath returns the path the blob stored at, it's in the repository holds the blob if the blob is mounted.
+func (m *FSRegistryStore) BlobPath(ctx context.Context, repository string, digest digest.Digest) (string, error) {
+	holder, err := m.blobHolder(ctx, repository, digest)
+	if err != nil {
+		return "", err
+	}
+	return BlobDigestPath(holder, digest), nil
+}
+
+// blobHolder returns the repository actually holds the blob,
+// it's repository itself unless the blob is only linked from another repository.
+func (m *FSRegistryStore) blobHolder(ctx context.Context, repository string, digest digest.Digest) (string, error) {
+	exists, err := m.FS.Exists(ctx, BlobDigestPath(repository, digest))
+	if err != nil {
+		return "", errors.NewInternalError(err)
+	}
+	if exists {
+		return repository, nil
+	}
+	link, err := m.FS.Get(ctx, BlobLinkPath(repository, digest))
+	if err != nil {
+		if IsStorageNotFound(err) {
+			return repository, nil
+		}
+		return "", errors.NewInternalError(err)
+	}
+	defer link.Close()
+	holder, err := io.ReadAll(link.Content)
+	if err != nil {
+		return "", errors.NewInternalError(err)
+	}
+	return string(holder), nil
+}
+
+func (m *FSRegistryStore) putBlobLink(ctx context.Context, repository string, digest digest.Digest, holder string) error {
+	content := BlobContent{
+		ContentType:   "text/plain",
+		ContentLength: int64(len(holder)),
+		Content:       io.NopCloser(strings.NewReader(holder)),
+	}
+	if err := m.FS.Put(ctx, BlobLinkPath(repository, digest), content); err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// MountBlob links the blob of repository from into repository without copying the content.
+func (m *FSRegistryStore) MountBlob(ctx context.Context, repository string, from string, digest digest.Digest) error {
+	holder, err := m.blobHolder(ctx, from, digest)
+	if err != nil {
+		return err
+	}
+	exists, err := m.FS.Exists(ctx, BlobDigestPath(holder, digest))
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+	if !exists {
+		return errors.NewBlobUnknownError(digest)
+	}
+	if holder == repository {
+		return nil
+	}
+	// the blob already stored in repository
+	if exists, err := m.FS.Exists(ctx, BlobDigestPath(repository, digest)); err != nil {
+		return errors.NewInternalError(err)
+	} else if exists {
+		return nil
+	}
+	return m.putBlobLink(ctx, repository, digest, holder)
+}
+
+// ListBlobLinks returns the blobs mounted into repository and the repositories hold them.
+func (m *FSRegistryStore) ListBlobLinks(ctx context.Context, repository string) (map[digest.Digest]BlobLink, error) {
+	metas, err := m.FS.List(ctx, path.Join(repository, "links"), true)
+	if err != nil {
+		if IsStorageNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	links := map[digest.Digest]BlobLink{}
+	for _, meta := range metas {
+		dgst, ok := digestOfPath(meta.Name)
+		if !ok {
+			continue
+		}
+		holder, err := m.blobHolder(ctx, repository, dgst)
+		if err != nil {
+			return nil, err
+		}
+		links[dgst] = BlobLink{Holder: holder, LastModified: meta.LastModified}
+	}
+	return links, nil
+}
+
+// digestOfPath parses the digest from a path ends with {algorithm}/{hex}.
+func digestOfPath(p string) (digest.Digest, bool) {
+	algo, hex := path.Base(path.Dir(p)), path.Base(p)
+	dgst := digest.NewDigestFromEncoded(digest.Algorithm(algo), hex)
+	if dgst.Validate() != nil {
+		return "", false
+	}
+	return dgst, true
+}
+
+// detachMountedBlobs moves the blobs of repository mounted by other repositories into the first of them
+// and points the other links to it, so removing repository does not break the others.
+func (m *FSRegistryStore) detachMountedBlobs(ctx context.Context, repository string) error {
+	// repositories missing from the global index may mount blobs too
+	repositories, err := m.ListRepositories(ctx)
+	if err != nil {
+		return err
+	}
+	moved := map[digest.Digest]string{}
+	for _, other := range repositories {
+		if other == repository {
+			continue
+		}
+		links, err := m.ListBlobLinks(ctx, other)
+		if err != nil {
+			return err
+		}
+		for dgst, link := range links {
+			if link.Holder != repository {
+				continue
+			}
+			if newholder, ok := moved[dgst]; ok {
+				if err := m.putBlobLink(ctx, other, dgst, newholder); err != nil {
+					return err
+				}
+				continue
+			}
+			content, err := m.FS.Get(ctx, BlobDigestPath(repository, dgst))
+			if err != nil {
+				if IsStorageNotFound(err) {
+					continue
+				}
+				return errors.NewInternalError(err)
+			}
+			err = m.FS.Put(ctx, BlobDigestPath(other, dgst), *content)
+			content.Close()
+			if err != nil {
+				return errors.NewInternalError(err)
+			}
+			if err := m.FS.Remove(ctx, BlobLinkPath(other, dgst), false); err != nil && !IsStorageNotFound(err) {
+				return errors.NewInternalError(err)
+			}
+			moved[dgst] = other
+		}
+	}
+	return nil
+}
+
 func (m *FSRegistryStore) GetBlobMeta(ctx context.Context, repository string, digest digest.Digest) (BlobMeta, error) {
-	path := BlobDigestPath(repository, digest)
+	path, err := m.BlobPath(ctx, repository, digest)
+	if err != nil {
+		return BlobMeta{}, err
+	}
 	meta, err := m.FS.Stat(ctx, path)
 	if err != nil {
+		if IsStorageNotFound(err) {
+			return BlobMeta{}, errors.NewBlobUnknownError(digest)
+		}
 		return BlobMeta{}, errors.NewInternalError(err)
 	}
-	return BlobMeta{ContentType: meta.ContentType, ContentLength: meta.Size}, nil
+	return BlobMeta{ContentType: meta.ContentType, ContentLength: meta.Size, LastModified: meta.LastModified}, nil
 }
 
 func (m *FSRegistryStore) GetBlob(ctx context.Context, repository string, digest digest.Digest) (*BlobContent, error) {
-	path := BlobDigestPath(repository, digest)
+	path, err := m.BlobPath(ctx, repository, digest)
+	if err != nil {
+		return nil, err
+	}
 	content, err := m.FS.Get(ctx, path)
 	if err != nil {
+		if IsStorageNotFound(err) {
+			return nil, errors.NewBlobUnknownError(digest)
+		}
 		return nil, errors.NewInternalError(err)
 	}
 	return content, nil
 }
 
+// PutBlob puts the content into FS, it's verified while written and committed only if it matches digest.
 func (m *FSRegistryStore) PutBlob(ctx context.Context, repository string, digest digest.Digest, content BlobContent) error {
+	verifying, err := NewVerifyingBlobContent(digest, content.Content)
+	if err != nil {
+		return err
+	}
+	// the length of a chunked request is unknown
+	if content.ContentLength < 0 {
+		content.ContentLength = 0
+	}
+	content.Content = verifying
+
 	path := BlobDigestPath(repository, digest)
 	if err := m.FS.Put(ctx, path, content); err != nil {
+		if err := verifying.Err(); err != nil {
+			return err
+		}
+		return errors.NewInternalError(err)
+	}
+	// the content is not read to the end if FS stopped at the content length
+	if !verifying.Verified() {
+		if err := m.FS.Remove(ctx, path, false); err != nil && !IsStorageNotFound(err) {
+			return errors.NewInternalError(err)
+		}
+		return errors.NewDigestInvalidError(digest.String())
+	}
+	// the blob is held by repository itself now
+	if err := m.FS.Remove(ctx, BlobLinkPath(repository, digest), false); err != nil && !IsStorageNotFound(err) {
 		return errors.NewInternalError(err)
 	}
 	return nil
 }
 
+// ListBlobs returns the blobs held by repository, blobs mounted from other repositories are not included.
 func (m *FSRegistryStore) ListBlobs(ctx context.Context, repository string) ([]digest.Digest, error) {
-	prefix := BlobDigestPath(repository, "")
-	metas, err := m.FS.List(ctx, prefix, true)
+	metas, err := m.FS.List(ctx, BlobDigestPath(repository, ""), true)
 	if err != nil {
-		return nil, err
+		if IsStorageNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.NewInternalError(err)
 	}
-	digests := make([]digest.Digest, len(metas))
+	digests := make([]digest.Digest, 0, len(metas))
 	for _, meta := range metas {
-		algo, hash := path.Split(meta.Name)
-		digests = append(digests, digest.FromString(algo+":"+hash))
+		if dgst, ok := digestOfPath(meta.Name); ok {
+			digests = append(digests, dgst)
+		}
 	}
-	return nil, nil
+	return digests, nil
 }
 
+// DeleteBlob removes the blob and the link to it in repository.
 func (m *FSRegistryStore) DeleteBlob(ctx context.Context, repository string, digest digest.Digest) error {
-	path := BlobDigestPath(repository, digest)
-	if err := m.FS.Remove(ctx, path, false); err != nil {
-		if IsS3StorageNotFound(err) {
-			return nil
+	for _, path := range []string{BlobDigestPath(repository, digest), BlobLinkPath(repository, digest)} {
+		if err := m.FS.Remove(ctx, path, false); err != nil && !IsStorageNotFound(err) {
+			return errors.NewInternalError(err)
 		}
-		return errors.NewInternalError(err)
 	}
 	return nil
 }
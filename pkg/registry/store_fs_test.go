@@ -0,0 +1,302 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// newTestFSStore returns a store on a local directory removed after the test.
+func newTestFSStore(t *testing.T) (*FSRegistryStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	options := &Options{
+		Local:     &LocalFSOptions{Basepath: filepath.Join(dir, "data")},
+		S3:        &S3Options{},
+		UploadDir: filepath.Join(dir, "uploads"),
+	}
+	store, err := NewFSRegistryStore(context.Background(), options)
+	if err != nil {
+		t.Fatalf("NewFSRegistryStore() error = %v", err)
+	}
+	return store, options.Local.Basepath
+}
+
+func putTestBlob(t *testing.T, store RegistryStore, repository string, content string) types.Descriptor {
+	t.Helper()
+	dgst := digest.FromString(content)
+	blob := BlobContent{ContentLength: int64(len(content)), Content: io.NopCloser(bytes.NewReader([]byte(content)))}
+	if err := store.PutBlob(context.Background(), repository, dgst, blob); err != nil {
+		t.Fatalf("PutBlob() error = %v", err)
+	}
+	return types.Descriptor{Name: content, MediaType: MediaTypeModelFile, Digest: dgst, Size: int64(len(content))}
+}
+
+func testManifest(blobs ...types.Descriptor) types.Manifest {
+	return types.Manifest{SchemaVersion: 2, MediaType: MediaTypeModelManifestJson, Blobs: blobs}
+}
+
+func putTestManifest(t *testing.T, store RegistryStore, repository, reference string, manifest types.Manifest) {
+	t.Helper()
+	if err := store.PutManifest(context.Background(), repository, reference, MediaTypeModelManifestJson, manifest); err != nil {
+		t.Fatalf("PutManifest(%s:%s) error = %v", repository, reference, err)
+	}
+}
+
+// ageStorage sets the modified time of all files in the storage to d ago.
+func ageStorage(t *testing.T, basepath string, d time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-d)
+	err := filepath.WalkDir(basepath, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatalf("age storage: %v", err)
+	}
+}
+
+func TestFSRegistryStorePutManifestChecksBlobs(t *testing.T) {
+	fsstore, _ := newTestFSStore(t)
+	s3store, _ := newTestS3Store(t)
+	for name, store := range map[string]RegistryStore{"fs": fsstore, "s3": s3store} {
+		t.Run(name, func(t *testing.T) {
+			testPutManifestChecksBlobs(t, store)
+		})
+	}
+}
+
+func testPutManifestChecksBlobs(t *testing.T, store RegistryStore) {
+	ctx := context.Background()
+	weights := putTestBlob(t, store, "project/demo", "weights")
+	config := putTestBlob(t, store, "project/demo", "{}")
+	// the s3 store removes the blob of mismatched size
+	sized := putTestBlob(t, store, "project/demo", "sized")
+
+	ociConfig := func(desc types.Descriptor) map[string]string {
+		raw, _ := json.Marshal(OCIDescriptor{MediaType: MediaTypeOCIEmptyJSON, Digest: desc.Digest, Size: desc.Size})
+		return map[string]string{AnnotationOCIConfig: string(raw)}
+	}
+	missing := types.Descriptor{Name: "missing", MediaType: MediaTypeModelFile, Digest: digest.FromString("missing"), Size: 7}
+	another := types.Descriptor{Name: "another", MediaType: MediaTypeModelFile, Digest: digest.FromString("another"), Size: 7}
+
+	tests := []struct {
+		name        string
+		manifest    types.Manifest
+		wantCode    errors.ErrCode
+		wantMissing []digest.Digest
+	}{
+		{name: "all blobs exist", manifest: testManifest(weights)},
+		{name: "blob missing", manifest: testManifest(weights, missing), wantCode: errors.ErrCodeManifestBlobUnknown, wantMissing: []digest.Digest{missing.Digest}},
+		{
+			name:        "blobs missing",
+			manifest:    testManifest(missing, weights, another),
+			wantCode:    errors.ErrCodeManifestBlobUnknown,
+			wantMissing: []digest.Digest{missing.Digest, another.Digest},
+		},
+		{
+			name:     "size mismatch",
+			manifest: testManifest(types.Descriptor{Name: "sized", MediaType: MediaTypeModelFile, Digest: sized.Digest, Size: 1}),
+			wantCode: errors.ErrCodeManifestInvalid,
+		},
+		{
+			name:     "unsupported blob media type",
+			manifest: testManifest(types.Descriptor{Name: "weights", MediaType: "text/plain", Digest: weights.Digest, Size: weights.Size}),
+			wantCode: errors.ErrCodeManifestInvalid,
+		},
+		{
+			name: "oci config exists",
+			manifest: func() types.Manifest {
+				m := testManifest(weights)
+				m.Annotations = ociConfig(config)
+				return m
+			}(),
+		},
+		{
+			name: "oci config missing",
+			manifest: func() types.Manifest {
+				m := testManifest(weights)
+				m.Annotations = ociConfig(missing)
+				return m
+			}(),
+			wantCode:    errors.ErrCodeManifestBlobUnknown,
+			wantMissing: []digest.Digest{missing.Digest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.PutManifest(ctx, "project/demo", "test", MediaTypeModelManifestJson, tt.manifest)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("PutManifest() error = %v", err)
+				}
+				return
+			}
+			if !errors.IsErrCode(err, tt.wantCode) {
+				t.Fatalf("PutManifest() error = %v, want %s", err, tt.wantCode)
+			}
+			if tt.wantMissing != nil {
+				slices.Sort(tt.wantMissing)
+				if want := errors.NewManifestBlobUnknownError(tt.wantMissing); err.Error() != want.Error() {
+					t.Errorf("PutManifest() error = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFSRegistryStoreRemoveIndexKeepsMountedBlobs(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStore(t)
+
+	blob := putTestBlob(t, store, "project/a", "weights")
+	putTestManifest(t, store, "project/a", "v1", testManifest(blob))
+	// project/b and project/c mount the blob, project/c has an untagged manifest only and is not in the global index
+	for _, repository := range []string{"project/b", "project/c"} {
+		if err := store.MountBlob(ctx, repository, "project/a", blob.Digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	putTestManifest(t, store, "project/b", "v1", testManifest(blob))
+	manifest := testManifest(blob)
+	contentDigest, _ := manifest.Digest()
+	putTestManifest(t, store, "project/c", contentDigest.String(), manifest)
+
+	if err := store.RemoveIndex(ctx, "project/a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, repository := range []string{"project/b", "project/c"} {
+		content, err := store.GetBlob(ctx, repository, blob.Digest)
+		if err != nil {
+			t.Errorf("GetBlob(%s) after the holder removed error = %v", repository, err)
+			continue
+		}
+		content.Close()
+	}
+}
+
+// racingFS changes an object before each conditional write of it, as another replica writes meanwhile.
+type racingFS struct {
+	FSProvider
+	changes int
+}
+
+func (r *racingFS) PutIfMatch(ctx context.Context, path string, content BlobContent, etag string) error {
+	if r.changes > 0 {
+		r.changes--
+		if err := r.FSProvider.Put(ctx, path, testContent(fmt.Sprintf(`{"annotations":{"change":"%d"}}`, r.changes))); err != nil {
+			return err
+		}
+	}
+	return r.FSProvider.PutIfMatch(ctx, path, content, etag)
+}
+
+func TestFSRegistryStoreUpdateIndexFileRetries(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		changes   int
+		wantBuilt int
+		wantErr   bool
+	}{
+		{name: "not changed", changes: 0, wantBuilt: 1},
+		{name: "changed concurrently", changes: 2, wantBuilt: 3},
+		{name: "always changed", changes: IndexUpdateRetries, wantBuilt: IndexUpdateRetries, wantErr: true},
+	}
+	for name, fs := range newTestFSProviders(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				store := &FSRegistryStore{FS: &racingFS{FSProvider: fs, changes: tt.changes}}
+				repository := "project/" + strings.ReplaceAll(tt.name, " ", "-")
+				built := 0
+				err := store.updateIndexFile(ctx, IndexPath(repository), false, func() (types.Index, error) {
+					built++
+					return types.Index{Manifests: []types.Descriptor{{Name: "v1"}}}, nil
+				})
+				if (err != nil) != tt.wantErr || built != tt.wantBuilt {
+					t.Fatalf("updateIndexFile() error = %v, built %d times, want error %v and built %d times", err, built, tt.wantErr, tt.wantBuilt)
+				}
+				if tt.wantErr {
+					return
+				}
+				index, err := store.GetIndex(ctx, repository, "")
+				if err != nil || len(index.Manifests) != 1 {
+					t.Errorf("index = %+v, %v, want the index built", index, err)
+				}
+			})
+		}
+	}
+}
+
+func TestFSRegistryStoreConcurrentPutManifest(t *testing.T) {
+	ctx := context.Background()
+	for name, fs := range newTestFSProviders(t) {
+		t.Run(name, func(t *testing.T) {
+			// replicas lock in process only, their updates of an index file are detected by conditional writes
+			replicas := []*FSRegistryStore{{FS: fs}, {FS: fs}}
+			repository := "project/a"
+			blob := putTestBlob(t, replicas[0], repository, "weights")
+			putTestBlob(t, replicas[0], "project/b", "weights")
+			manifest := testManifest(blob)
+
+			eg := errgroup.Group{}
+			for i := 0; i < 10; i++ {
+				i := i
+				eg.Go(func() error {
+					return replicas[i%2].PutManifest(ctx, repository, fmt.Sprintf("v%d", i), MediaTypeModelManifestJson, manifest)
+				})
+			}
+			if err := eg.Wait(); err != nil {
+				t.Fatalf("PutManifest() error = %v", err)
+			}
+			index, err := replicas[0].GetIndex(ctx, repository, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(index.Manifests) != 10 {
+				t.Errorf("versions = %d, want all 10 pushed", len(index.Manifests))
+			}
+
+			// another replica pushes between the build and the write of an index update
+			interleaved := &pausingFS{FSProvider: fs}
+			replica := &FSRegistryStore{FS: interleaved}
+			interleaved.before = func() {
+				putTestManifest(t, replicas[1], "project/b", "v2", manifest)
+			}
+			putTestManifest(t, replica, "project/b", "v1", manifest)
+			if index, _ := replica.GetIndex(ctx, "project/b", ""); len(index.Manifests) != 2 {
+				t.Errorf("versions = %v, want v1 and v2", index.Manifests)
+			}
+		})
+	}
+}
+
+// pausingFS calls before once ahead of the first conditional write.
+type pausingFS struct {
+	FSProvider
+	before func()
+}
+
+func (p *pausingFS) PutIfMatch(ctx context.Context, path string, content BlobContent, etag string) error {
+	if before := p.before; before != nil {
+		p.before = nil
+		before()
+	}
+	return p.FSProvider.PutIfMatch(ctx, path, content, etag)
+}
@@ -1,9 +1,11 @@
 package registry
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"time"
 
@@ -19,12 +21,15 @@ import (
 const (
 	MultiPartUploadThreshold = 5 * 1024 * 1024 * 1024
 	DefaultPartCount         = 3 // parts if no size
+
+	// UnverifiedMarkerSuffix marks a blob uploaded via presigned location but not verified yet.
+	UnverifiedMarkerSuffix = ".unverified"
 )
 
 var ErrUploadNotFound = modelxerrors.NewInternalError(errors.New("upload not found"))
 
 type S3RegistryStore struct {
-	fs       RegistryStore
+	fs       *FSRegistryStore
 	provider *S3StorageProvider
 }
 
@@ -35,11 +40,16 @@ func NewS3RegistryStore(ctx context.Context, options *Options) (*S3RegistryStore
 	if err != nil {
 		return nil, err
 	}
+	metadata, err := NewMetadataDB(options)
+	if err != nil {
+		return nil, err
+	}
 	store := &FSRegistryStore{
-		FS:             fs,
+		FS:             NewTracingFSProvider(NewMetricsFSProvider(fs)),
 		EnableRedirect: options.EnableRedirect,
+		Metadata:       metadata,
 	}
-	if err := store.RefreshGlobalIndex(ctx); err != nil {
+	if err := store.InitIndex(ctx); err != nil {
 		return nil, err
 	}
 	return &S3RegistryStore{fs: store, provider: fs}, nil
@@ -57,6 +67,10 @@ func (s *S3RegistryStore) RemoveIndex(ctx context.Context, repository string) er
 	return s.fs.RemoveIndex(ctx, repository)
 }
 
+func (s *S3RegistryStore) ListRepositories(ctx context.Context) ([]string, error) {
+	return s.fs.ListRepositories(ctx)
+}
+
 func (s *S3RegistryStore) ExistsManifest(ctx context.Context, repository string, reference string) (bool, error) {
 	return s.fs.ExistsManifest(ctx, repository, reference)
 }
@@ -77,6 +91,10 @@ func (s *S3RegistryStore) PutManifest(ctx context.Context, repository string, re
 			// check if uploadid exists and match size
 			meta, err := s.fs.GetBlobMeta(ctx, repository, blob.Digest)
 			if err != nil {
+				// missing blobs are reported all together by the fs store
+				if modelxerrors.IsErrCode(err, modelxerrors.ErrCodeBlobUnknown) {
+					continue
+				}
 				return err
 			}
 			if meta.ContentLength != blob.Size {
@@ -84,10 +102,23 @@ func (s *S3RegistryStore) PutManifest(ctx context.Context, repository string, re
 				if err := s.fs.DeleteBlob(ctx, repository, blob.Digest); err != nil {
 					return err
 				}
-				return fmt.Errorf("size mismatch: %d != %d", meta.ContentLength, blob.Size)
+				return modelxerrors.NewManifestInvalidError(fmt.Errorf("size of blob %s mismatch: %d != %d", blob.Name, meta.ContentLength, blob.Size))
 			}
 		}
 	}
+	// verify the content of blobs uploaded via presigned location
+	blobs := manifest.Blobs
+	if manifest.Config.Digest != "" {
+		blobs = append([]types.Descriptor{manifest.Config}, blobs...)
+	}
+	if config, _ := OCIManifestReferences(manifest); config != nil {
+		blobs = append(blobs, types.Descriptor{Digest: config.Digest})
+	}
+	for _, blob := range blobs {
+		if err := s.verifyUploaded(ctx, repository, blob.Digest); err != nil && !modelxerrors.IsErrCode(err, modelxerrors.ErrCodeBlobUnknown) {
+			return err
+		}
+	}
 	return s.fs.PutManifest(ctx, repository, reference, contentType, manifest)
 }
 
@@ -95,44 +126,183 @@ func (s *S3RegistryStore) DeleteManifest(ctx context.Context, repository string,
 	return s.fs.DeleteManifest(ctx, repository, reference)
 }
 
+func (s *S3RegistryStore) ListManifestDigests(ctx context.Context, repository string) ([]digest.Digest, error) {
+	return s.fs.ListManifestDigests(ctx, repository)
+}
+
 func (s *S3RegistryStore) ListBlobs(ctx context.Context, repository string) ([]digest.Digest, error) {
 	return s.fs.ListBlobs(ctx, repository)
 }
 
+// GetBlob returns the blob only if it is verified, an unverified blob is unknown until its manifest is put.
 func (s *S3RegistryStore) GetBlob(ctx context.Context, repository string, digest digest.Digest) (*BlobContent, error) {
+	if err := s.checkVerified(ctx, repository, digest); err != nil {
+		return nil, err
+	}
 	return s.fs.GetBlob(ctx, repository, digest)
 }
 
+// DeleteBlob removes the blob and its unverified marker if it is never verified.
 func (s *S3RegistryStore) DeleteBlob(ctx context.Context, repository string, digest digest.Digest) error {
-	return s.fs.DeleteBlob(ctx, repository, digest)
+	if err := s.fs.DeleteBlob(ctx, repository, digest); err != nil {
+		return err
+	}
+	if err := s.provider.Remove(ctx, BlobDigestPath(repository, digest)+UnverifiedMarkerSuffix, false); err != nil && !IsStorageNotFound(err) {
+		return modelxerrors.NewInternalError(err)
+	}
+	return nil
 }
 
+// PutBlob puts the content verified by the registry, it replaces an unverified upload.
 func (s *S3RegistryStore) PutBlob(ctx context.Context, repository string, digest digest.Digest, content BlobContent) error {
-	return s.fs.PutBlob(ctx, repository, digest, content)
+	if err := s.fs.PutBlob(ctx, repository, digest, content); err != nil {
+		return err
+	}
+	if err := s.provider.Remove(ctx, BlobDigestPath(repository, digest)+UnverifiedMarkerSuffix, false); err != nil && !IsStorageNotFound(err) {
+		return modelxerrors.NewInternalError(err)
+	}
+	return nil
 }
 
+// MountBlob refuses to mount a blob not verified yet, the verification happens on the manifest put
+// into the repository holds it, a mounted blob would skip it.
+func (s *S3RegistryStore) MountBlob(ctx context.Context, repository string, from string, digest digest.Digest) error {
+	if err := s.checkVerified(ctx, from, digest); err != nil {
+		return err
+	}
+	return s.fs.MountBlob(ctx, repository, from, digest)
+}
+
+func (s *S3RegistryStore) ListBlobLinks(ctx context.Context, repository string) (map[digest.Digest]BlobLink, error) {
+	return s.fs.ListBlobLinks(ctx, repository)
+}
+
+// ExistsBlob reports false for a blob not verified yet, so clients upload it again instead of trusting it.
 func (s *S3RegistryStore) ExistsBlob(ctx context.Context, repository string, digest digest.Digest) (bool, error) {
-	return s.fs.ExistsBlob(ctx, repository, digest)
+	exists, err := s.fs.ExistsBlob(ctx, repository, digest)
+	if err != nil || !exists {
+		return exists, err
+	}
+	unverified, err := s.isUnverified(ctx, repository, digest)
+	if err != nil {
+		return false, err
+	}
+	return !unverified, nil
 }
 
 func (s *S3RegistryStore) GetBlobMeta(ctx context.Context, repository string, digest digest.Digest) (BlobMeta, error) {
+	if err := s.checkVerified(ctx, repository, digest); err != nil {
+		return BlobMeta{}, err
+	}
 	return s.fs.GetBlobMeta(ctx, repository, digest)
 }
 
+// unverifiedMarker returns the marker path of the blob in the repository holds it.
+func (s *S3RegistryStore) unverifiedMarker(ctx context.Context, repository string, digest digest.Digest) (string, error) {
+	path, err := s.fs.BlobPath(ctx, repository, digest)
+	if err != nil {
+		return "", err
+	}
+	return path + UnverifiedMarkerSuffix, nil
+}
+
+func (s *S3RegistryStore) isUnverified(ctx context.Context, repository string, digest digest.Digest) (bool, error) {
+	marker, err := s.unverifiedMarker(ctx, repository, digest)
+	if err != nil {
+		return false, err
+	}
+	unverified, err := s.provider.Exists(ctx, marker)
+	if err != nil {
+		return false, modelxerrors.NewInternalError(err)
+	}
+	return unverified, nil
+}
+
+// checkVerified returns a blob unknown error if the blob is not verified yet.
+func (s *S3RegistryStore) checkVerified(ctx context.Context, repository string, digest digest.Digest) error {
+	unverified, err := s.isUnverified(ctx, repository, digest)
+	if err != nil {
+		return err
+	}
+	if unverified {
+		return modelxerrors.NewBlobUnknownError(digest)
+	}
+	return nil
+}
+
 func (s *S3RegistryStore) GetBlobLocation(ctx context.Context, repository string, digest digest.Digest,
 	purpose string, properties map[string]string,
 ) (*BlobLocation, error) {
 	path := BlobDigestPath(repository, digest)
 	switch purpose {
 	case BlobLocationPurposeDownload:
+		if err := s.checkVerified(ctx, repository, digest); err != nil {
+			return nil, err
+		}
+		// a mounted blob is downloaded from the repository holds it
+		path, err := s.fs.BlobPath(ctx, repository, digest)
+		if err != nil {
+			return nil, err
+		}
 		return s.downloadLocation(ctx, path, properties)
 	case BlobLocationPurposeUpload:
+		// a verified blob must not be overwritten by content not verified
+		if exists, err := s.ExistsBlob(ctx, repository, digest); err != nil {
+			return nil, err
+		} else if exists {
+			return nil, modelxerrors.NewConflictError("blob " + digest.String() + " already exists")
+		}
+		// content uploaded to the location is verified on PutManifest
+		marker := BlobContent{Content: io.NopCloser(bytes.NewReader(nil))}
+		if err := s.provider.Put(ctx, path+UnverifiedMarkerSuffix, marker); err != nil {
+			return nil, err
+		}
 		return s.uploadLocation(ctx, path, properties)
 	default:
 		return nil, modelxerrors.NewUnsupportedError("purpose: " + purpose)
 	}
 }
 
+// verifyUploaded re-hashes the blob uploaded via presigned location, the blob is removed if it mismatches the digest.
+func (s *S3RegistryStore) verifyUploaded(ctx context.Context, repository string, dgst digest.Digest) error {
+	marker, err := s.unverifiedMarker(ctx, repository, dgst)
+	if err != nil {
+		return err
+	}
+	unverified, err := s.provider.Exists(ctx, marker)
+	if err != nil {
+		return modelxerrors.NewInternalError(err)
+	}
+	if !unverified {
+		return nil
+	}
+	content, err := s.fs.GetBlob(ctx, repository, dgst)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	got, err := DigestOfContent(dgst, content.Content)
+	if err != nil {
+		return err
+	}
+	if got != dgst {
+		holder, err := s.fs.blobHolder(ctx, repository, dgst)
+		if err != nil {
+			return err
+		}
+		if err := s.fs.DeleteBlob(ctx, holder, dgst); err != nil {
+			return err
+		}
+		_ = s.provider.Remove(ctx, marker, false)
+		return modelxerrors.NewDigestInvalidError(dgst.String())
+	}
+	if err := s.provider.Remove(ctx, marker, false); err != nil {
+		return modelxerrors.NewInternalError(err)
+	}
+	return nil
+}
+
 func (s *S3RegistryStore) completeMultipartUpload(ctx context.Context, path string, desiresieze int64) error {
 	uploadid, err := s.getUploadId(ctx, path, false)
 	if err != nil {
@@ -0,0 +1,369 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/auth"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+const (
+	// APITokenPrefix prefixes the tokens issued by the registry, a token is {prefix}{id}_{secret}.
+	APITokenPrefix = "mx_"
+	// RobotUsernamePrefix prefixes the usernames of robot accounts.
+	RobotUsernamePrefix = "robot$"
+	// APITokenCacheTTL is how long an api token is cached, a token revoked by another replica is accepted meanwhile.
+	APITokenCacheTTL = time.Minute
+
+	apiTokensDir = "_tokens"
+)
+
+var apiTokenNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]+(?:[._-][a-zA-Z0-9]+)*$`)
+
+// apiTokenIDRegexp matches the ids generated by Create, 8 random bytes in hex.
+var apiTokenIDRegexp = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// APITokenPath returns the path of the api token, tokens are stored apart from repositories.
+func APITokenPath(id string) string {
+	return path.Join(apiTokensDir, id+".json")
+}
+
+// storedAPIToken is the api token saved in FS, only the hash of the secret is saved.
+type storedAPIToken struct {
+	types.APIToken
+	// Groups of the user when the personal token created.
+	Groups []string `json:"groups,omitempty"`
+	Hash   string   `json:"hash"`
+}
+
+// APITokens issues, revokes and authenticates the api tokens saved in FS.
+type APITokens struct {
+	FS FSProvider
+
+	mu    sync.Mutex
+	cache map[string]apiTokenCacheEntry
+}
+
+type apiTokenCacheEntry struct {
+	token   *storedAPIToken
+	expires time.Time
+}
+
+var _ auth.TokenAuthenticator = &APITokens{}
+
+func NewAPITokens(fs FSProvider) *APITokens {
+	return &APITokens{FS: fs, cache: map[string]apiTokenCacheEntry{}}
+}
+
+// Create saves token with a new id and secret, the secret is only returned here.
+func (t *APITokens) Create(ctx context.Context, token types.APIToken, groups []string) (*types.APIToken, error) {
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	secret, err := randomString(24, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	token.ID = id
+	token.Token = ""
+	token.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	plain := APITokenPrefix + id + "_" + secret
+	stored := storedAPIToken{APIToken: token, Groups: groups, Hash: hashAPIToken(plain)}
+	content, err := json.Marshal(stored)
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	if err := t.FS.Put(ctx, APITokenPath(id), BlobContent{
+		Content:       io.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		ContentType:   "application/json",
+	}); err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	token.Token = plain
+	return &token, nil
+}
+
+func (t *APITokens) Get(ctx context.Context, id string) (*storedAPIToken, error) {
+	body, err := t.FS.Get(ctx, APITokenPath(id))
+	if err != nil {
+		if IsStorageNotFound(err) {
+			return nil, errors.NewTokenUnknownError(id)
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	defer body.Close()
+	stored := &storedAPIToken{}
+	if err := json.NewDecoder(body).Decode(stored); err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return stored, nil
+}
+
+// List returns all api tokens sorted by creation time, secrets are not included.
+func (t *APITokens) List(ctx context.Context) ([]types.APIToken, error) {
+	metas, err := t.FS.List(ctx, apiTokensDir, false)
+	if err != nil {
+		if IsStorageNotFound(err) {
+			return []types.APIToken{}, nil
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	tokens := make([]types.APIToken, 0, len(metas))
+	for _, meta := range metas {
+		id, ok := strings.CutSuffix(path.Base(meta.Name), ".json")
+		if !ok {
+			continue
+		}
+		stored, err := t.Get(ctx, id)
+		if err != nil {
+			// revoked meanwhile
+			if errors.IsErrCode(err, errors.ErrCodeTokenUnknown) {
+				continue
+			}
+			return nil, err
+		}
+		tokens = append(tokens, stored.APIToken)
+	}
+	slices.SortFunc(tokens, func(a, b types.APIToken) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (t *APITokens) Revoke(ctx context.Context, id string) error {
+	t.mu.Lock()
+	delete(t.cache, id)
+	t.mu.Unlock()
+	if err := t.FS.Remove(ctx, APITokenPath(id), false); err != nil {
+		if IsStorageNotFound(err) {
+			return errors.NewTokenUnknownError(id)
+		}
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// Authenticate accepts the unexpired api tokens, other tokens are left to the other authenticators.
+// the id is checked before any lookup, it must not escape the tokens directory.
+func (t *APITokens) Authenticate(ctx context.Context, token string) (*auth.UserInfo, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, APITokenPrefix), "_")
+	if !ok || !strings.HasPrefix(token, APITokenPrefix) || !apiTokenIDRegexp.MatchString(id) {
+		return nil, auth.ErrUnauthenticated
+	}
+	stored, err := t.cached(ctx, id)
+	if err != nil {
+		if errors.IsErrCode(err, errors.ErrCodeTokenUnknown) {
+			return nil, auth.ErrUnauthenticated
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIToken(token)), []byte(stored.Hash)) != 1 {
+		return nil, auth.ErrUnauthenticated
+	}
+	if stored.ExpiresAt != nil && time.Now().After(*stored.ExpiresAt) {
+		return nil, auth.ErrUnauthenticated
+	}
+	return &auth.UserInfo{
+		Username: stored.Username,
+		Groups:   stored.Groups,
+		Scopes:   stored.Scopes,
+		Robot:    stored.Type == types.APITokenTypeRobot,
+	}, nil
+}
+
+func (t *APITokens) cached(ctx context.Context, id string) (*storedAPIToken, error) {
+	t.mu.Lock()
+	entry, ok := t.cache[id]
+	t.mu.Unlock()
+	now := time.Now()
+	if ok && now.Before(entry.expires) {
+		return entry.token, nil
+	}
+	stored, err := t.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, entry := range t.cache {
+		if now.After(entry.expires) {
+			delete(t.cache, k)
+		}
+	}
+	t.cache[id] = apiTokenCacheEntry{token: stored, expires: now.Add(APITokenCacheTTL)}
+	return stored, nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encode(buf), nil
+}
+
+// checkManageAPITokens requires an authenticated user not limited by scopes,
+// so a scoped token can not issue tokens beyond its scopes.
+func checkManageAPITokens(r *http.Request) (string, error) {
+	username := UsernameFromContext(r.Context())
+	if username == "" {
+		return "", errors.NewUnauthorizedError("authentication required")
+	}
+	if ScopesFromContext(r.Context()) != nil {
+		return "", errors.NewDeniedError("tokens limited by scopes can not manage api tokens")
+	}
+	return username, nil
+}
+
+func (s *Registry) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	username, err := checkManageAPITokens(r)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	var req types.APITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, errors.NewParameterInvalidError(err.Error()))
+		return
+	}
+	if !apiTokenNameRegexp.MatchString(req.Name) {
+		ResponseError(w, errors.NewParameterInvalidError(fmt.Sprintf("invalid token name %q", req.Name)))
+		return
+	}
+	token := types.APIToken{Name: req.Name, Scopes: req.Scopes, CreatedBy: username}
+	if req.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			ResponseError(w, errors.NewParameterInvalidError("expiresIn: "+req.ExpiresIn))
+			return
+		}
+		expiresAt := time.Now().Add(expiresIn).UTC().Truncate(time.Second)
+		token.ExpiresAt = &expiresAt
+	}
+	for _, scope := range req.Scopes {
+		if _, _, err := ParseScope(scope); err != nil {
+			ResponseError(w, errors.NewParameterInvalidError(err.Error()))
+			return
+		}
+	}
+	var groups []string
+	switch req.Type {
+	case "", types.APITokenTypePersonal:
+		token.Type = types.APITokenTypePersonal
+		token.Username = username
+		groups = GroupsFromContext(r.Context())
+	case types.APITokenTypeRobot:
+		if err := s.checkCreateRobot(r, req); err != nil {
+			ResponseError(w, err)
+			return
+		}
+		token.Type = types.APITokenTypeRobot
+		token.Username = RobotUsernamePrefix + req.Name
+	default:
+		ResponseError(w, errors.NewParameterInvalidError(fmt.Sprintf("unknown token type %q, must be personal or robot", req.Type)))
+		return
+	}
+	created, err := s.Tokens.Create(r.Context(), token, groups)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	ResponseOK(w, created)
+}
+
+// checkCreateRobot requires the user to be admin of all repositories the robot can access.
+func (s *Registry) checkCreateRobot(r *http.Request, req types.APITokenRequest) error {
+	if len(req.Scopes) == 0 {
+		return errors.NewParameterInvalidError("robot accounts require scopes")
+	}
+	for _, scope := range req.Scopes {
+		pattern, _, _ := ParseScope(scope)
+		if !s.isAdmin(r, pattern) {
+			return errors.NewDeniedError(fmt.Sprintf("user %s requires role admin on %s", UsernameFromContext(r.Context()), pattern))
+		}
+	}
+	tokens, err := s.Tokens.List(r.Context())
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.Type == types.APITokenTypeRobot && token.Name == req.Name {
+			return errors.NewConflictError(fmt.Sprintf("robot account %s already exists", req.Name))
+		}
+	}
+	return nil
+}
+
+// ListAPITokens lists the tokens created by the user, admins list all tokens.
+func (s *Registry) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	username, err := checkManageAPITokens(r)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	tokens, err := s.Tokens.List(r.Context())
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	if !s.isAdmin(r, "*") {
+		owned := []types.APIToken{}
+		for _, token := range tokens {
+			if token.CreatedBy == username {
+				owned = append(owned, token)
+			}
+		}
+		tokens = owned
+	}
+	ResponseOK(w, tokens)
+}
+
+// RevokeAPIToken revokes a token created by the user, admins can revoke any token.
+func (s *Registry) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	username, err := checkManageAPITokens(r)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	token, err := s.Tokens.Get(r.Context(), id)
+	if err != nil {
+		ResponseError(w, err)
+		return
+	}
+	if token.CreatedBy != username && !s.isAdmin(r, "*") {
+		// not to tell others' tokens exist
+		ResponseError(w, errors.NewTokenUnknownError(id))
+		return
+	}
+	if err := s.Tokens.Revoke(r.Context(), id); err != nil {
+		ResponseError(w, err)
+		return
+	}
+	ResponseOK(w, "ok")
+}
@@ -0,0 +1,268 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slices"
+	"kubegems.io/modelx/pkg/auth"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+func newTestAPITokens(t *testing.T) (*APITokens, string) {
+	t.Helper()
+	dir := t.TempDir()
+	fs, err := NewLocalFSProvider(&LocalFSOptions{Basepath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAPITokens(fs), dir
+}
+
+func TestAPITokensAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	tokens, dir := newTestAPITokens(t)
+	create := func(token types.APIToken, groups []string) *types.APIToken {
+		created, err := tokens.Create(ctx, token, groups)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	personal := create(types.APIToken{Name: "laptop", Type: types.APITokenTypePersonal, Username: "alice", ExpiresAt: &future}, []string{"ml-team"})
+	robot := create(types.APIToken{Name: "ci", Type: types.APITokenTypeRobot, Username: "robot$ci", Scopes: []string{"team/*:writer"}}, nil)
+	expired := create(types.APIToken{Name: "old", Type: types.APITokenTypePersonal, Username: "alice", ExpiresAt: &past}, nil)
+	revoked := create(types.APIToken{Name: "revoked", Type: types.APITokenTypePersonal, Username: "alice"}, nil)
+	if _, err := tokens.Authenticate(ctx, revoked.Token); err != nil {
+		t.Fatal(err)
+	}
+	// revoked after cached
+	if err := tokens.Revoke(ctx, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the hash of the secret is saved
+	stored, err := os.ReadFile(filepath.Join(dir, APITokenPath(personal.ID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(stored), personal.Token) || !strings.Contains(string(stored), hashAPIToken(personal.Token)) {
+		t.Errorf("stored token = %s, want the hash only", stored)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    *auth.UserInfo
+		wantErr bool
+	}{
+		{name: "personal", token: personal.Token, want: &auth.UserInfo{Username: "alice", Groups: []string{"ml-team"}}},
+		{name: "robot", token: robot.Token, want: &auth.UserInfo{Username: "robot$ci", Scopes: []string{"team/*:writer"}, Robot: true}},
+		{name: "wrong secret", token: APITokenPrefix + personal.ID + "_wrong", wantErr: true},
+		{name: "secret of another token", token: APITokenPrefix + personal.ID + strings.TrimPrefix(robot.Token, APITokenPrefix+robot.ID), wantErr: true},
+		{name: "expired", token: expired.Token, wantErr: true},
+		{name: "revoked", token: revoked.Token, wantErr: true},
+		{name: "unknown id", token: APITokenPrefix + "0000000000000000_secret", wantErr: true},
+		{name: "not an api token", token: "a-static-token", wantErr: true},
+		{name: "no secret", token: APITokenPrefix + personal.ID, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tokens.Authenticate(ctx, tt.token)
+			if tt.wantErr {
+				if err != auth.ErrUnauthenticated {
+					t.Fatalf("Authenticate() error = %v, want unauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if user.Username != tt.want.Username || user.Robot != tt.want.Robot ||
+				!slices.Equal(user.Groups, tt.want.Groups) || !slices.Equal(user.Scopes, tt.want.Scopes) {
+				t.Errorf("Authenticate() = %+v, want %+v", user, tt.want)
+			}
+		})
+	}
+}
+
+// serveTokens calls the handler of the token api as user, the response data is decoded into data if not nil.
+func serveTokens(t *testing.T, handler http.HandlerFunc, user testUser, method, body string, vars map[string]string, data any) errors.ErrCode {
+	t.Helper()
+	req := httptest.NewRequest(method, "/_tokens", strings.NewReader(body)).WithContext(user.request().Context())
+	if vars != nil {
+		req = mux.SetURLVars(req, vars)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		info := errors.ErrorInfo{}
+		if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+			t.Fatalf("decode error response: %v", err)
+		}
+		return info.Code
+	}
+	if data != nil {
+		if err := json.NewDecoder(rec.Body).Decode(data); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return ""
+}
+
+func TestRegistryCreateAPIToken(t *testing.T) {
+	tokens, _ := newTestAPITokens(t)
+	s := &Registry{Tokens: tokens, Authorizer: newTestAuthorizer(t)}
+	alice := testUser{username: "alice", groups: []string{"ml-team"}}
+
+	tests := []struct {
+		name     string
+		user     testUser
+		body     string
+		wantCode errors.ErrCode
+		want     types.APIToken
+	}{
+		{
+			name: "personal", user: alice, body: `{"name":"laptop","scopes":["team/*:reader"],"expiresIn":"24h"}`,
+			want: types.APIToken{Name: "laptop", Type: types.APITokenTypePersonal, Username: "alice", CreatedBy: "alice", Scopes: []string{"team/*:reader"}},
+		},
+		{
+			name: "robot", user: alice, body: `{"name":"ci","type":"robot","scopes":["team/*:writer"]}`,
+			want: types.APIToken{Name: "ci", Type: types.APITokenTypeRobot, Username: "robot$ci", CreatedBy: "alice", Scopes: []string{"team/*:writer"}},
+		},
+		{name: "duplicate robot", user: alice, body: `{"name":"ci","type":"robot","scopes":["team/*:reader"]}`, wantCode: errors.ErrCodeConflict},
+		{name: "robot beyond admin role", user: alice, body: `{"name":"all","type":"robot","scopes":["*:reader"]}`, wantCode: errors.ErrCodeDenied},
+		{name: "robot without scopes", user: alice, body: `{"name":"none","type":"robot"}`, wantCode: errors.ErrCodeInvalidParameter},
+		{name: "invalid name", user: alice, body: `{"name":"a b"}`, wantCode: errors.ErrCodeInvalidParameter},
+		{name: "invalid scope", user: alice, body: `{"name":"scoped","scopes":["team/*"]}`, wantCode: errors.ErrCodeInvalidParameter},
+		{name: "invalid expires in", user: alice, body: `{"name":"expires","expiresIn":"-1h"}`, wantCode: errors.ErrCodeInvalidParameter},
+		{name: "unknown type", user: alice, body: `{"name":"typed","type":"service"}`, wantCode: errors.ErrCodeInvalidParameter},
+		{name: "scoped token", user: testUser{username: "alice", scopes: []string{"*:admin"}}, body: `{"name":"nested"}`, wantCode: errors.ErrCodeDenied},
+		{name: "anonymous", user: testUser{anonymous: true}, body: `{"name":"anonymous"}`, wantCode: errors.ErrCodeUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := types.APIToken{}
+			code := serveTokens(t, s.CreateAPIToken, tt.user, http.MethodPost, tt.body, nil, &created)
+			if code != tt.wantCode {
+				t.Fatalf("CreateAPIToken() code = %q, want %q", code, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				return
+			}
+			if created.Name != tt.want.Name || created.Type != tt.want.Type || created.Username != tt.want.Username ||
+				created.CreatedBy != tt.want.CreatedBy || !slices.Equal(created.Scopes, tt.want.Scopes) {
+				t.Errorf("CreateAPIToken() = %+v, want %+v", created, tt.want)
+			}
+			if !strings.HasPrefix(created.Token, APITokenPrefix+created.ID+"_") {
+				t.Errorf("CreateAPIToken() token = %q, want prefixed by %s%s_", created.Token, APITokenPrefix, created.ID)
+			}
+		})
+	}
+}
+
+func TestRegistryListAndRevokeAPITokens(t *testing.T) {
+	authorizer := newTestAuthorizer(t)
+	tests := []struct {
+		name      string
+		registry  *Registry
+		user      testUser
+		wantList  []string
+		canRevoke bool
+	}{
+		{name: "owner", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "bob"}, wantList: []string{"bob"}},
+		{name: "project admin", registry: &Registry{Authorizer: authorizer}, user: testUser{username: "alice"}, wantList: []string{"alice"}},
+		{name: "admin user", registry: &Registry{Authorizer: authorizer, Admins: []string{"carol"}}, user: testUser{username: "carol"}, wantList: []string{"alice", "bob"}, canRevoke: true},
+		{name: "any user without authorizer", registry: &Registry{}, user: testUser{username: "bob"}, wantList: []string{"alice", "bob"}, canRevoke: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, _ := newTestAPITokens(t)
+			tt.registry.Tokens = tokens
+			created := map[string]*types.APIToken{}
+			for _, username := range []string{"alice", "bob"} {
+				token, err := tokens.Create(context.Background(), types.APIToken{Name: "laptop", Type: types.APITokenTypePersonal, Username: username, CreatedBy: username}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				created[username] = token
+			}
+
+			list := []types.APIToken{}
+			if code := serveTokens(t, tt.registry.ListAPITokens, tt.user, http.MethodGet, "", nil, &list); code != "" {
+				t.Fatalf("ListAPITokens() code = %s", code)
+			}
+			owners := []string{}
+			for _, token := range list {
+				if token.Token != "" {
+					t.Errorf("ListAPITokens() responded the secret of %s", token.ID)
+				}
+				owners = append(owners, token.CreatedBy)
+			}
+			sort.Strings(owners)
+			if !slices.Equal(owners, tt.wantList) {
+				t.Errorf("ListAPITokens() created by %v, want %v", owners, tt.wantList)
+			}
+
+			other := created["alice"]
+			if tt.user.username == "alice" {
+				other = created["bob"]
+			}
+			wantCode := errors.ErrCode("")
+			if !tt.canRevoke {
+				wantCode = errors.ErrCodeTokenUnknown
+			}
+			vars := map[string]string{"id": other.ID}
+			if code := serveTokens(t, tt.registry.RevokeAPIToken, tt.user, http.MethodDelete, "", vars, nil); code != wantCode {
+				t.Errorf("RevokeAPIToken() of others' token code = %q, want %q", code, wantCode)
+			}
+			if tt.user.username != "carol" {
+				vars := map[string]string{"id": created[tt.user.username].ID}
+				if code := serveTokens(t, tt.registry.RevokeAPIToken, tt.user, http.MethodDelete, "", vars, nil); code != "" {
+					t.Errorf("RevokeAPIToken() of own token code = %q", code)
+				}
+			}
+		})
+	}
+}
+
+// recordingFS records the paths read from FS.
+type recordingFS struct {
+	FSProvider
+	gets []string
+}
+
+func (f *recordingFS) Get(ctx context.Context, path string) (*BlobContent, error) {
+	f.gets = append(f.gets, path)
+	return f.FSProvider.Get(ctx, path)
+}
+
+func TestAPITokensAuthenticateInvalidID(t *testing.T) {
+	tokens, _ := newTestAPITokens(t)
+	fs := &recordingFS{FSProvider: tokens.FS}
+	tokens.FS = fs
+	for _, token := range []string{
+		APITokenPrefix + "../team/x/index_s",
+		APITokenPrefix + "0123456789abcdef0_s",
+		APITokenPrefix + "0123456789ABCDEF_s",
+		APITokenPrefix + "_s",
+	} {
+		if _, err := tokens.Authenticate(context.Background(), token); err != auth.ErrUnauthenticated {
+			t.Errorf("Authenticate(%q) error = %v, want unauthenticated", token, err)
+		}
+	}
+	if len(fs.gets) != 0 || len(tokens.cache) != 0 {
+		t.Errorf("read %v and cached %d tokens, want no lookup", fs.gets, len(tokens.cache))
+	}
+}
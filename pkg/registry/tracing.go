@@ -0,0 +1,285 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/tracing"
+	"kubegems.io/modelx/pkg/types"
+)
+
+// TracingFilter starts a span for each request continues the trace of client, spans are named by the routes of router.
+func TracingFilter(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "none"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = routeName(template)
+			}
+		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.HTTPTarget(r.URL.Path),
+				semconv.HTTPUserAgent(r.UserAgent()),
+			),
+		)
+		defer span.End()
+		recorder := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCode(recorder.code))
+		// not implemented means unsupported, clients fall back
+		if recorder.code >= http.StatusInternalServerError && recorder.code != http.StatusNotImplemented {
+			span.SetStatus(codes.Error, strconv.Itoa(recorder.code))
+		}
+	})
+}
+
+// TracingFSProvider starts a span for each operation of FSProvider.
+type TracingFSProvider struct {
+	FSProvider
+}
+
+var _ FSProvider = TracingFSProvider{}
+
+func NewTracingFSProvider(fs FSProvider) TracingFSProvider {
+	return TracingFSProvider{FSProvider: fs}
+}
+
+func startStorageSpan(ctx context.Context, method string, path string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "FSProvider."+method, attribute.String("modelx.storage.path", path))
+}
+
+// endStorageSpan ends span, not found and precondition errors are expected and not recorded as errors.
+func endStorageSpan(span trace.Span, err error) {
+	if IsStorageNotFound(err) || IsPreconditionFailed(err) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
+func (t TracingFSProvider) Put(ctx context.Context, path string, content BlobContent) error {
+	ctx, span := startStorageSpan(ctx, "Put", path)
+	err := t.FSProvider.Put(ctx, path, content)
+	endStorageSpan(span, err)
+	return err
+}
+
+func (t TracingFSProvider) PutIfMatch(ctx context.Context, path string, content BlobContent, etag string) error {
+	ctx, span := startStorageSpan(ctx, "PutIfMatch", path)
+	err := t.FSProvider.PutIfMatch(ctx, path, content, etag)
+	endStorageSpan(span, err)
+	return err
+}
+
+func (t TracingFSProvider) Get(ctx context.Context, path string) (*BlobContent, error) {
+	ctx, span := startStorageSpan(ctx, "Get", path)
+	content, err := t.FSProvider.Get(ctx, path)
+	endStorageSpan(span, err)
+	return content, err
+}
+
+func (t TracingFSProvider) Stat(ctx context.Context, path string) (FsObjectMeta, error) {
+	ctx, span := startStorageSpan(ctx, "Stat", path)
+	meta, err := t.FSProvider.Stat(ctx, path)
+	endStorageSpan(span, err)
+	return meta, err
+}
+
+func (t TracingFSProvider) Remove(ctx context.Context, path string, recursive bool) error {
+	ctx, span := startStorageSpan(ctx, "Remove", path)
+	err := t.FSProvider.Remove(ctx, path, recursive)
+	endStorageSpan(span, err)
+	return err
+}
+
+func (t TracingFSProvider) Exists(ctx context.Context, path string) (bool, error) {
+	ctx, span := startStorageSpan(ctx, "Exists", path)
+	exists, err := t.FSProvider.Exists(ctx, path)
+	endStorageSpan(span, err)
+	return exists, err
+}
+
+func (t TracingFSProvider) List(ctx context.Context, path string, recursive bool) ([]FsObjectMeta, error) {
+	ctx, span := startStorageSpan(ctx, "List", path)
+	metas, err := t.FSProvider.List(ctx, path, recursive)
+	endStorageSpan(span, err)
+	return metas, err
+}
+
+// TracingRegistryStore starts a span for each call of RegistryStore.
+type TracingRegistryStore struct {
+	RegistryStore
+}
+
+var _ RegistryStore = TracingRegistryStore{}
+
+func NewTracingRegistryStore(store RegistryStore) TracingRegistryStore {
+	return TracingRegistryStore{RegistryStore: store}
+}
+
+func startStoreSpan(ctx context.Context, method string, repository string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("modelx.repository", repository))
+	return tracing.Start(ctx, "RegistryStore."+method, attrs...)
+}
+
+// endStoreSpan ends span, not found and unsupported errors are expected and not recorded as errors,
+// e.g. locations are unsupported by local storage and clients fall back to the registry.
+func endStoreSpan(span trace.Span, err error) {
+	if IsNotFoundOrUnknown(err) || errors.IsErrCode(err, errors.ErrCodeUnsupported) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
+func referenceAttr(reference string) attribute.KeyValue {
+	return attribute.String("modelx.reference", reference)
+}
+
+func digestAttr(dgst digest.Digest) attribute.KeyValue {
+	return attribute.String("modelx.digest", dgst.String())
+}
+
+func (t TracingRegistryStore) GetGlobalIndex(ctx context.Context, search string) (types.Index, error) {
+	ctx, span := startStoreSpan(ctx, "GetGlobalIndex", "")
+	index, err := t.RegistryStore.GetGlobalIndex(ctx, search)
+	endStoreSpan(span, err)
+	return index, err
+}
+
+func (t TracingRegistryStore) ListRepositories(ctx context.Context) ([]string, error) {
+	ctx, span := startStoreSpan(ctx, "ListRepositories", "")
+	repositories, err := t.RegistryStore.ListRepositories(ctx)
+	endStoreSpan(span, err)
+	return repositories, err
+}
+
+func (t TracingRegistryStore) GetIndex(ctx context.Context, repository string, search string) (types.Index, error) {
+	ctx, span := startStoreSpan(ctx, "GetIndex", repository)
+	index, err := t.RegistryStore.GetIndex(ctx, repository, search)
+	endStoreSpan(span, err)
+	return index, err
+}
+
+func (t TracingRegistryStore) RemoveIndex(ctx context.Context, repository string) error {
+	ctx, span := startStoreSpan(ctx, "RemoveIndex", repository)
+	err := t.RegistryStore.RemoveIndex(ctx, repository)
+	endStoreSpan(span, err)
+	return err
+}
+
+func (t TracingRegistryStore) ExistsManifest(ctx context.Context, repository string, reference string) (bool, error) {
+	ctx, span := startStoreSpan(ctx, "ExistsManifest", repository, referenceAttr(reference))
+	exists, err := t.RegistryStore.ExistsManifest(ctx, repository, reference)
+	endStoreSpan(span, err)
+	return exists, err
+}
+
+func (t TracingRegistryStore) GetManifest(ctx context.Context, repository string, reference string) (*types.Manifest, error) {
+	ctx, span := startStoreSpan(ctx, "GetManifest", repository, referenceAttr(reference))
+	manifest, err := t.RegistryStore.GetManifest(ctx, repository, reference)
+	endStoreSpan(span, err)
+	return manifest, err
+}
+
+func (t TracingRegistryStore) PutManifest(ctx context.Context, repository string, reference string, contentType string, manifest types.Manifest) error {
+	ctx, span := startStoreSpan(ctx, "PutManifest", repository, referenceAttr(reference))
+	err := t.RegistryStore.PutManifest(ctx, repository, reference, contentType, manifest)
+	endStoreSpan(span, err)
+	return err
+}
+
+func (t TracingRegistryStore) DeleteManifest(ctx context.Context, repository string, reference string) error {
+	ctx, span := startStoreSpan(ctx, "DeleteManifest", repository, referenceAttr(reference))
+	err := t.RegistryStore.DeleteManifest(ctx, repository, reference)
+	endStoreSpan(span, err)
+	return err
+}
+
+func (t TracingRegistryStore) ListManifestDigests(ctx context.Context, repository string) ([]digest.Digest, error) {
+	ctx, span := startStoreSpan(ctx, "ListManifestDigests", repository)
+	digests, err := t.RegistryStore.ListManifestDigests(ctx, repository)
+	endStoreSpan(span, err)
+	return digests, err
+}
+
+func (t TracingRegistryStore) ListBlobs(ctx context.Context, repository string) ([]digest.Digest, error) {
+	ctx, span := startStoreSpan(ctx, "ListBlobs", repository)
+	digests, err := t.RegistryStore.ListBlobs(ctx, repository)
+	endStoreSpan(span, err)
+	return digests, err
+}
+
+func (t TracingRegistryStore) GetBlob(ctx context.Context, repository string, dgst digest.Digest) (*BlobContent, error) {
+	ctx, span := startStoreSpan(ctx, "GetBlob", repository, digestAttr(dgst))
+	content, err := t.RegistryStore.GetBlob(ctx, repository, dgst)
+	endStoreSpan(span, err)
+	return content, err
+}
+
+func (t TracingRegistryStore) DeleteBlob(ctx context.Context, repository string, dgst digest.Digest) error {
+	ctx, span := startStoreSpan(ctx, "DeleteBlob", repository, digestAttr(dgst))
+	err := t.RegistryStore.DeleteBlob(ctx, repository, dgst)
+	endStoreSpan(span, err)
+	return err
+}
+
+func (t TracingRegistryStore) PutBlob(ctx context.Context, repository string, dgst digest.Digest, content BlobContent) error {
+	ctx, span := startStoreSpan(ctx, "PutBlob", repository, digestAttr(dgst))
+	err := t.RegistryStore.PutBlob(ctx, repository, dgst, content)
+	endStoreSpan(span, err)
+	return err
+}
+
+func (t TracingRegistryStore) MountBlob(ctx context.Context, repository string, from string, dgst digest.Digest) error {
+	ctx, span := startStoreSpan(ctx, "MountBlob", repository, digestAttr(dgst), attribute.String("modelx.from", from))
+	err := t.RegistryStore.MountBlob(ctx, repository, from, dgst)
+	endStoreSpan(span, err)
+	return err
+}
+
+func (t TracingRegistryStore) ListBlobLinks(ctx context.Context, repository string) (map[digest.Digest]BlobLink, error) {
+	ctx, span := startStoreSpan(ctx, "ListBlobLinks", repository)
+	links, err := t.RegistryStore.ListBlobLinks(ctx, repository)
+	endStoreSpan(span, err)
+	return links, err
+}
+
+func (t TracingRegistryStore) ExistsBlob(ctx context.Context, repository string, dgst digest.Digest) (bool, error) {
+	ctx, span := startStoreSpan(ctx, "ExistsBlob", repository, digestAttr(dgst))
+	exists, err := t.RegistryStore.ExistsBlob(ctx, repository, dgst)
+	endStoreSpan(span, err)
+	return exists, err
+}
+
+func (t TracingRegistryStore) GetBlobMeta(ctx context.Context, repository string, dgst digest.Digest) (BlobMeta, error) {
+	ctx, span := startStoreSpan(ctx, "GetBlobMeta", repository, digestAttr(dgst))
+	meta, err := t.RegistryStore.GetBlobMeta(ctx, repository, dgst)
+	endStoreSpan(span, err)
+	return meta, err
+}
+
+func (t TracingRegistryStore) GetBlobLocation(ctx context.Context, repository string, dgst digest.Digest,
+	purpose string, properties map[string]string,
+) (*BlobLocation, error) {
+	ctx, span := startStoreSpan(ctx, "GetBlobLocation", repository, digestAttr(dgst), attribute.String("modelx.purpose", purpose))
+	location, err := t.RegistryStore.GetBlobLocation(ctx, repository, dgst, purpose, properties)
+	endStoreSpan(span, err)
+	return location, err
+}
@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"kubegems.io/modelx/pkg/client"
+	"kubegems.io/modelx/pkg/tracing"
+)
+
+// setTestTracerProvider sets the global tracer provider and propagator until the test ends.
+func setTestTracerProvider(t *testing.T, provider trace.TracerProvider) {
+	t.Helper()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+}
+
+// newTestTracingServer serves the api of a registry with a manifest of project/a:v1 in traced storage,
+// the traceparent headers received are sent to traceparents.
+func newTestTracingServer(t *testing.T, traceparents chan<- string) *client.RegistryClient {
+	t.Helper()
+	store, _ := newTestFSStore(t)
+	putTestManifest(t, store, "project/a", "v1", testManifest(putTestBlob(t, store, "project/a", "weights")))
+	s := &Registry{Store: NewTracingRegistryStore(store)}
+	router := s.route()
+	handler := TracingFilter(router, router)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return &client.RegistryClient{Registry: server.URL}
+}
+
+func TestTracingPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	setTestTracerProvider(t, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	traceparents := make(chan string, 1)
+	registryClient := newTestTracingServer(t, traceparents)
+
+	ctx, root := tracing.Start(context.Background(), "Pull")
+	if _, err := registryClient.GetManifest(ctx, "project/a", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	clientSpan, serverSpan, storeSpan := spans["HTTP GET"], spans["GET /{name}/manifests/{reference}"], spans["RegistryStore.GetManifest"]
+	if clientSpan == nil || serverSpan == nil || storeSpan == nil {
+		t.Fatalf("spans = %v, want client, server and store spans", recorder.Ended())
+	}
+	// root -> client -> server -> store, all in the trace of root
+	parents := []struct {
+		span   sdktrace.ReadOnlySpan
+		parent trace.SpanContext
+	}{
+		{span: clientSpan, parent: root.SpanContext()},
+		{span: serverSpan, parent: clientSpan.SpanContext()},
+		{span: storeSpan, parent: serverSpan.SpanContext()},
+	}
+	for _, p := range parents {
+		if p.span.SpanContext().TraceID() != root.SpanContext().TraceID() || p.span.Parent().SpanID() != p.parent.SpanID() {
+			t.Errorf("span %s of trace %s has parent %s, want %s of trace %s", p.span.Name(),
+				p.span.SpanContext().TraceID(), p.span.Parent().SpanID(), p.parent.SpanID(), root.SpanContext().TraceID())
+		}
+	}
+	if !serverSpan.Parent().IsRemote() || serverSpan.SpanKind() != trace.SpanKindServer || clientSpan.SpanKind() != trace.SpanKindClient {
+		t.Errorf("server span kind %s with remote parent %v, client span kind %s", serverSpan.SpanKind(), serverSpan.Parent().IsRemote(), clientSpan.SpanKind())
+	}
+	for _, span := range []sdktrace.ReadOnlySpan{clientSpan, serverSpan} {
+		found := false
+		for _, attr := range span.Attributes() {
+			if attr.Key == semconv.HTTPStatusCodeKey {
+				found = attr.Value.AsInt64() == http.StatusOK
+			}
+		}
+		if !found {
+			t.Errorf("span %s attributes = %v, want status code 200", span.Name(), span.Attributes())
+		}
+	}
+	want := "00-" + root.SpanContext().TraceID().String() + "-" + clientSpan.SpanContext().SpanID().String() + "-01"
+	if got := <-traceparents; got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+}
+
+func TestTracingNotConfigured(t *testing.T) {
+	for _, env := range []string{"OTEL_TRACES_EXPORTER", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"} {
+		t.Setenv(env, "")
+	}
+	setTestTracerProvider(t, trace.NewNoopTracerProvider())
+	shutdown, err := tracing.Init(context.Background(), "modelx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+	if tracing.Enabled() {
+		t.Fatal("tracing enabled without exporter configured")
+	}
+	if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		t.Fatal("sdk tracer provider set without exporter configured")
+	}
+	traceparents := make(chan string, 2)
+	registryClient := newTestTracingServer(t, traceparents)
+
+	// requests work without a trace
+	if _, err := registryClient.GetManifest(context.Background(), "project/a", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-traceparents; got != "" {
+		t.Errorf("traceparent = %q without a trace", got)
+	}
+	// the trace of the caller is passed through, e.g. a client called by a traced service
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), remote)
+	if _, err := registryClient.GetManifest(ctx, "project/a", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-traceparents, "00-"+remote.TraceID().String()+"-"+remote.SpanID().String()+"-01"; got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,276 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/errors"
+	"kubegems.io/modelx/pkg/types"
+)
+
+const (
+	DefaultUploadDir = "data/uploads"
+	// DefaultUploadTTL is how long an upload is kept since its data last received.
+	DefaultUploadTTL = 24 * time.Hour
+)
+
+type BlobUpload struct {
+	ID         string        `json:"id"`
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest,omitempty"`
+	// User started the upload, only the user can resume it.
+	User      string    `json:"user,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// offset is the size of data committed, it's the size of the data file.
+	// it is written under mu, and read without mu so the status is available while a chunk is being received.
+	offset atomic.Int64
+	mu     sync.Mutex
+	path   string
+}
+
+// Offset returns the size of data committed.
+func (u *BlobUpload) Offset() int64 {
+	return u.offset.Load()
+}
+
+func (u *BlobUpload) Status() types.BlobUploadStatus {
+	return types.BlobUploadStatus{ID: u.ID, Digest: u.Digest, Offset: u.Offset()}
+}
+
+// BlobUploads keeps the in-progress blob upload sessions.
+// Uploaded data are staged in a local directory and sent to the store on commit.
+// Sessions are persisted in the directory, so an upload can be resumed after a restart.
+type BlobUploads struct {
+	basedir string
+	mu      sync.Mutex
+	uploads map[string]*BlobUpload
+}
+
+func NewBlobUploads(basedir string) (*BlobUploads, error) {
+	if err := os.MkdirAll(basedir, DefaultDirMode); err != nil {
+		return nil, err
+	}
+	u := &BlobUploads{basedir: basedir, uploads: map[string]*BlobUpload{}}
+	entries, err := os.ReadDir(basedir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		upload, err := u.load(id)
+		if err != nil {
+			continue
+		}
+		u.uploads[id] = upload
+	}
+	return u, nil
+}
+
+// Create starts a new upload of user, if digest is set and the user has an upload of the digest,
+// the existing one is returned, so the user can resume it.
+func (u *BlobUploads) Create(repository string, user string, dgst digest.Digest) (*BlobUpload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if dgst != "" {
+		for _, upload := range u.uploads {
+			if upload.Repository == repository && upload.User == user && upload.Digest == dgst {
+				return upload, nil
+			}
+		}
+	}
+	upload := &BlobUpload{
+		ID:         uuid.NewString(),
+		Repository: repository,
+		Digest:     dgst,
+		User:       user,
+		StartedAt:  time.Now(),
+	}
+	upload.path = filepath.Join(u.basedir, upload.ID)
+	if err := os.WriteFile(upload.path, nil, DefaultFileMode); err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	meta, err := json.Marshal(upload)
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	if err := os.WriteFile(upload.path+".json", meta, DefaultFileMode); err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	u.uploads[upload.ID] = upload
+	return upload, nil
+}
+
+// Get returns the upload of user, uploads of other users are unknown.
+func (u *BlobUploads) Get(repository string, user string, id string) (*BlobUpload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	upload, ok := u.uploads[id]
+	if !ok || upload.Repository != repository || upload.User != user {
+		return nil, errors.NewBlobUploadUnknownError(id)
+	}
+	return upload, nil
+}
+
+// Append writes content at offset start of the upload and returns the new offset.
+// start must equal to the current offset, or be -1 to append at the end.
+// data received before an error are kept, the client may query the offset and continue.
+func (u *BlobUploads) Append(ctx context.Context, upload *BlobUpload, start int64, content io.Reader) (int64, error) {
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	offset := upload.Offset()
+	if start >= 0 && start != offset {
+		return offset, errors.NewBlobUploadRangeInvalidError(offset)
+	}
+	f, err := os.OpenFile(upload.path, os.O_WRONLY|os.O_APPEND, DefaultFileMode)
+	if err != nil {
+		return offset, errors.NewInternalError(err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, content)
+	offset = upload.offset.Add(n)
+	if err != nil {
+		return offset, errors.NewBlobUploadInvalidError(err.Error())
+	}
+	return offset, nil
+}
+
+// Commit puts the uploaded content into store, which rejects the content mismatches the digest.
+// the upload is removed once the content is put or found mismatched, it is kept on other failures,
+// so the client can commit it again.
+func (u *BlobUploads) Commit(ctx context.Context, store RegistryStore, upload *BlobUpload, expected digest.Digest, contentType string) error {
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	if upload.Digest != "" && upload.Digest != expected {
+		return errors.NewDigestInvalidError(expected.String())
+	}
+	f, err := os.Open(upload.path)
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+	defer f.Close()
+
+	// the store verifies the content matches the digest
+	content := BlobContent{
+		ContentType:   contentType,
+		ContentLength: upload.Offset(),
+		Content:       f,
+	}
+	if err := store.PutBlob(ctx, upload.Repository, expected, content); err != nil {
+		if errors.IsErrCode(err, errors.ErrCodeDigestInvalid) {
+			u.remove(upload)
+		}
+		return err
+	}
+	u.remove(upload)
+	return nil
+}
+
+func (u *BlobUploads) Cancel(upload *BlobUpload) {
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	u.remove(upload)
+}
+
+// RemoveExpired removes the uploads received no data within ttl, uploads in use are kept.
+func (u *BlobUploads) RemoveExpired(ctx context.Context, ttl time.Duration) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	u.mu.Lock()
+	uploads := make([]*BlobUpload, 0, len(u.uploads))
+	for _, upload := range u.uploads {
+		uploads = append(uploads, upload)
+	}
+	u.mu.Unlock()
+
+	deadline := time.Now().Add(-ttl)
+	for _, upload := range uploads {
+		if !upload.mu.TryLock() {
+			continue
+		}
+		// the data file is modified on every chunk received
+		fi, err := os.Stat(upload.path)
+		if err == nil && fi.ModTime().After(deadline) {
+			upload.mu.Unlock()
+			continue
+		}
+		u.remove(upload)
+		upload.mu.Unlock()
+		log.Info("removed expired upload", "id", upload.ID, "repository", upload.Repository, "offset", upload.Offset())
+	}
+}
+
+// RunCleanup removes the expired uploads periodically until ctx done.
+func (u *BlobUploads) RunCleanup(ctx context.Context, ttl time.Duration) {
+	ctx = logr.NewContext(ctx, logr.FromContextOrDiscard(ctx).WithName("uploads"))
+
+	interval := ttl / 2
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.RemoveExpired(ctx, ttl)
+		}
+	}
+}
+
+func (u *BlobUploads) remove(upload *BlobUpload) {
+	u.mu.Lock()
+	delete(u.uploads, upload.ID)
+	u.mu.Unlock()
+	os.Remove(upload.path)
+	os.Remove(upload.path + ".json")
+}
+
+func (u *BlobUploads) load(id string) (*BlobUpload, error) {
+	path := filepath.Join(u.basedir, id)
+	raw, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, err
+	}
+	upload := &BlobUpload{path: path}
+	if err := json.Unmarshal(raw, upload); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	upload.offset.Store(fi.Size())
+	return upload, nil
+}
+
+// ParseUploadRange returns the start and end offset of the chunk in Content-Range header, -1 if not set.
+func ParseUploadRange(r *http.Request) (int64, int64, error) {
+	if r.Header.Get("Content-Range") == "" {
+		return -1, -1, nil
+	}
+	header := r.Header.Clone()
+	header.Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	return ParseAndCheckContentRange(header)
+}
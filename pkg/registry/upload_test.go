@@ -0,0 +1,258 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/errors"
+)
+
+func TestBlobUploadsScopedToUser(t *testing.T) {
+	uploads, err := NewBlobUploads(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromString("weights")
+	alice, err := uploads.Create("project/demo", "alice", dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		repository string
+		user       string
+		digest     digest.Digest
+		wantReuse  bool
+	}{
+		{name: "same user and digest resumes", repository: "project/demo", user: "alice", digest: dgst, wantReuse: true},
+		{name: "another user", repository: "project/demo", user: "bob", digest: dgst},
+		{name: "another repository", repository: "project/other", user: "alice", digest: dgst},
+		{name: "another digest", repository: "project/demo", user: "alice", digest: digest.FromString("other")},
+		{name: "no digest", repository: "project/demo", user: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upload, err := uploads.Create(tt.repository, tt.user, tt.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (upload == alice) != tt.wantReuse {
+				t.Errorf("Create() reused = %v, want %v", upload == alice, tt.wantReuse)
+			}
+		})
+	}
+
+	if _, err := uploads.Get("project/demo", "alice", alice.ID); err != nil {
+		t.Errorf("Get() by owner error = %v", err)
+	}
+	for _, user := range []string{"bob", ""} {
+		if _, err := uploads.Get("project/demo", user, alice.ID); !errors.IsErrCode(err, errors.ErrCodeBlobUploadUnknown) {
+			t.Errorf("Get() by %q error = %v, want upload unknown", user, err)
+		}
+	}
+	if _, err := uploads.Get("project/other", "alice", alice.ID); !errors.IsErrCode(err, errors.ErrCodeBlobUploadUnknown) {
+		t.Errorf("Get() of another repository error = %v, want upload unknown", err)
+	}
+}
+
+func TestBlobUploadsAppendAndResume(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	uploads, err := NewBlobUploads(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, err := uploads.Create("project/demo", "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset, err := uploads.Append(ctx, upload, 0, strings.NewReader("hello ")); err != nil || offset != 6 {
+		t.Fatalf("Append() = %d, %v, want 6", offset, err)
+	}
+	// a chunk not starting at the committed offset is rejected
+	if offset, err := uploads.Append(ctx, upload, 3, strings.NewReader("world")); !errors.IsErrCode(err, errors.ErrCodeBlobUploadInvalid) || offset != 6 {
+		t.Fatalf("Append() at wrong offset = %d, %v, want range error at 6", offset, err)
+	}
+	// data received before a broken connection are kept
+	broken := io.MultiReader(strings.NewReader("wor"), iotestErrReader{})
+	if offset, err := uploads.Append(ctx, upload, -1, broken); err == nil || offset != 9 {
+		t.Fatalf("Append() of broken content = %d, %v, want error at 9", offset, err)
+	}
+
+	// resumed after restart
+	restarted, err := NewBlobUploads(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := restarted.Get("project/demo", "alice", upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := resumed.Status(); status.Offset != 9 {
+		t.Fatalf("Status() offset after restart = %d, want 9", status.Offset)
+	}
+	if offset, err := restarted.Append(ctx, resumed, 9, strings.NewReader("ld")); err != nil || offset != 11 {
+		t.Fatalf("Append() after restart = %d, %v, want 11", offset, err)
+	}
+	content, _ := os.ReadFile(resumed.path)
+	if string(content) != "hello world" {
+		t.Errorf("content = %q, want hello world", content)
+	}
+}
+
+func TestBlobUploadsStatusWhileAppending(t *testing.T) {
+	ctx := context.Background()
+	uploads, err := NewBlobUploads(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, err := uploads.Create("project/demo", "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = uploads.Append(ctx, upload, -1, strings.NewReader("chunk"))
+		}()
+		go func() {
+			defer wg.Done()
+			_ = upload.Status()
+		}()
+	}
+	wg.Wait()
+	if offset := upload.Status().Offset; offset != 20 {
+		t.Errorf("Status() offset = %d, want 20", offset)
+	}
+}
+
+// failingStore fails to put blobs with err.
+type failingStore struct {
+	RegistryStore
+	err error
+}
+
+func (f failingStore) PutBlob(ctx context.Context, repository string, dgst digest.Digest, content BlobContent) error {
+	return f.err
+}
+
+func TestBlobUploadsCommit(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStore(t)
+	content := "weights"
+	dgst := digest.FromString(content)
+
+	tests := []struct {
+		name       string
+		store      RegistryStore
+		expected   digest.Digest
+		wantCode   errors.ErrCode
+		wantKept   bool
+		wantStored bool
+	}{
+		{name: "committed", store: store, expected: dgst, wantStored: true},
+		{name: "digest mismatch", store: store, expected: digest.FromString("other"), wantCode: errors.ErrCodeDigestInvalid},
+		{
+			name:     "store failure keeps the upload",
+			store:    failingStore{RegistryStore: store, err: errors.NewInternalError(stderrors.New("storage unavailable"))},
+			expected: dgst, wantCode: errors.ErrCodeInternal, wantKept: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploads, err := NewBlobUploads(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			upload, err := uploads.Create("project/"+strings.ReplaceAll(tt.name, " ", "-"), "alice", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := uploads.Append(ctx, upload, 0, bytes.NewReader([]byte(content))); err != nil {
+				t.Fatal(err)
+			}
+			err = uploads.Commit(ctx, tt.store, upload, tt.expected, "application/octet-stream")
+			if tt.wantCode == "" && err != nil || tt.wantCode != "" && !errors.IsErrCode(err, tt.wantCode) {
+				t.Fatalf("Commit() error = %v, want %q", err, tt.wantCode)
+			}
+			_, err = uploads.Get(upload.Repository, "alice", upload.ID)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("upload kept = %v, want %v", kept, tt.wantKept)
+			}
+			if _, err := os.Stat(upload.path); (err == nil) != tt.wantKept {
+				t.Errorf("upload data kept = %v, want %v", err == nil, tt.wantKept)
+			}
+			exists, err := store.ExistsBlob(ctx, upload.Repository, dgst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists != tt.wantStored {
+				t.Errorf("blob stored = %v, want %v", exists, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestBlobUploadsRemoveExpired(t *testing.T) {
+	ctx := context.Background()
+	uploads, err := NewBlobUploads(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(age time.Duration) *BlobUpload {
+		upload, err := uploads.Create("project/demo", "alice", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(-age)
+		if err := os.Chtimes(upload.path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		return upload
+	}
+	expired := create(2 * time.Hour)
+	fresh := create(time.Minute)
+	inuse := create(2 * time.Hour)
+
+	inuse.mu.Lock()
+	uploads.RemoveExpired(ctx, time.Hour)
+	inuse.mu.Unlock()
+
+	tests := []struct {
+		name     string
+		upload   *BlobUpload
+		wantKept bool
+	}{
+		{name: "expired", upload: expired},
+		{name: "fresh", upload: fresh, wantKept: true},
+		{name: "in use", upload: inuse, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uploads.Get("project/demo", "alice", tt.upload.ID)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("upload kept = %v, want %v", kept, tt.wantKept)
+			}
+			if _, err := os.Stat(tt.upload.path + ".json"); (err == nil) != tt.wantKept {
+				t.Errorf("upload session file kept = %v, want %v", err == nil, tt.wantKept)
+			}
+		})
+	}
+}
+
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read([]byte) (int, error) {
+	return 0, stderrors.New("connection reset")
+}
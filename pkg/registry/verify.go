@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/errors"
+)
+
+// VerifyingBlobContent hashes the content while it is read, the read returns a digest invalid error instead of io.EOF
+// if the content does not match expected. FSProvider.Put writes to a temporary path or a multipart upload first,
+// so a failed read leaves nothing and only the content matches expected is committed.
+type VerifyingBlobContent struct {
+	expected digest.Digest
+	verifier digest.Verifier
+	tee      io.Reader
+	content  io.ReadCloser
+	err      error
+}
+
+func NewVerifyingBlobContent(expected digest.Digest, content io.ReadCloser) (*VerifyingBlobContent, error) {
+	if err := expected.Validate(); err != nil {
+		return nil, errors.NewDigestInvalidError(expected.String())
+	}
+	verifier := expected.Verifier()
+	return &VerifyingBlobContent{
+		expected: expected,
+		verifier: verifier,
+		tee:      io.TeeReader(content, verifier),
+		content:  content,
+	}, nil
+}
+
+func (v *VerifyingBlobContent) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.tee.Read(p)
+	switch {
+	case err == io.EOF && !v.verifier.Verified():
+		v.err = errors.NewDigestInvalidError(v.expected.String())
+		return n, v.err
+	case err != nil && err != io.EOF:
+		v.err = errors.NewBlobUploadInvalidError(err.Error())
+		return n, v.err
+	}
+	return n, err
+}
+
+func (v *VerifyingBlobContent) Close() error {
+	return v.content.Close()
+}
+
+// Err returns the error of the content read, a digest invalid error if it does not match.
+func (v *VerifyingBlobContent) Err() error {
+	return v.err
+}
+
+// Verified reports whether all the content is read and matches.
+func (v *VerifyingBlobContent) Verified() bool {
+	return v.err == nil && v.verifier.Verified()
+}
+
+// DigestOfContent returns the digest of the content with algorithm of expected.
+func DigestOfContent(expected digest.Digest, content io.Reader) (digest.Digest, error) {
+	algorithm := expected.Algorithm()
+	if !algorithm.Available() {
+		return "", errors.NewDigestInvalidError(expected.String())
+	}
+	return algorithm.FromReader(content)
+}
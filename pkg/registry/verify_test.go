@@ -0,0 +1,164 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"kubegems.io/modelx/pkg/errors"
+)
+
+// streamContent is not seekable, as a request body.
+type streamContent struct {
+	io.Reader
+}
+
+func (streamContent) Close() error { return nil }
+
+type seekableContent struct {
+	*bytes.Reader
+}
+
+func (seekableContent) Close() error { return nil }
+
+func TestVerifyingBlobContent(t *testing.T) {
+	content := "model weights"
+	dgst := digest.FromString(content)
+
+	tests := []struct {
+		name     string
+		expected digest.Digest
+		content  io.ReadCloser
+		wantCode errors.ErrCode
+	}{
+		{name: "stream", expected: dgst, content: streamContent{strings.NewReader(content)}},
+		{name: "seekable", expected: dgst, content: seekableContent{bytes.NewReader([]byte(content))}},
+		{name: "mismatch", expected: digest.FromString("other"), content: streamContent{strings.NewReader(content)}, wantCode: errors.ErrCodeDigestInvalid},
+		{name: "broken stream", expected: dgst, content: streamContent{io.MultiReader(strings.NewReader("model"), iotestErrReader{})}, wantCode: errors.ErrCodeBlobUploadInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifying, err := NewVerifyingBlobContent(tt.expected, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err := io.ReadAll(verifying)
+			if tt.wantCode != "" {
+				if !errors.IsErrCode(err, tt.wantCode) || !errors.IsErrCode(verifying.Err(), tt.wantCode) || verifying.Verified() {
+					t.Fatalf("read error = %v, Err() = %v, want %s", err, verifying.Err(), tt.wantCode)
+				}
+				return
+			}
+			if err != nil || string(read) != content || !verifying.Verified() {
+				t.Errorf("read = %q, %v, verified %v, want the content verified", read, err, verifying.Verified())
+			}
+		})
+	}
+	if _, err := NewVerifyingBlobContent("sha256:short", streamContent{strings.NewReader(content)}); !errors.IsErrCode(err, errors.ErrCodeDigestInvalid) {
+		t.Errorf("NewVerifyingBlobContent() of invalid digest error = %v, want %s", err, errors.ErrCodeDigestInvalid)
+	}
+}
+
+func TestFSRegistryStorePutBlobVerifies(t *testing.T) {
+	fsstore, basepath := newTestFSStore(t)
+	s3store, fake := newTestS3Store(t)
+	content := "model weights"
+	dgst := digest.FromString(content)
+
+	tests := []struct {
+		name     string
+		content  string
+		broken   bool
+		length   int64
+		wantCode errors.ErrCode
+	}{
+		{name: "mismatch", content: "other weights", length: -1, wantCode: errors.ErrCodeDigestInvalid},
+		{name: "broken stream", content: "model", broken: true, length: -1, wantCode: errors.ErrCodeBlobUploadInvalid},
+		{name: "longer than content length", content: content + " and more", length: int64(len(content)), wantCode: errors.ErrCodeDigestInvalid},
+		{name: "chunked", content: content, length: -1},
+	}
+	for name, store := range map[string]RegistryStore{"fs": fsstore, "s3": s3store} {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				var reader io.Reader = strings.NewReader(tt.content)
+				if tt.broken {
+					reader = io.MultiReader(reader, iotestErrReader{})
+				}
+				blob := BlobContent{ContentType: "application/octet-stream", ContentLength: tt.length, Content: streamContent{reader}}
+				err := store.PutBlob(context.Background(), "project/demo", dgst, blob)
+				if tt.wantCode == "" {
+					if err != nil {
+						t.Fatalf("PutBlob() error = %v", err)
+					}
+					got, err := store.GetBlob(context.Background(), "project/demo", dgst)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer got.Close()
+					if read, _ := io.ReadAll(got.Content); string(read) != content {
+						t.Errorf("blob = %q, want %q", read, content)
+					}
+					return
+				}
+				if !errors.IsErrCode(err, tt.wantCode) {
+					t.Fatalf("PutBlob() error = %v, want %s", err, tt.wantCode)
+				}
+				if exists, _ := store.ExistsBlob(context.Background(), "project/demo", dgst); exists {
+					t.Errorf("blob committed after %s", tt.name)
+				}
+			})
+		}
+	}
+	// nothing left but the blob put
+	files := []string{}
+	_ = filepath.WalkDir(filepath.Join(basepath, "project/demo/blobs"), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, d.Name())
+		}
+		return nil
+	})
+	if len(files) != 2 {
+		t.Errorf("files of blobs = %v, want the blob and its meta", files)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	objects := []string{}
+	for key := range fake.objects {
+		if strings.Contains(key, "/blobs/") {
+			objects = append(objects, key)
+		}
+	}
+	if len(objects) != 1 {
+		t.Errorf("s3 objects of blobs = %v, want the blob only", objects)
+	}
+}
+
+func TestDigestOfContent(t *testing.T) {
+	content := "model weights"
+	tests := []struct {
+		name     string
+		expected digest.Digest
+		want     digest.Digest
+		wantErr  bool
+	}{
+		{name: "sha256", expected: digest.FromString("other"), want: digest.FromString(content)},
+		{name: "sha512", expected: digest.SHA512.FromString("other"), want: digest.SHA512.FromString(content)},
+		{name: "unknown algorithm", expected: "md5:abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DigestOfContent(tt.expected, strings.NewReader(content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DigestOfContent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DigestOfContent() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,34 @@
 package types
 
 import (
+	"encoding/json"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/opencontainers/go-digest"
+	"golang.org/x/mod/semver"
 )
 
 const (
 	AnnotationFileMode = "filemode"
 )
 
+// Annotations of a version recorded from its model config, they are indexed for search.
+// the tags and maintainers are comma separated.
+const (
+	AnnotationDescription = "modelx.description"
+	AnnotationFramework   = "modelx.framework"
+	AnnotationTask        = "modelx.task"
+	AnnotationTags        = "modelx.tags"
+	AnnotationMaintainers = "modelx.maintainers"
+)
+
+// HeaderContentDigest is the response header carries the canonical digest of the manifest.
+const HeaderContentDigest = "Modelx-Content-Digest"
+
 const (
 	BlobLocationPurposeUpload   string = "upload"
 	BlobLocationPurposeDownload string = "download"
@@ -25,6 +42,12 @@ type BlobLocation struct {
 
 type Properties map[string]any
 
+type BlobUploadStatus struct {
+	ID     string        `json:"id"`
+	Digest digest.Digest `json:"digest,omitempty"`
+	Offset int64         `json:"offset"`
+}
+
 type Descriptor struct {
 	Name        string        `json:"name"`
 	MediaType   string        `json:"mediaType,omitempty"`
@@ -34,10 +57,55 @@ type Descriptor struct {
 	URLs        []string      `json:"urls,omitempty"`
 	Modified    time.Time     `json:"modified,omitempty"`
 	Annotations Annotations   `json:"annotations,omitempty"`
+	// Immutable reports the version can not be overwritten or deleted, only set in index.
+	Immutable bool `json:"immutable,omitempty"`
 }
 
 type Annotations map[string]string
 
+const (
+	ProjectVisibilityPublic  = "public"
+	ProjectVisibilityPrivate = "private"
+)
+
+// Project is the metadata of a project, the first part of repository names.
+type Project struct {
+	Name string `json:"name"`
+	// Visibility is public or private, public projects can be read anonymously.
+	Visibility string `json:"visibility"`
+}
+
+const (
+	APITokenTypePersonal = "personal"
+	APITokenTypeRobot    = "robot"
+)
+
+// APIToken is a long-lived token issued by the registry.
+type APIToken struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Type is personal or robot.
+	Type string `json:"type"`
+	// Username is the user authenticated by the token, robot$<name> for robot accounts.
+	Username  string     `json:"username"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Token is the secret, only responded on creation.
+	Token string `json:"token,omitempty"`
+}
+
+type APITokenRequest struct {
+	Name string `json:"name"`
+	// Type is personal or robot, defaults to personal.
+	Type string `json:"type,omitempty"`
+	// Scopes limit the token, e.g. "project/*:writer", required by robot accounts.
+	Scopes []string `json:"scopes,omitempty"`
+	// ExpiresIn is the lifetime of the token like "720h", never expires if empty.
+	ExpiresIn string `json:"expiresIn,omitempty"`
+}
+
 func (a Annotations) String() string {
 	var result []string
 	for k, v := range a {
@@ -50,11 +118,111 @@ func SortDescriptorName(a, b Descriptor) int {
 	return strings.Compare(a.Name, b.Name)
 }
 
+func SortDescriptorModified(a, b Descriptor) int {
+	if c := a.Modified.Compare(b.Modified); c != 0 {
+		return c
+	}
+	return SortDescriptorName(a, b)
+}
+
+func SortDescriptorSize(a, b Descriptor) int {
+	switch {
+	case a.Size < b.Size:
+		return -1
+	case a.Size > b.Size:
+		return 1
+	}
+	return SortDescriptorName(a, b)
+}
+
+// SortDescriptorSemver compares the names as semantic versions, the "v" prefix is optional.
+// names are not semantic versions are before the others.
+func SortDescriptorSemver(a, b Descriptor) int {
+	if c := semver.Compare(canonicalSemver(a.Name), canonicalSemver(b.Name)); c != 0 {
+		return c
+	}
+	return SortDescriptorName(a, b)
+}
+
+func canonicalSemver(name string) string {
+	if strings.HasPrefix(name, "v") {
+		return name
+	}
+	return "v" + name
+}
+
+const (
+	IndexSortName     = "name"
+	IndexSortModified = "modified"
+	IndexSortSize     = "size"
+	IndexSortSemver   = "semver"
+)
+
+// DescriptorCompareFunc returns the compare function of sort, which is one of the IndexSort keys,
+// a "-" prefixed key sorts in descending order. ok is false if the key is unknown.
+func DescriptorCompareFunc(sort string) (cmp func(a, b Descriptor) int, ok bool) {
+	key := strings.TrimPrefix(sort, "-")
+	switch key {
+	case "", IndexSortName:
+		cmp = SortDescriptorName
+	case IndexSortModified:
+		cmp = SortDescriptorModified
+	case IndexSortSize:
+		cmp = SortDescriptorSize
+	case IndexSortSemver:
+		cmp = SortDescriptorSemver
+	default:
+		return nil, false
+	}
+	if key != sort {
+		asc := cmp
+		cmp = func(a, b Descriptor) int { return asc(b, a) }
+	}
+	return cmp, true
+}
+
+// IndexListOptions selects a page of the manifests in an index.
+type IndexListOptions struct {
+	// Search is a regexp to match the names.
+	Search string
+	// Query is the conditions on the metadata to match, e.g. framework=pytorch,tag=llm,size<10GB.
+	Query string
+	// Sort is the order of the manifests, see DescriptorCompareFunc. Defaults to name.
+	Sort string
+	// Limit is the max number of manifests in a page, 0 means no limit.
+	Limit int
+	// Continue is the token of the next page returned by the previous page.
+	Continue string
+}
+
+// Values returns the query of the options.
+func (o IndexListOptions) Values() url.Values {
+	query := url.Values{}
+	if o.Search != "" {
+		query.Set("search", o.Search)
+	}
+	if o.Query != "" {
+		query.Set("query", o.Query)
+	}
+	if o.Sort != "" {
+		query.Set("sort", o.Sort)
+	}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Continue != "" {
+		query.Set("continue", o.Continue)
+	}
+	return query
+}
+
 type Index struct {
 	SchemaVersion int               `json:"schemaVersion"`
 	MediaType     string            `json:"mediaType,omitempty"`
 	Manifests     []Descriptor      `json:"manifests"`
 	Annotations   map[string]string `json:"annotations,omitempty"`
+	// Continue is set if more manifests remain, it is the token to get the next page.
+	Continue string `json:"continue,omitempty"`
 }
 
 type Manifest struct {
@@ -64,3 +232,12 @@ type Manifest struct {
 	Blobs         []Descriptor      `json:"blobs"`
 	Annotations   map[string]string `json:"annotations,omitempty"`
 }
+
+// Digest returns the canonical digest of the manifest, the digest of its json encoding.
+func (m Manifest) Digest() (digest.Digest, error) {
+	content, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(content), nil
+}